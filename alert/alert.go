@@ -0,0 +1,218 @@
+package alert
+
+import (
+	"crypto-triangular-arbitrage-watch/bybit"
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/notification"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+const CONNECTION_CHECK_INTERVAL_SECOND = 10
+
+// Engine evaluates ALERT_RULES, each rule sends to its named notifier targets
+type Engine struct {
+	Rules      []*Rule
+	Router     *notification.Router
+	ConnStates func() []bybit.ConnState
+	Formatter  *clock.Formatter // quiet hours are in its timezone
+
+	mu        sync.Mutex
+	lastFired map[string]time.Time // rule|key -> time, for dedupe
+	ruleFired map[string]time.Time // rule -> time, for suppression
+	escalated map[string]bool      // rule|connection which is down, to send the recovery
+	matched   map[string]time.Time // rule|combination -> since when the rule has matched, for min_episode_second
+	fired     map[string]bool      // rule|combination which has fired since it started matching
+}
+
+// Init returns nil if ALERT_RULES isn't set, opportunities go to the watch channel then
+func Init(router *notification.Router) *Engine {
+	var configs []RuleConfig
+	if err := viper.UnmarshalKey("ALERT_RULES", &configs); err != nil {
+		log.Fatalf("ALERT_RULES is invalid: %v", err)
+	}
+	if len(configs) == 0 {
+		return nil
+	}
+	e := &Engine{
+		Router:    router,
+		Formatter: clock.DefaultFormatter(),
+		lastFired: make(map[string]time.Time),
+		ruleFired: make(map[string]time.Time),
+		escalated: make(map[string]bool),
+		matched:   make(map[string]time.Time),
+		fired:     make(map[string]bool),
+	}
+	for i, config := range configs {
+		rule, err := newRule(config)
+		if err != nil {
+			log.Fatalf("ALERT_RULES[%d] '%s': %v", i, config.Name, err)
+		}
+		for _, target := range rule.Targets {
+			if !router.HasRoute(target) {
+				log.Fatalf("ALERT_RULES[%d] '%s': target '%s' isn't in NOTIFIERS", i, config.Name, target)
+			}
+		}
+		e.Rules = append(e.Rules, rule)
+	}
+	return e
+}
+
+func (e *Engine) SetConnStates(connStates func() []bybit.ConnState) {
+	e.ConnStates = connStates
+}
+
+func (e *Engine) SetFormatter(f *clock.Formatter) {
+	e.Formatter = f
+}
+
+// Update is called on every calculation of a combination, including the ones below TARGET_PROFIT_FOR_TRADE.
+// A rule fires once per match after it has matched for min_episode_second, build is only called when it fires.
+func (e *Engine) Update(combination string, profit decimal.Decimal, size decimal.Decimal, ts time.Time, build func() *notification.OpportunityAlert) {
+	var alert *notification.OpportunityAlert
+	for _, rule := range e.Rules {
+		if rule.Type != RULE_TYPE_OPPORTUNITY {
+			continue
+		}
+		if !e.fire(rule, combination, rule.matchOpportunity(combination, profit, size), ts) {
+			continue
+		}
+		if alert == nil {
+			alert = build()
+		}
+		e.Router.PublishTo(rule.Targets, &notification.Message{
+			Channel:       notification.CHANNEL_WATCH,
+			Severity:      rule.Severity,
+			Text:          fmt.Sprintf("[%s] %s %s%% size %s", rule.Name, alert.Combination, alert.Profit.Shift(2).StringFixed(3), alert.AvailableSize.StringFixed(0)),
+			Ts:            alert.Ts,
+			Opportunities: []*notification.OpportunityAlert{alert},
+		})
+	}
+}
+
+// Reset ends the matches of the combinations e.g. they are disabled or their orderbooks are stale
+func (e *Engine) Reset(match func(combination string) bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key := range e.matched {
+		// key is rule|combination, names of combinations don't have |
+		if match(key[strings.LastIndex(key, "|")+1:]) {
+			delete(e.matched, key)
+			delete(e.fired, key)
+		}
+	}
+}
+
+// fire tracks how long the rule has matched the combination, it's true once per match
+func (e *Engine) fire(rule *Rule, combination string, matched bool, ts time.Time) bool {
+	key := rule.Name + "|" + combination
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !matched {
+		delete(e.matched, key)
+		delete(e.fired, key)
+		return false
+	}
+	since, ok := e.matched[key]
+	if !ok {
+		since = ts
+		e.matched[key] = ts
+	}
+	if e.fired[key] || ts.Sub(since) < rule.MinEpisode {
+		return false
+	}
+	if !e.allowLocked(rule, combination, ts) {
+		return false
+	}
+	e.fired[key] = true
+	return true
+}
+
+// Listen checks connection rules, it blocks
+func (e *Engine) Listen() {
+	ticker := time.NewTicker(time.Duration(CONNECTION_CHECK_INTERVAL_SECOND) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		e.checkConnections(e.Formatter.Now())
+	}
+}
+
+func (e *Engine) checkConnections(now time.Time) {
+	if e.ConnStates == nil {
+		return
+	}
+	for _, state := range e.ConnStates() {
+		for _, rule := range e.Rules {
+			if rule.Type != RULE_TYPE_CONNECTION {
+				continue
+			}
+			key := rule.Name + "|" + state.Name
+			e.mu.Lock()
+			escalated := e.escalated[key]
+			e.mu.Unlock()
+
+			down := !state.DownSince.IsZero() && now.Sub(state.DownSince) >= rule.ReconnectingWindow
+			switch {
+			case down && !escalated:
+				if !e.allow(rule, state.Name, now) {
+					continue
+				}
+				e.setEscalated(key, true)
+				e.Router.PublishTo(rule.Targets, &notification.Message{
+					Channel:  notification.CHANNEL_SYSTEM_LOGS,
+					Severity: rule.Severity,
+					Text: fmt.Sprintf("[%s] connection %s has been reconnecting since %s (%s, %d reconnects), last error: %s",
+						rule.Name, state.Name, e.Formatter.Format(state.DownSince), now.Sub(state.DownSince).Round(time.Second), state.Reconnects, state.LastError),
+					Ts: now,
+				})
+			case !down && escalated && state.Connected:
+				e.setEscalated(key, false)
+				e.Router.PublishTo(rule.Targets, &notification.Message{
+					Channel:  notification.CHANNEL_SYSTEM_LOGS,
+					Severity: rule.Severity,
+					Text:     fmt.Sprintf("[%s] connection %s recovered", rule.Name, state.Name),
+					Ts:       now,
+				})
+			}
+		}
+	}
+}
+
+func (e *Engine) setEscalated(key string, escalated bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if escalated {
+		e.escalated[key] = true
+	} else {
+		delete(e.escalated, key)
+	}
+}
+
+// allow applies quiet hours, suppression and dedupe, it records the firing if it's allowed
+func (e *Engine) allow(rule *Rule, key string, now time.Time) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.allowLocked(rule, key, now)
+}
+
+func (e *Engine) allowLocked(rule *Rule, key string, now time.Time) bool {
+	if rule.QuietHours != nil && rule.QuietHours.In(e.Formatter.In(now)) {
+		return false
+	}
+	if rule.Suppress > 0 && now.Sub(e.ruleFired[rule.Name]) < rule.Suppress {
+		return false
+	}
+	dedupeKey := rule.Name + "|" + key
+	if rule.Dedupe > 0 && now.Sub(e.lastFired[dedupeKey]) < rule.Dedupe {
+		return false
+	}
+	e.ruleFired[rule.Name] = now
+	e.lastFired[dedupeKey] = now
+	return true
+}
@@ -0,0 +1,124 @@
+package alert
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/notification"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const testCombination = "BTCUSDT->ETHBTC->ETHUSDT"
+
+type fakeBackend struct {
+	msgs chan *notification.Message
+}
+
+func (b *fakeBackend) Send(msg *notification.Message) error {
+	b.msgs <- msg
+	return nil
+}
+
+func newTestEngine(t *testing.T, config RuleConfig) (*Engine, *fakeBackend) {
+	t.Helper()
+	config.Type = RULE_TYPE_OPPORTUNITY
+	config.Targets = []string{"test"}
+	rule, err := newRule(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &fakeBackend{msgs: make(chan *notification.Message, 10)}
+	return &Engine{
+		Rules:     []*Rule{rule},
+		Router:    notification.NewRouter(&notification.Route{Name: "test", Backend: backend}),
+		Formatter: clock.DefaultFormatter(),
+		lastFired: make(map[string]time.Time),
+		ruleFired: make(map[string]time.Time),
+		escalated: make(map[string]bool),
+		matched:   make(map[string]time.Time),
+		fired:     make(map[string]bool),
+	}, backend
+}
+
+// update returns whether the alert is built, it's only built when a rule fires
+func update(e *Engine, profit float64, ts time.Time) bool {
+	var built bool
+	e.Update(testCombination, decimal.NewFromFloat(profit), decimal.NewFromInt(1000), ts, func() *notification.OpportunityAlert {
+		built = true
+		return &notification.OpportunityAlert{Combination: testCombination, Profit: decimal.NewFromFloat(profit), Ts: ts}
+	})
+	return built
+}
+
+func TestEngineMinEpisode(t *testing.T) {
+	e, backend := newTestEngine(t, RuleConfig{Name: "lasting", MinProfit: "0.0005", MinEpisodeSecond: 2})
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Below TARGET_PROFIT_FOR_TRADE (0.1%) but over min_profit of the rule
+	if update(e, 0.0006, start) || update(e, 0.0006, start.Add(time.Second)) {
+		t.Fatal("fired before min_episode_second")
+	}
+	if !update(e, 0.0007, start.Add(2*time.Second)) {
+		t.Fatal("didn't fire after min_episode_second")
+	}
+	select {
+	case msg := <-backend.msgs:
+		if msg.Severity != notification.SEVERITY_INFO || len(msg.Opportunities) != 1 {
+			t.Errorf("message = %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+	}
+	if update(e, 0.0007, start.Add(3*time.Second)) {
+		t.Error("fired twice in the same match")
+	}
+
+	// The match ends, the next one starts over
+	update(e, 0.0001, start.Add(4*time.Second))
+	if update(e, 0.0006, start.Add(5*time.Second)) || update(e, 0.0006, start.Add(6*time.Second)) {
+		t.Error("fired before min_episode_second of the next match")
+	}
+	if !update(e, 0.0006, start.Add(7*time.Second)) {
+		t.Error("didn't fire in the next match")
+	}
+}
+
+func TestEngineFiresAtOnceWithoutMinEpisode(t *testing.T) {
+	e, _ := newTestEngine(t, RuleConfig{Name: "instant", MinProfit: "0.001", MinAvailableSize: "100"})
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if update(e, 0.0009, start) {
+		t.Error("fired below min_profit")
+	}
+	if !update(e, 0.001, start.Add(time.Millisecond)) {
+		t.Error("didn't fire on the first update over min_profit")
+	}
+}
+
+func TestEngineReset(t *testing.T) {
+	e, _ := newTestEngine(t, RuleConfig{Name: "lasting", MinEpisodeSecond: 2})
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	update(e, 0.001, start)
+	e.Reset(func(combination string) bool { return combination == testCombination })
+	if update(e, 0.001, start.Add(2*time.Second)) {
+		t.Error("the match continued after Reset")
+	}
+	if !update(e, 0.001, start.Add(4*time.Second)) {
+		t.Error("didn't fire after the match restarted")
+	}
+}
+
+func TestEngineDedupe(t *testing.T) {
+	e, _ := newTestEngine(t, RuleConfig{Name: "dedupe", DedupeSecond: 60})
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if !update(e, 0.001, start) {
+		t.Fatal("didn't fire")
+	}
+	update(e, -0.001, start.Add(time.Second))
+	if update(e, 0.001, start.Add(2*time.Second)) {
+		t.Error("fired within dedupe_second")
+	}
+	if !update(e, 0.001, start.Add(61*time.Second)) {
+		t.Error("didn't fire after dedupe_second")
+	}
+}
@@ -0,0 +1,146 @@
+package alert
+
+import (
+	"crypto-triangular-arbitrage-watch/notification"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	RULE_TYPE_OPPORTUNITY = "opportunity"
+	RULE_TYPE_CONNECTION  = "connection"
+)
+
+// RuleConfig is an item of ALERT_RULES in the config
+type RuleConfig struct {
+	Name           string   `mapstructure:"name"`
+	Type           string   `mapstructure:"type"`
+	Targets        []string `mapstructure:"targets"`         // names of NOTIFIERS
+	Severity       string   `mapstructure:"severity"`        // info if it's empty
+	QuietHours     string   `mapstructure:"quiet_hours"`     // in TIMEZONE e.g. 23:00-07:00
+	DedupeSecond   int      `mapstructure:"dedupe_second"`   // the same combination or connection fires once within the window
+	SuppressSecond int      `mapstructure:"suppress_second"` // the rule is silent within the window after it fires
+
+	// opportunity
+	Combinations     []string `mapstructure:"combinations"` // all if it's empty
+	MinProfit        string   `mapstructure:"min_profit"`   // 0.001 = 0.1%
+	MinEpisodeSecond float64  `mapstructure:"min_episode_second"`
+	MinAvailableSize string   `mapstructure:"min_available_size"` // USDT
+
+	// connection
+	ReconnectingMinute float64 `mapstructure:"reconnecting_minute"`
+}
+
+type Rule struct {
+	Name               string
+	Type               string
+	Targets            []string
+	Severity           notification.Severity
+	QuietHours         *QuietHours
+	Dedupe             time.Duration
+	Suppress           time.Duration
+	Combinations       map[string]bool
+	MinProfit          decimal.Decimal
+	MinEpisode         time.Duration
+	MinAvailableSize   decimal.Decimal
+	ReconnectingWindow time.Duration
+}
+
+func newRule(config RuleConfig) (*Rule, error) {
+	rule := &Rule{
+		Name:               config.Name,
+		Type:               config.Type,
+		Targets:            config.Targets,
+		Severity:           notification.SEVERITY_INFO,
+		Dedupe:             time.Duration(config.DedupeSecond) * time.Second,
+		Suppress:           time.Duration(config.SuppressSecond) * time.Second,
+		Combinations:       make(map[string]bool),
+		MinEpisode:         time.Duration(config.MinEpisodeSecond * float64(time.Second)),
+		ReconnectingWindow: time.Duration(config.ReconnectingMinute * float64(time.Minute)),
+	}
+	if rule.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if rule.Type != RULE_TYPE_OPPORTUNITY && rule.Type != RULE_TYPE_CONNECTION {
+		return nil, fmt.Errorf("type '%s' not supported", rule.Type)
+	}
+	if len(rule.Targets) == 0 {
+		return nil, fmt.Errorf("targets are required")
+	}
+	var err error
+	if config.Severity != "" {
+		if rule.Severity, err = notification.ParseSeverity(config.Severity); err != nil {
+			return nil, err
+		}
+	}
+	if config.QuietHours != "" {
+		if rule.QuietHours, err = parseQuietHours(config.QuietHours); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range config.Combinations {
+		rule.Combinations[c] = true
+	}
+	if config.MinProfit != "" {
+		if rule.MinProfit, err = decimal.NewFromString(config.MinProfit); err != nil {
+			return nil, fmt.Errorf("min_profit is invalid: %v", err)
+		}
+	}
+	if config.MinAvailableSize != "" {
+		if rule.MinAvailableSize, err = decimal.NewFromString(config.MinAvailableSize); err != nil {
+			return nil, fmt.Errorf("min_available_size is invalid: %v", err)
+		}
+	}
+	if rule.Type == RULE_TYPE_CONNECTION && rule.ReconnectingWindow <= 0 {
+		return nil, fmt.Errorf("reconnecting_minute is required")
+	}
+	return rule, nil
+}
+
+// matchOpportunity doesn't check MinEpisode, the engine tracks how long it has matched
+func (r *Rule) matchOpportunity(combination string, profit decimal.Decimal, size decimal.Decimal) bool {
+	if len(r.Combinations) > 0 && !r.Combinations[combination] {
+		return false
+	}
+	if profit.LessThan(r.MinProfit) {
+		return false
+	}
+	return !size.LessThan(r.MinAvailableSize)
+}
+
+// QuietHours mutes the rule between From and To in TIMEZONE, it can cross midnight e.g. 23:00-07:00
+type QuietHours struct {
+	From time.Duration // since midnight
+	To   time.Duration
+}
+
+func parseQuietHours(s string) (*QuietHours, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("quiet_hours '%s' is invalid, e.g. 23:00-07:00", s)
+	}
+	f, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return nil, fmt.Errorf("quiet_hours '%s' is invalid: %v", s, err)
+	}
+	t, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return nil, fmt.Errorf("quiet_hours '%s' is invalid: %v", s, err)
+	}
+	return &QuietHours{
+		From: time.Duration(f.Hour())*time.Hour + time.Duration(f.Minute())*time.Minute,
+		To:   time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute,
+	}, nil
+}
+
+// In checks the wall clock of t in its location
+func (q *QuietHours) In(t time.Time) bool {
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if q.From <= q.To {
+		return now >= q.From && now < q.To
+	}
+	return now >= q.From || now < q.To
+}
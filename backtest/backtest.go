@@ -0,0 +1,175 @@
+package backtest
+
+import (
+	"crypto-triangular-arbitrage-watch/bybit"
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/recorder"
+	"crypto-triangular-arbitrage-watch/runner"
+	"crypto-triangular-arbitrage-watch/tri"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Big enough to hold all results of a frame, they are drained after each frame
+const RESULT_CHANNEL_BUFFER = 1024
+
+type Params struct {
+	Paths       []string        `json:"paths"`        // recorded files
+	Fee         decimal.Decimal `json:"fee"`          // 0.001 = 0.1%
+	Threshold   decimal.Decimal `json:"threshold"`    // TARGET_PROFIT_FOR_TRADE
+	Latency     time.Duration   `json:"latency"`      // from detection to execution
+	SlippageBps decimal.Decimal `json:"slippage_bps"` // every leg is filled at a worse price by this
+	SymCombPath string          `json:"sym_comb_path"`
+	SymInstPath string          `json:"sym_inst_path"`
+}
+
+// Backtest replays recorded orderbook frames through the same runner code path with a simulated clock
+type Backtest struct {
+	Params  Params
+	Tri     *tri.Tri
+	Runner  *runner.OrderbookRunner
+	Clock   *clock.Sim
+	Report  *Report
+	merge   bybit.OrderbookMerge // frames of redundant connections are replayed once
+	pending []*runner.MostProfit // detected opportunities waiting for the latency
+}
+
+func Init(params Params) *Backtest {
+	t := tri.Init()
+	if params.SymCombPath != "" {
+		t.SetSymCombPath(params.SymCombPath)
+	}
+	if params.SymInstPath != "" {
+		t.SetSymInstPath(params.SymInstPath)
+	}
+	t.Build()
+
+	sim := &clock.Sim{}
+	or := runner.Init(t)
+	or.SetClock(sim)
+	or.SetFee(params.Fee)
+	or.TargetProfit = params.Threshold
+	or.ChannelWatch = make(chan *runner.MostProfit, RESULT_CHANNEL_BUFFER)
+	or.ChannelSystemLogs = make(chan *runner.MostProfit, RESULT_CHANNEL_BUFFER)
+
+	return &Backtest{
+		Params: params,
+		Tri:    t,
+		Runner: or,
+		Clock:  sim,
+		Report: initReport(params),
+	}
+}
+
+func (bt *Backtest) Run() (*Report, error) {
+	if err := recorder.ReadFiles(bt.Params.Paths, bt.handleFrame); err != nil {
+		return nil, err
+	}
+	// Opportunities at the end of the records are executed with the last prices
+	bt.executeDue(bt.Clock.Now().Add(bt.Params.Latency))
+	bt.drain()
+	bt.Report.finish()
+	return bt.Report, nil
+}
+
+func (bt *Backtest) handleFrame(frame *recorder.Frame) error {
+	if frame.Channel != recorder.CHANNEL_PUBLIC {
+		return nil
+	}
+	now := time.Unix(0, frame.Ts)
+	bt.Clock.Set(now)
+	bt.executeDue(now)
+	bt.Report.addFrame(now)
+
+	var topicResp bybit.TopicResp
+	if err := json.Unmarshal(frame.Data, &topicResp); err != nil {
+		return fmt.Errorf("failed to parse frame, err: %v", err)
+	}
+	if !strings.HasPrefix(topicResp.Topic, "orderbook.") {
+		return nil
+	}
+	var data runner.OrderbookData
+	if err := json.Unmarshal(topicResp.Data, &data); err != nil {
+		return fmt.Errorf("failed to parse topic data, err: %v", err)
+	}
+	// Symbols which aren't in the combinations file are skipped
+	if _, ok := bt.Runner.OrderbookListeners[data.Symbol]; !ok {
+		return nil
+	}
+	if first, _ := bt.merge.Accept(&data, now); !first {
+		return nil
+	}
+	bt.Runner.HandleOrderbookData(data.Symbol, &data)
+	bt.drain()
+	return nil
+}
+
+// drain collects everything the runner emitted while handling the frame
+func (bt *Backtest) drain() {
+	for {
+		select {
+		case mostProfit := <-bt.Runner.ChannelWatch:
+			bt.Report.addOpportunity(mostProfit)
+			bt.pending = append(bt.pending, mostProfit)
+		case <-bt.Runner.ChannelSystemLogs:
+			bt.Report.Evaluations++
+		case episode := <-bt.Runner.Episodes.Closed():
+			bt.Report.addEpisode(episode)
+		default:
+			return
+		}
+	}
+}
+
+func (bt *Backtest) executeDue(now time.Time) {
+	var i int
+	for i = 0; i < len(bt.pending); i++ {
+		if bt.pending[i].Ts.Add(bt.Params.Latency).After(now) {
+			break
+		}
+		bt.Report.addFill(bt.simulateFill(bt.pending[i]))
+	}
+	bt.pending = bt.pending[i:]
+}
+
+// simulateFill executes the 3 legs with the prices after the latency, size is capped by the available size on the top of the orderbooks
+func (bt *Backtest) simulateFill(mostProfit *runner.MostProfit) *Fill {
+	c := mostProfit.Combination
+	fill := &Fill{
+		Ts:             mostProfit.Ts.Add(bt.Params.Latency),
+		Combination:    c.Name(),
+		DetectedProfit: mostProfit.Profit(),
+	}
+	notional := decimal.Min(decimal.NewFromInt(runner.CAPITAL), runner.AvailableSize(c))
+	if !notional.IsPositive() {
+		return fill
+	}
+
+	net := bt.Runner.NetPercent
+	slippage := bt.Params.SlippageBps.Div(decimal.NewFromInt(10000))
+	worseAsk := func(so *tri.SymbolOrder) decimal.Decimal {
+		return so.Ask.Price.Mul(decimal.NewFromInt(1).Add(slippage))
+	}
+	worseBid := func(so *tri.SymbolOrder) decimal.Decimal {
+		return so.Bid.Price.Mul(decimal.NewFromInt(1).Sub(slippage))
+	}
+
+	var secondTrade decimal.Decimal
+	firstTrade := notional.Div(worseAsk(c.SymbolOrders[0])).Mul(net)
+	if c.BaseQuote {
+		secondTrade = firstTrade.Mul(worseBid(c.SymbolOrders[1])).Mul(net)
+	} else {
+		secondTrade = firstTrade.Div(worseAsk(c.SymbolOrders[1])).Mul(net)
+	}
+	thirdTrade := secondTrade.Mul(worseBid(c.SymbolOrders[2])).Mul(net)
+
+	fill.Notional = notional
+	fill.End = thirdTrade
+	fill.Pnl = thirdTrade.Sub(notional)
+	fill.Profit = fill.Pnl.Div(notional)
+	return fill
+}
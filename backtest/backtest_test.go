@@ -0,0 +1,133 @@
+package backtest
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const COMBINATION_BTC_ETH = "BTCUSDT->ETHBTC->ETHUSDT"
+
+// The fixture has 8 frames:
+// 0ms BTCUSDT 40000, ETHBTC 0.05 and ETHUSDT 2000, no profit
+// 1000ms ETHUSDT 2004/2005, BTCUSDT->ETHBTC->ETHUSDT makes 0.2%
+// 1010ms the same update from the redundant connection
+// 1050ms a private frame
+// 1100ms the same prices with a new seq, within the rate limit of the opportunity
+// 2000ms ETHUSDT 2000, no profit
+func testParams() Params {
+	return Params{
+		Paths:       []string{"testdata/frames-20231114T221320Z.jsonl.gz"},
+		Fee:         decimal.Zero,
+		Threshold:   decimal.NewFromFloat(0.001),
+		Latency:     100 * time.Millisecond,
+		SlippageBps: decimal.Zero,
+		SymCombPath: "testdata/symbol_combinations.json",
+		SymInstPath: "testdata/symbol_instruments.json",
+	}
+}
+
+func runBacktest(t *testing.T, params Params) *Report {
+	t.Helper()
+	report, err := Init(params).Run()
+	if err != nil {
+		t.Fatalf("failed to run the backtest, err: %v", err)
+	}
+	return report
+}
+
+func TestRun(t *testing.T) {
+	report := runBacktest(t, testParams())
+
+	if report.Frames != 7 {
+		t.Errorf("frames = %d, want 7", report.Frames)
+	}
+	if report.To.Sub(report.From) != 2*time.Second {
+		t.Errorf("period = %v, want 2s", report.To.Sub(report.From))
+	}
+	// Before all prices are ready, the rate limited frame and the duplicate aren't evaluated
+	if report.Evaluations != 3 {
+		t.Errorf("evaluations = %d, want 3", report.Evaluations)
+	}
+	if len(report.Opportunities) != 1 || report.Opportunities[COMBINATION_BTC_ETH] != 1 {
+		t.Errorf("opportunities = %v, want 1 of %s", report.Opportunities, COMBINATION_BTC_ETH)
+	}
+
+	episode, ok := report.Episodes[COMBINATION_BTC_ETH]
+	if !ok || len(report.Episodes) != 1 {
+		t.Fatalf("episodes = %v, want 1 of %s", report.Episodes, COMBINATION_BTC_ETH)
+	}
+	if episode.Count != 1 || episode.MinMs != 1000 || episode.MaxMs != 1000 || episode.TotalMs != 1000 {
+		t.Errorf("episode = %+v, want 1 of 1000ms", episode)
+	}
+	if !episode.PeakProfit.Equal(decimal.NewFromFloat(0.002)) {
+		t.Errorf("peak profit = %s, want 0.002", episode.PeakProfit)
+	}
+
+	if len(report.Fills) != 1 {
+		t.Fatalf("fills = %d, want 1", len(report.Fills))
+	}
+	fill := report.Fills[0]
+	if !fill.Ts.Equal(report.From.Add(1100 * time.Millisecond)) {
+		t.Errorf("fill at %v, want 1100ms after the first frame", fill.Ts.Sub(report.From))
+	}
+	if !fill.DetectedProfit.Equal(decimal.NewFromFloat(0.002)) {
+		t.Errorf("detected profit = %s, want 0.002", fill.DetectedProfit)
+	}
+	if report.Wins != 1 || !report.Notional.Equal(decimal.NewFromInt(1000)) || !report.Pnl.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("wins = %d, notional = %s, pnl = %s, want 1, 1000, 2", report.Wins, report.Notional, report.Pnl)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), COMBINATION_BTC_ETH) {
+		t.Errorf("report doesn't have %s:\n%s", COMBINATION_BTC_ETH, out.String())
+	}
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+	var outs [2]bytes.Buffer
+	for i := range outs {
+		runBacktest(t, testParams()).Print(&outs[i])
+	}
+	if outs[0].String() != outs[1].String() {
+		t.Errorf("reports differ:\n%s\n%s", outs[0].String(), outs[1].String())
+	}
+}
+
+func TestRunWithSlippage(t *testing.T) {
+	params := testParams()
+	params.Latency = 0
+	params.SlippageBps = decimal.NewFromInt(10)
+	report := runBacktest(t, params)
+
+	// Both buys are 0.1% higher and the sell is 0.1% lower
+	worse := decimal.NewFromFloat(1.001)
+	want := decimal.NewFromInt(1000).Div(decimal.NewFromInt(40000).Mul(worse)).
+		Div(decimal.NewFromFloat(0.05).Mul(worse)).
+		Mul(decimal.NewFromInt(2004).Mul(decimal.NewFromFloat(0.999))).
+		Sub(decimal.NewFromInt(1000))
+	if len(report.Fills) != 1 || !report.Pnl.Round(8).Equal(want.Round(8)) {
+		t.Fatalf("fills = %d, pnl = %s, want 1, %s", len(report.Fills), report.Pnl, want.Round(8))
+	}
+	if report.Wins != 0 {
+		t.Errorf("wins = %d, want 0", report.Wins)
+	}
+}
+
+func TestRunWithFee(t *testing.T) {
+	params := testParams()
+	params.Fee = decimal.NewFromFloat(0.001)
+	report := runBacktest(t, params)
+
+	// 0.2% doesn't cover the fee of 3 trades
+	if len(report.Opportunities) != 0 || len(report.Episodes) != 0 || len(report.Fills) != 0 {
+		t.Errorf("opportunities = %v, episodes = %v, fills = %d, want none", report.Opportunities, report.Episodes, len(report.Fills))
+	}
+	if report.Evaluations != 4 {
+		t.Errorf("evaluations = %d, want 4", report.Evaluations)
+	}
+}
@@ -0,0 +1,70 @@
+package backtest
+
+import (
+	"crypto-triangular-arbitrage-watch/recorder"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+// RunCommand handles `backtest [flags] [files...]`, all files in --dir are replayed if no file is given
+//
+//	backtest --dir=records --fee=0.001 --threshold=0.001 --latency=50ms --slippage_bps=1
+func RunCommand(args []string) {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	dir := fs.String("dir", viper.GetString("RECORDER_DIR"), "recorded files dir")
+	fee := fs.String("fee", "0.001", "fee per trade, 0.001 = 0.1%")
+	threshold := fs.String("threshold", "0.001", "target profit, 0.001 = 0.1%")
+	latency := fs.Duration("latency", 0, "from detection to execution e.g. 50ms")
+	slippageBps := fs.String("slippage_bps", "0", "slippage per leg in bps")
+	symComb := fs.String("sym_comb", "", "symbol combinations file (default symbol_combinations.json)")
+	symInst := fs.String("sym_inst", "", "symbol instruments file (default symbol_instruments.json)")
+	output := fs.String("output", "", "write the report as JSON into this file")
+	fs.Parse(args)
+
+	params := Params{
+		Paths:       fs.Args(),
+		Latency:     *latency,
+		SymCombPath: *symComb,
+		SymInstPath: *symInst,
+	}
+	var err error
+	if params.Fee, err = decimal.NewFromString(*fee); err != nil {
+		log.Fatalf("--fee is invalid: %v", err)
+	}
+	if params.Threshold, err = decimal.NewFromString(*threshold); err != nil {
+		log.Fatalf("--threshold is invalid: %v", err)
+	}
+	if params.SlippageBps, err = decimal.NewFromString(*slippageBps); err != nil {
+		log.Fatalf("--slippage_bps is invalid: %v", err)
+	}
+	if len(params.Paths) == 0 {
+		if *dir == "" {
+			log.Fatal("--dir or files are required")
+		}
+		if params.Paths, err = recorder.Files(*dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	report, err := Init(params).Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	report.Print(os.Stdout)
+
+	if *output != "" {
+		body, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = os.WriteFile(*output, body, 0644); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("'%s' has been created", *output)
+	}
+}
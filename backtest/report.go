@@ -0,0 +1,139 @@
+package backtest
+
+import (
+	"crypto-triangular-arbitrage-watch/runner"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type Report struct {
+	Params        Params                     `json:"params"`
+	From          time.Time                  `json:"from"`
+	To            time.Time                  `json:"to"`
+	Frames        int64                      `json:"frames"`
+	Evaluations   int64                      `json:"evaluations"`
+	Opportunities map[string]int64           `json:"opportunities"` // combination -> count
+	Episodes      map[string]*EpisodeSummary `json:"episodes"`      // combination -> summary
+	Fills         []*Fill                    `json:"fills"`
+	Wins          int64                      `json:"wins"`
+	Notional      decimal.Decimal            `json:"notional"`
+	Pnl           decimal.Decimal            `json:"pnl"`
+	durations     map[string][]time.Duration
+}
+
+type EpisodeSummary struct {
+	Count      int64           `json:"count"`
+	MinMs      int64           `json:"min_ms"`
+	MedianMs   int64           `json:"median_ms"`
+	P90Ms      int64           `json:"p90_ms"`
+	MaxMs      int64           `json:"max_ms"`
+	TotalMs    int64           `json:"total_ms"`
+	PeakProfit decimal.Decimal `json:"peak_profit"`
+}
+
+type Fill struct {
+	Ts             time.Time       `json:"ts"`
+	Combination    string          `json:"combination"`
+	DetectedProfit decimal.Decimal `json:"detected_profit"`
+	Profit         decimal.Decimal `json:"profit"`
+	Notional       decimal.Decimal `json:"notional"` // 0 means nothing is available when it's executed
+	End            decimal.Decimal `json:"end"`
+	Pnl            decimal.Decimal `json:"pnl"`
+}
+
+func initReport(params Params) *Report {
+	return &Report{
+		Params:        params,
+		Opportunities: make(map[string]int64),
+		Episodes:      make(map[string]*EpisodeSummary),
+		durations:     make(map[string][]time.Duration),
+	}
+}
+
+func (r *Report) addFrame(ts time.Time) {
+	if r.Frames == 0 {
+		r.From = ts
+	}
+	r.To = ts
+	r.Frames++
+}
+
+func (r *Report) addOpportunity(mostProfit *runner.MostProfit) {
+	r.Opportunities[mostProfit.Combination.Name()]++
+}
+
+func (r *Report) addEpisode(episode *runner.Episode) {
+	name := episode.Combination.Name()
+	r.durations[name] = append(r.durations[name], episode.Duration())
+	summary, ok := r.Episodes[name]
+	if !ok {
+		summary = &EpisodeSummary{}
+		r.Episodes[name] = summary
+	}
+	if episode.PeakProfit.GreaterThan(summary.PeakProfit) {
+		summary.PeakProfit = episode.PeakProfit
+	}
+}
+
+func (r *Report) addFill(fill *Fill) {
+	r.Fills = append(r.Fills, fill)
+	if fill.Pnl.IsPositive() {
+		r.Wins++
+	}
+	r.Notional = r.Notional.Add(fill.Notional)
+	r.Pnl = r.Pnl.Add(fill.Pnl)
+}
+
+func (r *Report) finish() {
+	for name, durations := range r.durations {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		summary := r.Episodes[name]
+		summary.Count = int64(len(durations))
+		summary.MinMs = durations[0].Milliseconds()
+		summary.MedianMs = durations[len(durations)/2].Milliseconds()
+		summary.P90Ms = durations[len(durations)*9/10].Milliseconds()
+		summary.MaxMs = durations[len(durations)-1].Milliseconds()
+		for _, d := range durations {
+			summary.TotalMs += d.Milliseconds()
+		}
+	}
+}
+
+func (r *Report) Print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "period\t%s - %s (%v)\n", r.From.UTC().Format(time.RFC3339), r.To.UTC().Format(time.RFC3339), r.To.Sub(r.From).Round(time.Second))
+	fmt.Fprintf(w, "params\tfee: %s  threshold: %s  latency: %v  slippage: %s bps\n", r.Params.Fee, r.Params.Threshold, r.Params.Latency, r.Params.SlippageBps)
+	fmt.Fprintf(w, "frames\t%d\n", r.Frames)
+	fmt.Fprintf(w, "evaluations\t%d\n\n", r.Evaluations)
+
+	var names []string
+	for name := range r.Opportunities {
+		names = append(names, name)
+	}
+	for name := range r.Episodes {
+		if _, ok := r.Opportunities[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	fmt.Fprintln(w, "combination\topportunities\tepisodes\tmin ms\tmedian ms\tp90 ms\tmax ms\ttotal ms\tpeak profit")
+	for _, name := range names {
+		s, ok := r.Episodes[name]
+		if !ok {
+			s = &EpisodeSummary{}
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", name, r.Opportunities[name], s.Count, s.MinMs, s.MedianMs, s.P90Ms, s.MaxMs, s.TotalMs, s.PeakProfit.StringFixed(5))
+	}
+
+	fmt.Fprintf(w, "\nsimulated fills\t%d\n", len(r.Fills))
+	fmt.Fprintf(w, "wins\t%d\n", r.Wins)
+	fmt.Fprintf(w, "notional\t%s\n", r.Notional.StringFixed(2))
+	fmt.Fprintf(w, "pnl\t%s\n", r.Pnl.StringFixed(4))
+}
@@ -20,7 +20,7 @@ const (
 	RECV_WINDOW_MILLISECOND = "3000"
 )
 
-func (api *Api) post(endpoint string, params map[string]any) (body []byte, err error) {
+func (api *Api) post(endpoint string, params any) (body []byte, err error) {
 	// timestamp
 	ts := time.Now().UnixNano() / int64(time.Millisecond)
 
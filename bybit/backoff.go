@@ -0,0 +1,33 @@
+package bybit
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	RECONNECT_BASE_MILLISECOND = 1000
+	RECONNECT_MAX_SECOND       = 60
+	RECONNECT_STABLE_SECOND    = 60 // the backoff is reset if the connection lasted for it
+)
+
+// backoff doubles the delay on each attempt up to max, the delay is randomized between half and full to spread reconnects
+type backoff struct {
+	base    time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func (b *backoff) next() time.Duration {
+	d := b.base << b.attempt
+	if d <= 0 || d > b.max {
+		d = b.max
+	} else {
+		b.attempt++
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,266 @@
+package bybit
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	MAX_TOPICS_PER_CONN  = 10 // bybit only accepts up to 10 symbols per connection
+	MAX_ARGS_PER_REQUEST = 10 // args of a subscribe/unsubscribe request
+)
+
+// ConnManager owns the assignment of public topics to connections, topics can be added or removed while running
+type ConnManager struct {
+	ws                *Ws
+	MaxTopicsPerConn  int
+	MaxArgsPerRequest int
+
+	mu      sync.Mutex
+	groups  []*publicGroup
+	nextNum int
+}
+
+// publicGroup is a chunk of topics, replicas of the group subscribe the same topics
+type publicGroup struct {
+	Num      int
+	mu       sync.Mutex
+	topics   []string
+	replicas []*publicConn
+	stopped  chan struct{} // closed once the group has no topics
+}
+
+// Assignment is the topics of a group of connections, it's exposed by the status API
+type Assignment struct {
+	Group       int      `json:"group"`
+	Connections []string `json:"connections"`
+	Topics      []string `json:"topics"`
+	// Topics of symbols outside the combinations file, they are recorded but not evaluated until the symbols are added to it and restarted
+	NotEvaluated []string `json:"not_evaluated,omitempty"`
+}
+
+func newConnManager(ws *Ws) *ConnManager {
+	cm := &ConnManager{
+		ws:                ws,
+		MaxTopicsPerConn:  MAX_TOPICS_PER_CONN,
+		MaxArgsPerRequest: MAX_ARGS_PER_REQUEST,
+		nextNum:           1,
+	}
+	if viper.IsSet("WS_MAX_TOPICS_PER_CONN") {
+		cm.MaxTopicsPerConn = viper.GetInt("WS_MAX_TOPICS_PER_CONN")
+	}
+	if viper.IsSet("WS_MAX_ARGS_PER_REQUEST") {
+		cm.MaxArgsPerRequest = viper.GetInt("WS_MAX_ARGS_PER_REQUEST")
+	}
+	if cm.MaxTopicsPerConn < 1 || cm.MaxArgsPerRequest < 1 {
+		log.Fatalf("WS_MAX_TOPICS_PER_CONN and WS_MAX_ARGS_PER_REQUEST have to be at least 1")
+	}
+	return cm
+}
+
+func (g *publicGroup) Topics() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.topics...)
+}
+
+func (g *publicGroup) setTopics(topics []string) {
+	g.mu.Lock()
+	g.topics = topics
+	g.mu.Unlock()
+	// Live connections subscribe or unsubscribe the difference
+	for _, pc := range g.replicas {
+		select {
+		case pc.sync <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// AddTopics subscribes new topics, groups with room are filled first, then new groups of connections are opened
+func (cm *ConnManager) AddTopics(topics []string) error {
+	for _, topic := range topics {
+		if !cm.ws.OrderbookTopicReg.MatchString(topic) {
+			return fmt.Errorf("topic '%s' isn't an orderbook topic", topic)
+		}
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	assigned := cm.assigned()
+	var pending []string
+	for _, topic := range topics {
+		if _, ok := assigned[topic]; !ok && !contains(pending, topic) {
+			pending = append(pending, topic)
+		}
+	}
+	for _, g := range cm.groups {
+		if len(pending) == 0 {
+			break
+		}
+		current := g.Topics()
+		room := cm.MaxTopicsPerConn - len(current)
+		if room <= 0 {
+			continue
+		}
+		if room > len(pending) {
+			room = len(pending)
+		}
+		g.setTopics(append(current, pending[:room]...))
+		pending = pending[room:]
+	}
+	for len(pending) > 0 {
+		n := cm.MaxTopicsPerConn
+		if n > len(pending) {
+			n = len(pending)
+		}
+		cm.startGroup(append([]string(nil), pending[:n]...))
+		pending = pending[n:]
+	}
+	return nil
+}
+
+// RemoveTopics unsubscribes topics, their orderbooks become stale and groups without topics are closed
+func (cm *ConnManager) RemoveTopics(topics []string) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for _, g := range cm.groups {
+		current := g.Topics()
+		var kept []string
+		for _, topic := range current {
+			if !contains(topics, topic) {
+				kept = append(kept, topic)
+			}
+		}
+		if len(kept) != len(current) {
+			g.setTopics(kept)
+		}
+	}
+	cm.ws.setStale(topics)
+	cm.closeEmptyGroups()
+}
+
+// Rebalance moves topics of the least filled groups into groups with room, so that the fewest connections are used.
+// The old group is closed right away while the new group subscribes in the background,
+// so the moved orderbooks may miss updates until the new group's snapshot arrives.
+// Duplicates are merged by seq.
+func (cm *ConnManager) Rebalance() {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	for {
+		sort.Slice(cm.groups, func(i, j int) bool { return len(cm.groups[i].Topics()) > len(cm.groups[j].Topics()) })
+		total := 0
+		for _, g := range cm.groups {
+			total += len(g.Topics())
+		}
+		needed := (total + cm.MaxTopicsPerConn - 1) / cm.MaxTopicsPerConn
+		if len(cm.groups) <= needed || len(cm.groups) < 2 {
+			break
+		}
+		// Move topics of the smallest group to the fullest groups with room
+		smallest := cm.groups[len(cm.groups)-1]
+		moving := smallest.Topics()
+		for _, g := range cm.groups[:len(cm.groups)-1] {
+			current := g.Topics()
+			room := cm.MaxTopicsPerConn - len(current)
+			if room <= 0 || len(moving) == 0 {
+				continue
+			}
+			if room > len(moving) {
+				room = len(moving)
+			}
+			g.setTopics(append(current, moving[:room]...))
+			moving = moving[room:]
+		}
+		smallest.setTopics(moving)
+		cm.closeEmptyGroups()
+	}
+	sort.Slice(cm.groups, func(i, j int) bool { return cm.groups[i].Num < cm.groups[j].Num })
+}
+
+// Assignments returns topics of each group, sorted by the group number
+func (cm *ConnManager) Assignments() []Assignment {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	assignments := make([]Assignment, 0, len(cm.groups))
+	for _, g := range cm.groups {
+		a := Assignment{Group: g.Num, Topics: g.Topics()}
+		for _, topic := range a.Topics {
+			if _, ok := cm.ws.Tri.SymbolCombinationsMap[topicSymbol(topic)]; !ok {
+				a.NotEvaluated = append(a.NotEvaluated, topic)
+			}
+		}
+		for _, pc := range g.replicas {
+			a.Connections = append(a.Connections, pc.Name)
+		}
+		assignments = append(assignments, a)
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].Group < assignments[j].Group })
+	return assignments
+}
+
+func (cm *ConnManager) assigned() map[string]*publicGroup {
+	assigned := make(map[string]*publicGroup)
+	for _, g := range cm.groups {
+		for _, topic := range g.Topics() {
+			assigned[topic] = g
+		}
+	}
+	return assigned
+}
+
+func (cm *ConnManager) startGroup(topics []string) {
+	replicas := cm.ws.PublicReplicas
+	g := &publicGroup{Num: cm.nextNum, topics: topics, stopped: make(chan struct{})}
+	cm.nextNum++
+	for replica := 1; replica <= replicas; replica++ {
+		g.replicas = append(g.replicas, &publicConn{
+			Id:    (g.Num-1)*replicas + replica,
+			Name:  publicConnName(g.Num, replica, replicas),
+			Group: g,
+			sync:  make(chan struct{}, 1),
+		})
+	}
+	cm.groups = append(cm.groups, g)
+	for _, pc := range g.replicas {
+		go cm.ws.listenOrderbooksWithRetry(pc)
+	}
+}
+
+func (cm *ConnManager) closeEmptyGroups() {
+	var groups []*publicGroup
+	for _, g := range cm.groups {
+		if len(g.Topics()) == 0 {
+			close(g.stopped)
+			continue
+		}
+		groups = append(groups, g)
+	}
+	cm.groups = groups
+}
+
+// subscriptionRequests splits the op into requests under the args limit
+func (cm *ConnManager) subscriptionRequests(op string, topics []string) []MessageReq {
+	var reqs []MessageReq
+	for i := 0; i < len(topics); i += cm.MaxArgsPerRequest {
+		end := i + cm.MaxArgsPerRequest
+		if end > len(topics) {
+			end = len(topics)
+		}
+		reqs = append(reqs, MessageReq{Op: op, Args: topics[i:end]})
+	}
+	return reqs
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,254 @@
+package bybit
+
+import (
+	"crypto-triangular-arbitrage-watch/metrics"
+	"crypto-triangular-arbitrage-watch/notification"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	CONN_PRIVATE = "private"
+
+	HEALTH_CONNECTED = "connected"
+	HEALTH_DEGRADED  = "degraded" // connected, but no message for a while or it's flapping
+	HEALTH_DOWN      = "down"
+
+	DEGRADED_NO_MESSAGE_SECOND        = 30
+	DEGRADED_RECONNECTS               = 3
+	DEGRADED_RECONNECTS_WINDOW_MINUTE = 10
+)
+
+// ConnState is the state of a websocket connection, it's exposed by the status API
+type ConnState struct {
+	Name          string    `json:"name"` // public-<n> or private
+	Topics        []string  `json:"topics"`
+	Connected     bool      `json:"connected"`
+	Health        string    `json:"health"`
+	HealthSince   time.Time `json:"health_since"` // time in the state = now - health_since
+	ConnectedAt   time.Time `json:"connected_at"`
+	DisconnectAt  time.Time `json:"disconnected_at"`
+	DownSince     time.Time `json:"down_since"` // the first disconnection since it was connected, zero if it's connected
+	LastMessageAt time.Time `json:"last_message_at"`
+	Messages      int64     `json:"messages"`
+	Reconnects    int64     `json:"reconnects"`     // the connection is always retried after it's down
+	Attempts      int64     `json:"attempts"`       // failed attempts since it was connected
+	Updates       int64     `json:"updates"`        // orderbook updates, including duplicates of redundant connections
+	FirstArrivals int64     `json:"first_arrivals"` // orderbook updates which arrived here first
+	LagMs         float64   `json:"lag_ms"`         // average time behind the first arrival of duplicates
+	NextRetryAt   time.Time `json:"next_retry_at"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+type connStates struct {
+	mu          sync.Mutex
+	states      map[string]*ConnState
+	reconnectAt map[string][]time.Time   // within DEGRADED_RECONNECTS_WINDOW_MINUTE
+	lags        map[string]time.Duration // sum of lags of duplicates
+	duplicates  map[string]int64
+}
+
+// publicConnName is public-<chunk>, or public-<chunk>-<replica> if there are redundant connections
+func publicConnName(connNum int, replica int, replicas int) string {
+	if replicas <= 1 {
+		return fmt.Sprintf("public-%d", connNum)
+	}
+	return fmt.Sprintf("public-%d-%d", connNum, replica)
+}
+
+func (cs *connStates) get(name string) *ConnState {
+	if cs.states == nil {
+		cs.states = make(map[string]*ConnState)
+		cs.reconnectAt = make(map[string][]time.Time)
+		cs.lags = make(map[string]time.Duration)
+		cs.duplicates = make(map[string]int64)
+	}
+	state, ok := cs.states[name]
+	if !ok {
+		state = &ConnState{Name: name}
+		cs.states[name] = state
+	}
+	return state
+}
+
+// connected returns failed attempts and how long it was down, they are zero if it wasn't down
+func (cs *connStates) connected(name string, topics []string) (int64, time.Duration) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	state := cs.get(name)
+	attempts := state.Attempts
+	var downFor time.Duration
+	if !state.DownSince.IsZero() {
+		downFor = time.Since(state.DownSince)
+	}
+	state.Topics = topics
+	state.Connected = true
+	state.ConnectedAt = time.Now()
+	state.DownSince = time.Time{}
+	state.Attempts = 0
+	state.NextRetryAt = time.Time{}
+	state.LastError = ""
+	cs.updateHealth(state, state.ConnectedAt)
+	return attempts, downFor
+}
+
+// disconnected returns true if it was connected, so only the first failure of an outage is announced
+func (cs *connStates) disconnected(name string, err error) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	now := time.Now()
+	state := cs.get(name)
+	wasConnected := state.Connected
+	state.Reconnects++
+	state.Attempts++
+	if state.Connected || state.DownSince.IsZero() {
+		state.DownSince = now
+	}
+	state.Connected = false
+	state.DisconnectAt = now
+	if err != nil {
+		state.LastError = err.Error()
+	}
+	cs.reconnectAt[name] = append(cs.reconnectAt[name], now)
+	cs.updateHealth(state, now)
+	return wasConnected
+}
+
+func (cs *connStates) retrying(name string, at time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.get(name).NextRetryAt = at
+}
+
+// merged records the result of OrderbookMerge
+func (cs *connStates) merged(name string, first bool, lag time.Duration) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	state := cs.get(name)
+	state.Updates++
+	if first {
+		state.FirstArrivals++
+		return
+	}
+	if lag >= 0 {
+		cs.lags[name] += lag
+		cs.duplicates[name]++
+		state.LagMs = float64(cs.lags[name]) / float64(cs.duplicates[name]) / float64(time.Millisecond)
+	}
+}
+
+func (cs *connStates) subscribed(name string, topics []string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.get(name).Topics = topics
+}
+
+// remove is called once a connection is closed for good
+func (cs *connStates) remove(name string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.states, name)
+	delete(cs.reconnectAt, name)
+	delete(cs.lags, name)
+	delete(cs.duplicates, name)
+}
+
+// anyConnected tells whether a replica is still connected
+func (cs *connStates) anyConnected(names []string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, name := range names {
+		if state, ok := cs.states[name]; ok && state.Connected {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *connStates) received(name string, at time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	state := cs.get(name)
+	state.LastMessageAt = at
+	state.Messages++
+}
+
+// updateHealth moves the state to the current health, HealthSince only changes when the health changes
+func (cs *connStates) updateHealth(state *ConnState, now time.Time) {
+	window := time.Duration(DEGRADED_RECONNECTS_WINDOW_MINUTE) * time.Minute
+	var recent []time.Time
+	for _, t := range cs.reconnectAt[state.Name] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	cs.reconnectAt[state.Name] = recent
+
+	health := HEALTH_CONNECTED
+	lastMessageAt := state.LastMessageAt
+	if lastMessageAt.Before(state.ConnectedAt) {
+		lastMessageAt = state.ConnectedAt
+	}
+	switch {
+	case !state.Connected:
+		health = HEALTH_DOWN
+	case len(recent) >= DEGRADED_RECONNECTS, now.Sub(lastMessageAt) >= time.Duration(DEGRADED_NO_MESSAGE_SECOND)*time.Second:
+		health = HEALTH_DEGRADED
+	}
+	if health != state.Health {
+		state.Health = health
+		state.HealthSince = now
+	}
+}
+
+func (cs *connStates) snapshot() []ConnState {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	now := time.Now()
+	states := make([]ConnState, 0, len(cs.states))
+	for _, state := range cs.states {
+		cs.updateHealth(state, now)
+		s := *state
+		s.Topics = append([]string(nil), state.Topics...)
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// waitReconnect records the failure and sleeps with the backoff, only the first failure of an outage is sent to the notifier
+func (ws *Ws) waitReconnect(name string, b *backoff, startedAt time.Time, err error) {
+	if time.Since(startedAt) >= time.Duration(RECONNECT_STABLE_SECOND)*time.Second {
+		b.reset()
+	}
+	first := ws.conns.disconnected(name, err)
+	metrics.Reconnects.Inc(name)
+	delay := b.next()
+	ws.conns.retrying(name, time.Now().Add(delay))
+
+	msg := fmt.Sprintf("Connection %s is down, reconnecting in %v, err: %v", name, delay.Round(time.Millisecond), err)
+	if first {
+		ws.Notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_WARNING, msg)
+	} else {
+		log.Println(msg)
+	}
+	time.Sleep(delay)
+}
+
+// announceConnected sends the recovery if it was down, otherwise it's a normal start
+func (ws *Ws) announceConnected(name string, topics []string, listening string) {
+	attempts, downFor := ws.conns.connected(name, topics)
+	if attempts == 0 {
+		ws.Notifier.SystemLogs(listening)
+		return
+	}
+	ws.Notifier.SystemLogs(fmt.Sprintf("Connection %s recovered after %d attempts, it was down for %v", name, attempts, downFor.Round(time.Second)))
+}
+
+// ConnStates returns states of all public and private connections
+func (ws *Ws) ConnStates() []ConnState {
+	return ws.conns.snapshot()
+}
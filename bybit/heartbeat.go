@@ -0,0 +1,95 @@
+package bybit
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Bybit recommends client to send the ping heartbeat packet every 20 seconds to maintain the WebSocket connection.
+	// Otherwise, established connection will close after 5 minutes.
+	PING_INTERVAL_SECOND   = 20
+	PONG_TIMEOUT_SECOND    = 10
+	READ_TIMEOUT_SECOND    = 60 // pongs arrive every 20 seconds on a healthy connection
+	NO_DATA_TIMEOUT_SECOND = 120
+	HEARTBEAT_CHECK_SECOND = 1
+)
+
+// heartbeat detects half-open connections, a ping without the pong or an active topic without data forces a reconnect.
+// It's only used by the goroutine of the connection.
+type heartbeat struct {
+	pongTimeout   time.Duration
+	noDataTimeout time.Duration // 0 disables the watchdog
+	pingAt        time.Time     // waiting for the pong if it isn't zero
+	topicAt       map[string]time.Time
+}
+
+func newHeartbeat(pongTimeout time.Duration, noDataTimeout time.Duration) *heartbeat {
+	return &heartbeat{pongTimeout: pongTimeout, noDataTimeout: noDataTimeout, topicAt: make(map[string]time.Time)}
+}
+
+func (h *heartbeat) pinged(at time.Time) {
+	if h.pingAt.IsZero() {
+		h.pingAt = at
+	}
+}
+
+// received is called after the message is handled, the public channel replies `op: ping`, the private channel replies `op: pong`
+func (h *heartbeat) received(message *Message) {
+	switch {
+	case message.Op == "ping" || message.Op == "pong":
+		h.pingAt = time.Time{}
+	case message.Topic != "":
+		h.topicAt[message.Topic] = message.ReadAt
+	}
+}
+
+// forget is called once the topic is unsubscribed
+func (h *heartbeat) forget(topic string) {
+	delete(h.topicAt, topic)
+}
+
+// check returns an error if the connection has to be reconnected, topics are active once they have data
+func (h *heartbeat) check(now time.Time) error {
+	if !h.pingAt.IsZero() && now.Sub(h.pingAt) >= h.pongTimeout {
+		return fmt.Errorf("no pong within %v", h.pongTimeout)
+	}
+	if h.noDataTimeout <= 0 {
+		return nil
+	}
+	for topic, at := range h.topicAt {
+		if now.Sub(at) >= h.noDataTimeout {
+			return fmt.Errorf("no data of '%s' for %v", topic, now.Sub(at).Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// readMessages reads frames in another goroutine, so that `conn.ReadMessage()` won't block pings if there is no update.
+// Each read has a deadline, the goroutine exits once done is closed.
+func (ws *Ws) readMessages(conn *websocket.Conn, done <-chan struct{}, onRead func(data []byte, readAt time.Time)) (<-chan *Message, <-chan error) {
+	msgChan := make(chan *Message)
+	errChan := make(chan error, 1)
+	go func() {
+		for {
+			if ws.ReadTimeout > 0 {
+				conn.SetReadDeadline(time.Now().Add(ws.ReadTimeout))
+			}
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				errChan <- fmt.Errorf("failed to read message during running, err: %v", err)
+				return
+			}
+			readAt := time.Now()
+			onRead(data, readAt)
+			select {
+			case msgChan <- &Message{Data: data, ReadAt: readAt}:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return msgChan, errChan
+}
@@ -0,0 +1,58 @@
+package bybit
+
+import (
+	"crypto-triangular-arbitrage-watch/runner"
+	"sync"
+	"time"
+)
+
+// OrderbookMerge keeps the first arrival of each orderbook update among redundant connections, updates are ordered by seq then update id
+type OrderbookMerge struct {
+	mu   sync.Mutex
+	last map[string]mergedUpdate // symbol -> the latest accepted update
+}
+
+type mergedUpdate struct {
+	seq      int64
+	updateId int64
+	readAt   time.Time
+}
+
+// Accept returns true for the first arrival, otherwise it returns how long the duplicate is behind the first arrival.
+// The lag is negative for an outdated update.
+func (m *OrderbookMerge) Accept(data *runner.OrderbookData, readAt time.Time) (bool, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.last == nil {
+		m.last = make(map[string]mergedUpdate)
+	}
+	last, ok := m.last[data.Symbol]
+	if !ok || data.Seq > last.seq || (data.Seq == last.seq && data.UpdateId > last.updateId) || restarted(last, data) {
+		m.last[data.Symbol] = mergedUpdate{seq: data.Seq, updateId: data.UpdateId, readAt: readAt}
+		return true, 0
+	}
+	if data.Seq == last.seq && data.UpdateId == last.updateId {
+		return false, readAt.Sub(last.readAt)
+	}
+	return false, -1
+}
+
+// restarted is true for the snapshot after Bybit restarts the service, u is 1 and seq starts over,
+// otherwise all updates would be dropped as outdated until seq catches up
+func restarted(last mergedUpdate, data *runner.OrderbookData) bool {
+	if data.Seq == last.seq && data.UpdateId == last.updateId {
+		// A duplicate of the snapshot from a redundant connection
+		return false
+	}
+	return data.UpdateId == 1 || data.Seq < last.seq/2
+}
+
+// Reset forgets the latest updates of the symbols e.g. all their connections are down,
+// the first snapshot after reconnecting is accepted whatever its seq is
+func (m *OrderbookMerge) Reset(symbols []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, symbol := range symbols {
+		delete(m.last, symbol)
+	}
+}
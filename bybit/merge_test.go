@@ -0,0 +1,62 @@
+package bybit
+
+import (
+	"crypto-triangular-arbitrage-watch/runner"
+	"testing"
+	"time"
+)
+
+func TestOrderbookMergeAccept(t *testing.T) {
+	var m OrderbookMerge
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	update := func(seq, u int64) *runner.OrderbookData {
+		return &runner.OrderbookData{Symbol: "BTCUSDT", Seq: seq, UpdateId: u}
+	}
+
+	if first, _ := m.Accept(update(100, 10), at); !first {
+		t.Fatal("the first update should be accepted")
+	}
+	if first, lag := m.Accept(update(100, 10), at.Add(5*time.Millisecond)); first || lag != 5*time.Millisecond {
+		t.Fatalf("duplicate = %v, %v, want false, 5ms", first, lag)
+	}
+	if first, lag := m.Accept(update(99, 9), at); first || lag != -1 {
+		t.Fatalf("outdated = %v, %v, want false, -1", first, lag)
+	}
+	if first, _ := m.Accept(update(100, 11), at); !first {
+		t.Fatal("a greater u of the same seq should be accepted")
+	}
+
+	// Bybit restarts the service, the snapshot comes with u=1 and seq starts over
+	if first, _ := m.Accept(update(5, 1), at); !first {
+		t.Fatal("the restart snapshot should be accepted")
+	}
+	if first, _ := m.Accept(update(5, 1), at); first {
+		t.Fatal("a duplicate of the restart snapshot should be dropped")
+	}
+	if first, _ := m.Accept(update(6, 2), at); !first {
+		t.Fatal("updates after the restart snapshot should be accepted")
+	}
+}
+
+func TestOrderbookMergeSeqDrop(t *testing.T) {
+	var m OrderbookMerge
+	at := time.Now()
+	m.Accept(&runner.OrderbookData{Symbol: "BTCUSDT", Seq: 1000, UpdateId: 500}, at)
+	if first, _ := m.Accept(&runner.OrderbookData{Symbol: "BTCUSDT", Seq: 10, UpdateId: 3}, at); !first {
+		t.Fatal("a large seq drop should start over")
+	}
+}
+
+func TestOrderbookMergeReset(t *testing.T) {
+	var m OrderbookMerge
+	at := time.Now()
+	m.Accept(&runner.OrderbookData{Symbol: "BTCUSDT", Seq: 1000, UpdateId: 500}, at)
+	m.Accept(&runner.OrderbookData{Symbol: "ETHUSDT", Seq: 1000, UpdateId: 500}, at)
+	m.Reset([]string{"BTCUSDT"})
+	if first, _ := m.Accept(&runner.OrderbookData{Symbol: "BTCUSDT", Seq: 900, UpdateId: 400}, at); !first {
+		t.Fatal("the first update after a reset should be accepted")
+	}
+	if first, _ := m.Accept(&runner.OrderbookData{Symbol: "ETHUSDT", Seq: 900, UpdateId: 400}, at); first {
+		t.Fatal("other symbols shouldn't be reset")
+	}
+}
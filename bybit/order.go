@@ -1,11 +1,15 @@
 package bybit
 
 import (
+	"crypto-triangular-arbitrage-watch/journal"
+	"crypto-triangular-arbitrage-watch/metrics"
+	"crypto-triangular-arbitrage-watch/risk"
 	"crypto-triangular-arbitrage-watch/trade"
 	"crypto-triangular-arbitrage-watch/tri"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -15,15 +19,72 @@ import (
 )
 
 const (
-	TIMEOUT_SECOND         = 3
-	ORDER_ENDPOINT         = "/v5/order/create"
-	INSTRUMENT_ENDPOINT    = "/v5/market/instruments-info"
-	ORDER_HISTORY_ENDPOINT = "/v5/order/history"
+	TIMEOUT_SECOND          = 3
+	ORDER_ENDPOINT          = "/v5/order/create"
+	CANCEL_ENDPOINT         = "/v5/order/cancel"
+	INSTRUMENT_ENDPOINT     = "/v5/market/instruments-info"
+	ORDER_HISTORY_ENDPOINT  = "/v5/order/history"
+	ORDER_REALTIME_ENDPOINT = "/v5/order/realtime"
+	SERVER_TIME_ENDPOINT    = "/v5/market/time"
+	WALLET_ENDPOINT         = "/v5/account/wallet-balance"
+	ACCOUNT_TYPE_UNIFIED    = "UNIFIED"
 )
 
+// retCodes of an orderLinkId which is already used, spot and unified accounts
+var duplicateOrderLinkIdRetCodes = []int{170141, 110072}
+
 type Api struct {
-	Client *http.Client
-	Tri    *tri.Tri
+	Client      *http.Client
+	Tri         *tri.Tri
+	Risk        *risk.Risk
+	KillSwitch  *risk.KillSwitch
+	Inventory   *trade.Inventory
+	Fills       *trade.Fills // legs wait for their fills, nil if nothing waits e.g. the monitor
+	Journal     *journal.Journal
+	OrderSender OrderSender // orders go through REST if it's nil
+}
+
+// OrderSender sends orders over the trade websocket, REST is the fallback if it returns ErrTradeWsDown
+type OrderSender interface {
+	SendOrder(op string, req any) (*OrderResp, error)
+}
+
+// OrderRequest is the body of REST /v5/order/create and the args of websocket order.create
+type OrderRequest struct {
+	Category    string `json:"category"`
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	OrderType   string `json:"orderType"`
+	Qty         string `json:"qty"`
+	Price       string `json:"price,omitempty"`       // limit orders only
+	TimeInForce string `json:"timeInForce,omitempty"` // limit orders only
+	OrderLinkId string `json:"orderLinkId"`
+}
+
+// limitOrder is the price and time in force of a limit order
+type limitOrder struct {
+	Price       decimal.Decimal
+	TimeInForce string
+}
+
+// CancelRequest is the body of REST /v5/order/cancel and the args of websocket order.cancel, one of the ids is required
+type CancelRequest struct {
+	Category    string `json:"category"`
+	Symbol      string `json:"symbol"`
+	OrderId     string `json:"orderId,omitempty"`
+	OrderLinkId string `json:"orderLinkId,omitempty"`
+}
+
+// OrderResp is the response of creating or cancelling an order, `data` of the websocket response is Result
+type OrderResp struct {
+	RetCode int         `json:"retCode"`
+	RetMsg  string      `json:"retMsg"`
+	Result  OrderResult `json:"result"`
+}
+
+type OrderResult struct {
+	OrderId     string `json:"orderId"`
+	OrderLinkId string `json:"orderLinkId"`
 }
 
 // resp:
@@ -76,6 +137,9 @@ type InstrumentResp struct {
 				MinOrderAmt    string `json:"minOrderAmt"`
 				MaxOrderAmt    string `json:"maxOrderAmt"`
 			} `json:"lotSizeFilter"`
+			PriceFilter struct {
+				TickSize string `json:"tickSize"`
+			} `json:"priceFilter"`
 		} `json:"list"`
 	} `json:"result"`
 	RetExtInfo map[string]any `json:"retExtInfo"`
@@ -92,6 +156,31 @@ func (api *Api) SetTri(tri *tri.Tri) {
 	api.Tri = tri
 }
 
+func (api *Api) SetRisk(risk *risk.Risk) {
+	api.Risk = risk
+}
+
+func (api *Api) SetKillSwitch(ks *risk.KillSwitch) {
+	api.KillSwitch = ks
+}
+
+func (api *Api) SetInventory(inventory *trade.Inventory) {
+	api.Inventory = inventory
+}
+
+// SetFills registers a waiter of every leg, Fills.Wait returns the filled qty of the orderLinkId of the response
+func (api *Api) SetFills(fills *trade.Fills) {
+	api.Fills = fills
+}
+
+func (api *Api) SetJournal(j *journal.Journal) {
+	api.Journal = j
+}
+
+func (api *Api) SetOrderSender(sender OrderSender) {
+	api.OrderSender = sender
+}
+
 // For Spot Market Buy order, please note that qty should be quote curreny amount, and make sure it satisfies quotePrecision in Spot instrument spec
 // https://bybit-exchange.github.io/docs/v5/market/instrument#response-parameters
 // for example:
@@ -114,45 +203,326 @@ func (api *Api) SetTri(tri *tri.Tri) {
 //			"retExtInfo": {},
 //			"time": 1699717992439
 //	}
-func (api *Api) PlaceOrder(side string, symbol string, qty decimal.Decimal) (resp map[string]any, err error) {
+func (api *Api) PlaceOrder(side string, symbol string, qty decimal.Decimal) (resp *OrderResp, err error) {
+	return api.placeOrder(side, symbol, qty, nil, true)
+}
+
+// PlaceLimitOrder places a limit order with GTC, IOC, FOK or PostOnly. qty is the coin spent like PlaceOrder: quote coin to buy, base coin to sell.
+// The price is rounded to tickSize, down to buy and up to sell, so it's never worse than the given price.
+func (api *Api) PlaceLimitOrder(side string, symbol string, qty decimal.Decimal, price decimal.Decimal, timeInForce string) (resp *OrderResp, err error) {
+	if !trade.ValidTimeInForce(timeInForce) {
+		return nil, fmt.Errorf("time in force '%s' not supported", timeInForce)
+	}
+	return api.placeOrder(side, symbol, qty, &limitOrder{Price: price, TimeInForce: timeInForce}, true)
+}
+
+// limit is nil for market orders, checkRisk is only false when unwinding, the kill switch has been triggered at that moment
+func (api *Api) placeOrder(side string, symbol string, qty decimal.Decimal, limit *limitOrder, checkRisk bool) (resp *OrderResp, err error) {
 	if side != trade.SIDE_BUY && side != trade.SIDE_SELL {
 		err = errors.New(side + " not supported")
 		return
 	}
+	defer func() {
+		if err != nil {
+			metrics.Orders.Inc(metrics.ORDER_REJECTED)
+			return
+		}
+		metrics.Orders.Inc(metrics.ORDER_PLACED)
+	}()
 
 	// Convert qty to valid amount with precision (bybit's requirement)
 	instrument, ok := api.Tri.SymbolInstrumentMap[symbol]
 	if !ok {
 		return resp, fmt.Errorf("instrument '%s' doesn't exist", symbol)
 	}
-	var precisionQty decimal.Decimal
-	switch side {
-	case trade.SIDE_BUY:
+	// qty of limit orders is always in base coin, spentQty is what the order spends
+	var precisionQty, spentQty, price decimal.Decimal
+	switch {
+	case limit != nil:
+		if price, err = priceWithTick(limit.Price, instrument.TickSize, side); err != nil {
+			return resp, fmt.Errorf("failed to round the price of '%s', err: %v", symbol, err)
+		}
+		if side == trade.SIDE_BUY {
+			precisionQty, err = qtyWithPrecision(qty.Div(price), instrument.BasePrecision)
+			spentQty = precisionQty.Mul(price)
+		} else {
+			precisionQty, err = qtyWithPrecision(qty, instrument.BasePrecision)
+			spentQty = precisionQty
+		}
+	case side == trade.SIDE_BUY:
 		precisionQty, err = qtyWithPrecision(qty, instrument.QuotePrecision)
-	case trade.SIDE_SELL:
+		spentQty = precisionQty
+	case side == trade.SIDE_SELL:
 		precisionQty, err = qtyWithPrecision(qty, instrument.BasePrecision)
+		spentQty = precisionQty
 	}
 	if err != nil {
 		return
 	}
-	params := map[string]any{
-		"category":  trade.CATEGORY_SPOT,
-		"symbol":    symbol,
-		"orderType": trade.ORDER_TYPE_MARKET,
-		"side":      side,
-		"qty":       precisionQty.String(),
+
+	// Pre-trade risk checks, the error is *risk.RejectError if it's rejected
+	if checkRisk && api.Risk != nil {
+		if err = api.Risk.CheckOrder(side, symbol, spentQty); err != nil {
+			return
+		}
+	}
+
+	// Reserve the coin which will be spent until the order is done
+	orderLinkId := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if checkRisk && api.Inventory != nil {
+		spent := instrument.QuoteCoin
+		if side == trade.SIDE_SELL {
+			spent = instrument.BaseCoin
+		}
+		if err = api.Inventory.Reserve(orderLinkId, spent, spentQty); err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				api.Inventory.Release(orderLinkId)
+			}
+		}()
+	}
+	// Unwound orders aren't waited for
+	if checkRisk && api.Fills != nil {
+		api.Fills.Expect(orderLinkId)
+		defer func() {
+			if err != nil {
+				api.Fills.Forget(orderLinkId)
+			}
+		}()
+	}
+
+	if api.Journal != nil {
+		defer func() {
+			rec := journal.Record{
+				Type:        journal.TYPE_ORDER,
+				Symbol:      symbol,
+				Side:        side,
+				OrderLinkId: orderLinkId,
+				Status:      "Created",
+				Qty:         precisionQty,
+				Price:       price,
+			}
+			if resp != nil {
+				rec.OrderId = resp.Result.OrderId
+			}
+			if err != nil {
+				rec.Status = "Failed"
+				rec.Error = err.Error()
+			}
+			api.Journal.Record(rec)
+		}()
+	}
+
+	req := OrderRequest{
+		Category:    trade.CATEGORY_SPOT,
+		Symbol:      symbol,
+		Side:        side,
+		OrderType:   trade.ORDER_TYPE_MARKET,
+		Qty:         precisionQty.String(),
+		OrderLinkId: orderLinkId,
+	}
+	if limit != nil {
+		req.OrderType = trade.ORDER_TYPE_LIMIT
+		req.Price = price.String()
+		req.TimeInForce = limit.TimeInForce
 	}
-	body, err := api.post(ORDER_ENDPOINT, params)
+	sendAt := time.Now()
+	resp, err = api.send(ORDER_ENDPOINT, "order.create", req)
 	if err != nil {
+		api.recordApiError(err)
 		return
 	}
+	metrics.ObserveOrderAck(orderLinkId, sendAt, time.Now())
 	// resp:
-	//	- map[result:map[] retCode:10001 retExtInfo:map[] retMsg:The order remains unchanged as the parameters entered match the existing ones. time:1.700282830415e+12]
-	//	- map[result:map[orderId:1556479670277641728 orderLinkId:1556479670277641729] retCode:0 retExtInfo:map[] retMsg:OK time:1.700282835694e+12]
-	err = json.Unmarshal(body, &resp)
+	//	- {RetCode:10001 RetMsg:The order remains unchanged as the parameters entered match the existing ones. Result:{OrderId: OrderLinkId:}}
+	//	- {RetCode:0 RetMsg:OK Result:{OrderId:1556479670277641728 OrderLinkId:1556479670277641729}}
+	if resp.RetCode != 0 {
+		err = fmt.Errorf("retCode: %d, retMsg: %s", resp.RetCode, resp.RetMsg)
+		api.recordApiError(err)
+	}
 	return
 }
 
+// CancelOrder cancels an open order by orderLinkId
+func (api *Api) CancelOrder(symbol string, orderLinkId string) (*OrderResp, error) {
+	req := CancelRequest{
+		Category:    trade.CATEGORY_SPOT,
+		Symbol:      symbol,
+		OrderLinkId: orderLinkId,
+	}
+	resp, err := api.send(CANCEL_ENDPOINT, "order.cancel", req)
+	if err != nil {
+		api.recordApiError(err)
+		return nil, err
+	}
+	if resp.RetCode != 0 {
+		return resp, fmt.Errorf("retCode: %d, retMsg: %s", resp.RetCode, resp.RetMsg)
+	}
+	return resp, nil
+}
+
+// send prefers the trade websocket, the request goes through REST if the websocket is down.
+// If the ack of a new order doesn't come back in time, the order is looked up by orderLinkId before it's resent.
+func (api *Api) send(endpoint string, op string, req any) (*OrderResp, error) {
+	path := metrics.ORDER_PATH_REST
+	if api.OrderSender != nil {
+		resp, err := api.OrderSender.SendOrder(op, req)
+		if err == nil {
+			metrics.OrderRequests.Inc(metrics.ORDER_PATH_WS)
+			return resp, nil
+		}
+		order, isCreate := req.(OrderRequest)
+		switch {
+		case errors.Is(err, ErrTradeWsDown):
+		case errors.Is(err, ErrTradeWsNoAck) && isCreate:
+			// The order may have been created, resending it blindly would fail the live order
+			found, lookupErr := api.lookupOrder(order.Symbol, order.OrderLinkId)
+			if lookupErr != nil {
+				return nil, fmt.Errorf("%w, failed to look up orderLinkId %s, err: %v", err, order.OrderLinkId, lookupErr)
+			}
+			if found != nil {
+				metrics.OrderRequests.Inc(metrics.ORDER_PATH_WS)
+				return found, nil
+			}
+		default:
+			return nil, err
+		}
+		log.Printf("Failed to send %s over the trade websocket, fall back to REST, err: %v", op, err)
+		path = metrics.ORDER_PATH_FALLBACK
+	}
+	metrics.OrderRequests.Inc(path)
+	body, err := api.post(endpoint, req)
+	if err != nil {
+		return nil, err
+	}
+	var resp OrderResp
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if order, ok := req.(OrderRequest); ok && isDuplicateOrderLinkId(resp.RetCode) {
+		// The websocket order was created after all
+		log.Printf("orderLinkId %s already exists, retCode: %d, retMsg: %s", order.OrderLinkId, resp.RetCode, resp.RetMsg)
+		return &OrderResp{RetMsg: resp.RetMsg, Result: OrderResult{OrderLinkId: order.OrderLinkId}}, nil
+	}
+	return &resp, nil
+}
+
+// OrderListResp is the response of /v5/order/realtime and /v5/order/history
+type OrderListResp struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Result  struct {
+		List []struct {
+			OrderId     string `json:"orderId"`
+			OrderLinkId string `json:"orderLinkId"`
+			OrderStatus string `json:"orderStatus"`
+		} `json:"list"`
+	} `json:"result"`
+}
+
+// lookupOrder returns the order of orderLinkId from open and recent orders, or the order history, nil if it isn't created
+func (api *Api) lookupOrder(symbol string, orderLinkId string) (*OrderResp, error) {
+	params := map[string]string{
+		"category":    trade.CATEGORY_SPOT,
+		"symbol":      symbol,
+		"orderLinkId": orderLinkId,
+	}
+	for _, endpoint := range []string{ORDER_REALTIME_ENDPOINT, ORDER_HISTORY_ENDPOINT} {
+		body, err := api.get(endpoint, params)
+		if err != nil {
+			return nil, err
+		}
+		var resp OrderListResp
+		if err = json.Unmarshal(body, &resp); err != nil {
+			return nil, err
+		}
+		if resp.RetCode != 0 {
+			return nil, fmt.Errorf("retCode: %d, retMsg: %s", resp.RetCode, resp.RetMsg)
+		}
+		for _, o := range resp.Result.List {
+			if o.OrderLinkId == orderLinkId {
+				return &OrderResp{RetMsg: "OK", Result: OrderResult{OrderId: o.OrderId, OrderLinkId: o.OrderLinkId}}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func isDuplicateOrderLinkId(retCode int) bool {
+	for _, code := range duplicateOrderLinkIdRetCodes {
+		if retCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (api *Api) recordApiError(err error) {
+	if api.KillSwitch != nil {
+		api.KillSwitch.RecordApiError(err)
+	}
+}
+
+// Unwind sells the balances e.g. Inventory.Frees() back to trade.HOME_COIN, it bypasses the risk checks.
+// Its fills aren't waited for, the private channel drops them.
+func (api *Api) Unwind(balances map[string]decimal.Decimal) {
+	for coin, bal := range balances {
+		if coin == trade.HOME_COIN || !bal.IsPositive() {
+			continue
+		}
+		symbol := coin + trade.HOME_COIN
+		if _, ok := api.Tri.SymbolInstrumentMap[symbol]; !ok {
+			log.Printf("Unwind: '%s' can't be sold, instrument '%s' doesn't exist", coin, symbol)
+			continue
+		}
+		resp, err := api.placeOrder(trade.SIDE_SELL, symbol, bal, nil, false)
+		if err != nil {
+			log.Printf("Unwind: failed to sell %s %s, err: %v", bal, coin, err)
+			continue
+		}
+		log.Printf("Unwind: sell %s %s, resp: %+v", bal, coin, resp)
+	}
+}
+
+// resp:
+//
+//	{
+//		"retCode": 0,
+//		"retMsg": "OK",
+//		"result": {
+//			"timeSecond": "1688639403",
+//			"timeNano": "1688639403423213947"
+//		},
+//		"retExtInfo": {},
+//		"time": 1688639403423
+//	}
+type ServerTimeResp struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Time    int64  `json:"time"`
+}
+
+// ClockSkew returns local time - Bybit time, the request latency is split in half
+func (api *Api) ClockSkew() (time.Duration, error) {
+	start := time.Now()
+	body, err := api.get(SERVER_TIME_ENDPOINT, map[string]string{})
+	if err != nil {
+		return 0, err
+	}
+	end := time.Now()
+	var resp ServerTimeResp
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return 0, err
+	}
+	if resp.RetCode != 0 {
+		return 0, fmt.Errorf("retCode: %d, retMsg: %s", resp.RetCode, resp.RetMsg)
+	}
+	local := start.Add(end.Sub(start) / 2)
+	return local.Sub(time.UnixMilli(resp.Time)), nil
+}
+
 func (api *Api) GetInstrumentsInfo(symbol string) (resp *InstrumentResp, err error) {
 	params := map[string]string{
 		"category": trade.CATEGORY_SPOT,
@@ -166,6 +536,70 @@ func (api *Api) GetInstrumentsInfo(symbol string) (resp *InstrumentResp, err err
 	return
 }
 
+// resp:
+//
+//	{
+//		"retCode": 0,
+//		"retMsg": "OK",
+//		"result": {
+//			"list": [
+//				{
+//					"accountType": "UNIFIED",
+//					"coin": [
+//						{
+//							"coin": "BTC",
+//							"walletBalance": "0.0003058",
+//							"availableToWithdraw": "0.0003058",
+//							"locked": "0",
+//							...
+//						}
+//					],
+//					...
+//				}
+//			]
+//		},
+//		"time": 1699764599844
+//	}
+type WalletBalanceResp struct {
+	RetCode int    `json:"retCode"`
+	RetMsg  string `json:"retMsg"`
+	Time    int64  `json:"time"`
+	Result  struct {
+		List []WalletDataData `json:"list"`
+	} `json:"result"`
+}
+
+func (api *Api) GetWalletBalance() (resp *WalletBalanceResp, err error) {
+	params := map[string]string{
+		"accountType": ACCOUNT_TYPE_UNIFIED,
+	}
+	body, err := api.get(WALLET_ENDPOINT, params)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &resp)
+	if err == nil && resp.RetCode != 0 {
+		err = fmt.Errorf("retCode: %d, retMsg: %s", resp.RetCode, resp.RetMsg)
+	}
+	return
+}
+
+// SeedInventory loads balances of all coins at startup, the `wallet` topic only pushes changes
+func (api *Api) SeedInventory(inv *trade.Inventory) error {
+	resp, err := api.GetWalletBalance()
+	if err != nil {
+		return err
+	}
+	for _, data := range resp.Result.List {
+		for _, coin := range data.Coins {
+			if err = updateInventory(inv, coin, time.UnixMilli(resp.Time)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (api *Api) GetOrderHistory(limit int) (resp []byte, err error) {
 	params := map[string]string{
 		"category": trade.CATEGORY_SPOT,
@@ -187,6 +621,32 @@ func qtyWithPrecision(qty decimal.Decimal, precision string) (decimal.Decimal, e
 	return convertedQty, nil
 }
 
+// priceWithTick rounds the price to a multiple of tickSize, down to buy and up to sell
+// e.g. 0.01: 37012.345 -> 37012.34 (buy), 37012.35 (sell)
+func priceWithTick(price decimal.Decimal, tickSize string, side string) (decimal.Decimal, error) {
+	if tickSize == "" {
+		return decimal.Decimal{}, errors.New("tick_size is missing in the instruments file, please regenerate it")
+	}
+	tick, err := decimal.NewFromString(tickSize)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	if !tick.IsPositive() {
+		return decimal.Decimal{}, fmt.Errorf("tick_size '%s' is invalid", tickSize)
+	}
+	steps := price.Div(tick)
+	if side == trade.SIDE_BUY {
+		steps = steps.Floor()
+	} else {
+		steps = steps.Ceil()
+	}
+	rounded := steps.Mul(tick)
+	if !rounded.IsPositive() {
+		return decimal.Decimal{}, fmt.Errorf("price %s is below tick_size %s", price, tickSize)
+	}
+	return rounded, nil
+}
+
 // 0.000001 -> 6
 func precisionToNum(p string) (int32, error) {
 	// Find the index of the decimal point
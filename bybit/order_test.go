@@ -0,0 +1,96 @@
+package bybit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+type fakeSender struct {
+	err error
+}
+
+func (s *fakeSender) SendOrder(op string, req any) (*OrderResp, error) {
+	return nil, s.err
+}
+
+// fakeRest answers the order lookups with orders and the order creation with retCode
+func fakeRest(t *testing.T, orders string, retCode int) (*int, *int) {
+	var lookups, creates int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ORDER_REALTIME_ENDPOINT, ORDER_HISTORY_ENDPOINT:
+			lookups++
+			fmt.Fprintf(w, `{"retCode":0,"retMsg":"OK","result":{"list":[%s]}}`, orders)
+		case ORDER_ENDPOINT:
+			creates++
+			fmt.Fprintf(w, `{"retCode":%d,"retMsg":"msg","result":{"orderId":"rest","orderLinkId":"1"}}`, retCode)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	viper.Set("BYBIT_API_HOST", srv.URL)
+	t.Cleanup(func() { viper.Set("BYBIT_API_HOST", nil) })
+	return &lookups, &creates
+}
+
+func sendOrder(t *testing.T, sendErr error) (*OrderResp, error) {
+	api := InitApi()
+	api.SetOrderSender(&fakeSender{err: sendErr})
+	return api.send(ORDER_ENDPOINT, "order.create", OrderRequest{Symbol: "BTCUSDT", OrderLinkId: "1"})
+}
+
+func TestSendFallsBackWhenWsIsDown(t *testing.T) {
+	lookups, creates := fakeRest(t, "", 0)
+	resp, err := sendOrder(t, fmt.Errorf("%w, failed to send", ErrTradeWsDown))
+	if err != nil || resp.Result.OrderId != "rest" {
+		t.Fatalf("send = %+v, %v, want the REST order", resp, err)
+	}
+	if *lookups != 0 || *creates != 1 {
+		t.Fatalf("lookups = %d, creates = %d, want 0, 1", *lookups, *creates)
+	}
+}
+
+func TestSendLooksUpOrderWithoutAck(t *testing.T) {
+	lookups, creates := fakeRest(t, `{"orderId":"ws","orderLinkId":"1","orderStatus":"Filled"}`, 0)
+	resp, err := sendOrder(t, fmt.Errorf("%w within 1s", ErrTradeWsNoAck))
+	if err != nil || resp.RetCode != 0 || resp.Result.OrderId != "ws" {
+		t.Fatalf("send = %+v, %v, want the websocket order", resp, err)
+	}
+	if *lookups != 1 || *creates != 0 {
+		t.Fatalf("lookups = %d, creates = %d, want 1, 0", *lookups, *creates)
+	}
+}
+
+func TestSendResendsOrderWhichIsNotFound(t *testing.T) {
+	lookups, creates := fakeRest(t, "", 0)
+	resp, err := sendOrder(t, fmt.Errorf("%w within 1s", ErrTradeWsNoAck))
+	if err != nil || resp.Result.OrderId != "rest" {
+		t.Fatalf("send = %+v, %v, want the REST order", resp, err)
+	}
+	if *lookups != 2 || *creates != 1 {
+		t.Fatalf("lookups = %d, creates = %d, want 2, 1", *lookups, *creates)
+	}
+}
+
+func TestSendTreatsDuplicateOrderLinkIdAsCreated(t *testing.T) {
+	fakeRest(t, "", 170141)
+	resp, err := sendOrder(t, fmt.Errorf("%w, failed to send", ErrTradeWsDown))
+	if err != nil || resp.RetCode != 0 || resp.Result.OrderLinkId != "1" {
+		t.Fatalf("send = %+v, %v, want created", resp, err)
+	}
+}
+
+func TestSendDoesNotResendOnOtherErrors(t *testing.T) {
+	_, creates := fakeRest(t, "", 0)
+	if _, err := sendOrder(t, fmt.Errorf("unknown")); err == nil {
+		t.Fatal("the error should be returned")
+	}
+	if *creates != 0 {
+		t.Fatalf("creates = %d, want 0", *creates)
+	}
+}
@@ -1,7 +1,11 @@
 package bybit
 
 import (
+	"crypto-triangular-arbitrage-watch/journal"
+	"crypto-triangular-arbitrage-watch/metrics"
 	"crypto-triangular-arbitrage-watch/notification"
+	"crypto-triangular-arbitrage-watch/recorder"
+	"crypto-triangular-arbitrage-watch/risk"
 	"crypto-triangular-arbitrage-watch/runner"
 	"crypto-triangular-arbitrage-watch/trade"
 	"crypto-triangular-arbitrage-watch/tri"
@@ -9,6 +13,8 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/spf13/viper"
@@ -18,10 +24,23 @@ type Ws struct {
 	Tri               *tri.Tri
 	Trade             *trade.Trade
 	OrderbookRunner   *runner.OrderbookRunner
-	Slack             *notification.Slack
+	Notifier          notification.Notifier
+	KillSwitch        *risk.KillSwitch
+	Journal           *journal.Journal
+	Recorder          *recorder.Recorder
 	OrderbookTopicReg *regexp.Regexp
 	DebugPrintMessage bool
-	ListeningTopics   []string
+	ReconnectBase     time.Duration
+	ReconnectMax      time.Duration
+	PongTimeout       time.Duration
+	ReadTimeout       time.Duration
+	NoDataTimeout     time.Duration // public channel only, 0 disables it
+	PublicReplicas    int           // identical public connections per chunk of topics
+	Conns             *ConnManager
+	AckTimeout        time.Duration // of orders sent over the trade channel
+	merge             OrderbookMerge
+	conns             connStates
+	trade             tradeChannel
 }
 
 type MessageReq struct {
@@ -35,8 +54,19 @@ type OpResp struct {
 }
 
 type TopicResp struct {
-	Topic string          `json:"topic"`
-	Data  json.RawMessage `json:"data"`
+	Topic        string          `json:"topic"`
+	Ts           int64           `json:"ts"`           // public channel, millisecond
+	CreationTime int64           `json:"creationTime"` // private channel, millisecond
+	Data         json.RawMessage `json:"data"`
+}
+
+// Message is a frame with the time it's read from the socket, Op or Topic is set once it's handled
+type Message struct {
+	Data   []byte
+	ReadAt time.Time
+	Conn   string // name of the connection
+	Op     string
+	Topic  string
 }
 
 func InitWs() *Ws {
@@ -45,10 +75,52 @@ func InitWs() *Ws {
 		log.Println("Error compiling regex:", err)
 	}
 
-	return &Ws{
+	reconnectBase := time.Duration(RECONNECT_BASE_MILLISECOND) * time.Millisecond
+	if viper.IsSet("WS_RECONNECT_BASE_MILLISECOND") {
+		reconnectBase = time.Duration(viper.GetInt("WS_RECONNECT_BASE_MILLISECOND")) * time.Millisecond
+	}
+	reconnectMax := time.Duration(RECONNECT_MAX_SECOND) * time.Second
+	if viper.IsSet("WS_RECONNECT_MAX_SECOND") {
+		reconnectMax = time.Duration(viper.GetInt("WS_RECONNECT_MAX_SECOND")) * time.Second
+	}
+	if reconnectBase <= 0 || reconnectMax < reconnectBase {
+		log.Fatalf("WS_RECONNECT_BASE_MILLISECOND has to be positive and not greater than WS_RECONNECT_MAX_SECOND")
+	}
+
+	publicReplicas := 1
+	if viper.IsSet("WS_PUBLIC_REPLICAS") {
+		publicReplicas = viper.GetInt("WS_PUBLIC_REPLICAS")
+	}
+	if publicReplicas < 1 {
+		log.Fatalf("WS_PUBLIC_REPLICAS has to be at least 1")
+	}
+
+	ws := &Ws{
 		DebugPrintMessage: viper.GetBool("DEBUG_PRINT_MESSAGE"),
 		OrderbookTopicReg: reg,
+		ReconnectBase:     reconnectBase,
+		ReconnectMax:      reconnectMax,
+		PongTimeout:       secondFromConfig("WS_PONG_TIMEOUT_SECOND", PONG_TIMEOUT_SECOND),
+		ReadTimeout:       secondFromConfig("WS_READ_TIMEOUT_SECOND", READ_TIMEOUT_SECOND),
+		NoDataTimeout:     secondFromConfig("WS_NO_DATA_SECOND", NO_DATA_TIMEOUT_SECOND),
+		PublicReplicas:    publicReplicas,
+		AckTimeout:        time.Duration(ORDER_ACK_TIMEOUT_MILLISECOND) * time.Millisecond,
+	}
+	if viper.IsSet("ORDER_ACK_TIMEOUT_MILLISECOND") {
+		ws.AckTimeout = time.Duration(viper.GetInt("ORDER_ACK_TIMEOUT_MILLISECOND")) * time.Millisecond
+	}
+	if ws.AckTimeout <= 0 {
+		log.Fatalf("ORDER_ACK_TIMEOUT_MILLISECOND has to be positive")
+	}
+	ws.Conns = newConnManager(ws)
+	return ws
+}
+
+func secondFromConfig(key string, defaultSecond int) time.Duration {
+	if !viper.IsSet(key) {
+		return time.Duration(defaultSecond) * time.Second
 	}
+	return time.Duration(viper.GetInt(key)) * time.Second
 }
 
 func (ws *Ws) SetTri(tri *tri.Tri) {
@@ -63,11 +135,23 @@ func (ws *Ws) SetOrderbookRunner(orderbookRunner *runner.OrderbookRunner) {
 	ws.OrderbookRunner = orderbookRunner
 }
 
-func (ws *Ws) SetSlack(slack *notification.Slack) {
-	ws.Slack = slack
+func (ws *Ws) SetNotifier(notifier notification.Notifier) {
+	ws.Notifier = notifier
+}
+
+func (ws *Ws) SetKillSwitch(ks *risk.KillSwitch) {
+	ws.KillSwitch = ks
 }
 
-func (ws *Ws) handleResponse(message []byte) error {
+func (ws *Ws) SetJournal(j *journal.Journal) {
+	ws.Journal = j
+}
+
+func (ws *Ws) SetRecorder(r *recorder.Recorder) {
+	ws.Recorder = r
+}
+
+func (ws *Ws) handleResponse(message *Message) error {
 	proceed, err := ws.handleOpResp(message)
 	if err != nil {
 		return err
@@ -82,22 +166,23 @@ func (ws *Ws) handleResponse(message []byte) error {
 // operation response e.g. subscribe, ping, auth
 // content response e.g. orderbook, wallet
 // bool in response means should it continue to parse the message?
-func (ws *Ws) handleOpResp(message []byte) (bool, error) {
+func (ws *Ws) handleOpResp(message *Message) (bool, error) {
 	var opResp OpResp
-	err := json.Unmarshal(message, &opResp)
+	err := json.Unmarshal(message.Data, &opResp)
 	if err != nil {
 		return false, fmt.Errorf("failed to parse op message, err: %v", err)
 	}
+	message.Op = opResp.Op
 	// If op isn't empty, it means that it's the response of operation e.g. subscribe or ping
 	switch opResp.Op {
-	case "subscribe":
+	case "subscribe", "unsubscribe":
 		if !opResp.Success {
-			return false, fmt.Errorf("success: false, response: %s", string(message))
+			return false, fmt.Errorf("success: false, response: %s", string(message.Data))
 		}
 		return false, nil
 	case "ping":
 		if !opResp.Success {
-			return false, fmt.Errorf("success: false, response: %s", string(message))
+			return false, fmt.Errorf("success: false, response: %s", string(message.Data))
 		}
 		return false, nil
 	case "pong":
@@ -108,15 +193,18 @@ func (ws *Ws) handleOpResp(message []byte) (bool, error) {
 	}
 }
 
-func (ws *Ws) handleTopicResp(message []byte) error {
+func (ws *Ws) handleTopicResp(message *Message) error {
 	var topicResp TopicResp
-	err := json.Unmarshal(message, &topicResp)
+	err := json.Unmarshal(message.Data, &topicResp)
 	if err != nil {
 		return fmt.Errorf("failed to parse topic message, err: %v", err)
 	}
 
+	message.Topic = topicResp.Topic
+
 	// To prevent panic, it shouldn't happen, but just in case if Bybit returns unexpected data back
 	if topicResp.Topic != "" {
+		metrics.Messages.Inc(topicResp.Topic)
 		switch {
 		case ws.OrderbookTopicReg.MatchString(topicResp.Topic):
 			var data runner.OrderbookData
@@ -126,7 +214,23 @@ func (ws *Ws) handleTopicResp(message []byte) error {
 			}
 			// To prevent panic, it shouldn't happen, but just in case if Bybit returns unexpected data back
 			if data.Symbol != "" {
-				ws.OrderbookRunner.OrderbookListeners[data.Symbol].OrderbookDataCh <- &data
+				first, lag := ws.merge.Accept(&data, message.ReadAt)
+				ws.conns.merged(message.Conn, first, lag)
+				metrics.OrderbookUpdates.Inc(message.Conn)
+				if !first {
+					// A redundant connection has delivered it
+					return nil
+				}
+				metrics.FirstArrivals.Inc(message.Conn)
+				// Symbols which aren't in the combinations file can be subscribed at runtime to be recorded,
+				// evaluating them needs the combinations file to be updated and a restart
+				listener, ok := ws.OrderbookRunner.OrderbookListeners[data.Symbol]
+				if !ok {
+					return nil
+				}
+				data.Timestamps.Exchange = time.UnixMilli(topicResp.Ts)
+				data.Timestamps.Read = message.ReadAt
+				listener.OrderbookDataCh <- &data
 			}
 		case topicResp.Topic == "order.spot":
 			var list []OrderSpotData
@@ -135,7 +239,20 @@ func (ws *Ws) handleTopicResp(message []byte) error {
 				return fmt.Errorf("failed to parse topic 'order.spot' data, err: %v", err)
 			}
 			for _, data := range list {
-				ws.Slack.SystemLogs(fmt.Sprintf("order.spot: %+v", data))
+				ws.Notifier.SystemLogs(fmt.Sprintf("order.spot: %+v", data))
+				switch data.Status {
+				case "PartiallyFilledCanceled", "Filled":
+					metrics.ObserveOrderFill(data.OrderLinkId, message.ReadAt)
+					metrics.Orders.Inc(metrics.ORDER_FILLED)
+				case "Rejected":
+					metrics.Orders.Inc(metrics.ORDER_REJECTED)
+				}
+				switch data.Status {
+				case "PartiallyFilledCanceled", "Filled", "Cancelled", "Rejected":
+					// The order is done, the wallet topic will bring the new balances, what it has spent is deducted until then
+					ws.Trade.Inventory.Settle(data.OrderLinkId, spentOfOrder(data), doneAtOfOrder(data, topicResp.CreationTime))
+					ws.journalOrder(data)
+				}
 				switch data.Status {
 				case "PartiallyFilledCanceled", "Filled":
 					var actualQty decimal.Decimal
@@ -161,14 +278,29 @@ func (ws *Ws) handleTopicResp(message []byte) error {
 						}
 						actualQty = cumValue.Sub(cumFee)
 					}
-					ws.Slack.SystemLogs(fmt.Sprintf("actualQty: %s", actualQty.String()))
-					ws.Trade.Qty <- actualQty
-				case "Cancelled":
-					log.Println("Cancelled", data)
+					ws.Notifier.SystemLogs(fmt.Sprintf("actualQty: %s", actualQty.String()))
+					ws.Trade.Fills.Deliver(data.OrderLinkId, actualQty)
+				case "Cancelled", "Rejected":
+					log.Println(data.Status, data)
+					// Nothing is filled whatever the time in force is e.g. IOC, FOK, a PostOnly which would take, or a cancelled GTC,
+					// the leg is over instead of waiting for a fill
+					ws.Trade.Fills.Deliver(data.OrderLinkId, decimal.Zero)
 					// TODO
 					// ws.Trade.Retry <- 1
 				}
 			}
+		case topicResp.Topic == "execution.spot":
+			var list []ExecutionSpotData
+			err := json.Unmarshal(topicResp.Data, &list)
+			if err != nil {
+				return fmt.Errorf("failed to parse topic 'execution.spot' data, err: %v", err)
+			}
+			for _, data := range list {
+				metrics.ObserveOrderFill(data.OrderLinkId, message.ReadAt)
+				if err := ws.journalExecution(data); err != nil {
+					return err
+				}
+			}
 		case topicResp.Topic == "wallet":
 			var list []WalletDataData
 			err := json.Unmarshal(topicResp.Data, &list)
@@ -177,17 +309,100 @@ func (ws *Ws) handleTopicResp(message []byte) error {
 			}
 			for _, data := range list {
 				for _, coin := range data.Coins {
-					if coin.Coin == "USDT" {
-						bal, err := decimal.NewFromString(coin.Balance)
-						if err != nil {
-							return err
-						}
-						ws.Trade.Balance = bal
+					if err := updateInventory(ws.Trade.Inventory, coin, time.UnixMilli(topicResp.CreationTime)); err != nil {
+						return err
+					}
+					if coin.Coin == trade.HOME_COIN {
+						ws.Trade.Balance = ws.Trade.Inventory.Wallet(trade.HOME_COIN)
 					}
 				}
-				ws.Slack.SystemLogs(fmt.Sprintf("wallet coins: %+v", data.Coins))
+				ws.Notifier.SystemLogs(fmt.Sprintf("wallet coins: %+v", data.Coins))
 			}
 		}
 	}
 	return nil
 }
+
+// spentOfOrder is the filled amount of the coin spent, quote coin to buy and base coin to sell
+func spentOfOrder(data OrderSpotData) decimal.Decimal {
+	// An invalid value is zero, nothing is deducted then
+	spent, _ := decimalOrZero(data.CumValue)
+	if data.Side == trade.SIDE_SELL {
+		spent, _ = decimalOrZero(data.CumQty)
+	}
+	return spent
+}
+
+// doneAtOfOrder is the Bybit time the order is done, the creation time of the message if updatedTime is invalid
+func doneAtOfOrder(data OrderSpotData, creationTime int64) time.Time {
+	ms, err := strconv.ParseInt(data.UpdatedTime, 10, 64)
+	if err != nil {
+		ms = creationTime
+	}
+	return time.UnixMilli(ms)
+}
+
+func (ws *Ws) journalOrder(data OrderSpotData) {
+	if ws.Journal == nil {
+		return
+	}
+	// Values are validated by the caller, zero is fine for the journal
+	qty, _ := decimalOrZero(data.CumQty)
+	value, _ := decimalOrZero(data.CumValue)
+	fee, _ := decimalOrZero(data.CumFee)
+	ws.Journal.Record(journal.Record{
+		Type:        journal.TYPE_ORDER,
+		Symbol:      data.Symbol,
+		Side:        data.Side,
+		OrderId:     data.OrderId,
+		OrderLinkId: data.OrderLinkId,
+		Status:      data.Status,
+		Qty:         qty,
+		Value:       value,
+		Fee:         fee,
+	})
+}
+
+// Each execution is a fill with its fee, fee is charged in the received coin (spot)
+func (ws *Ws) journalExecution(data ExecutionSpotData) error {
+	if ws.Journal == nil {
+		return nil
+	}
+	price, err := decimalOrZero(data.ExecPrice)
+	if err != nil {
+		return fmt.Errorf("failed to new decimal 'execPrice' data, err: %v", err)
+	}
+	qty, err := decimalOrZero(data.ExecQty)
+	if err != nil {
+		return fmt.Errorf("failed to new decimal 'execQty' data, err: %v", err)
+	}
+	value, err := decimalOrZero(data.ExecValue)
+	if err != nil {
+		return fmt.Errorf("failed to new decimal 'execValue' data, err: %v", err)
+	}
+	fee, err := decimalOrZero(data.ExecFee)
+	if err != nil {
+		return fmt.Errorf("failed to new decimal 'execFee' data, err: %v", err)
+	}
+	var feeCoin string
+	if instrument, ok := ws.Tri.SymbolInstrumentMap[data.Symbol]; ok {
+		feeCoin = instrument.BaseCoin
+		if data.Side == trade.SIDE_SELL {
+			feeCoin = instrument.QuoteCoin
+		}
+	}
+	rec := journal.Record{
+		Type:        journal.TYPE_FILL,
+		Symbol:      data.Symbol,
+		Side:        data.Side,
+		OrderId:     data.OrderId,
+		OrderLinkId: data.OrderLinkId,
+		Qty:         qty,
+		Price:       price,
+		Value:       value,
+		Fee:         fee,
+		FeeCoin:     feeCoin,
+	}
+	ws.Journal.Record(rec)
+	return nil
+}
@@ -1,6 +1,9 @@
 package bybit
 
 import (
+	"crypto-triangular-arbitrage-watch/metrics"
+	"crypto-triangular-arbitrage-watch/recorder"
+	"crypto-triangular-arbitrage-watch/trade"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -10,36 +13,56 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
 	"github.com/spf13/viper"
 )
 
 type OrderSpotData struct {
-	Symbol   string `json:"symbol"`
-	Side     string `json:"side"`
-	CumQty   string `json:"cumExecQty"`
-	CumValue string `json:"cumExecValue"`
-	CumFee   string `json:"cumExecFee"`
-	Status   string `json:"orderStatus"`
-	Type     string `json:"orderType"`
+	OrderId     string `json:"orderId"`
+	OrderLinkId string `json:"orderLinkId"`
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	CumQty      string `json:"cumExecQty"`
+	CumValue    string `json:"cumExecValue"`
+	CumFee      string `json:"cumExecFee"`
+	Status      string `json:"orderStatus"`
+	Type        string `json:"orderType"`
+	TimeInForce string `json:"timeInForce"`
+	UpdatedTime string `json:"updatedTime"` // millisecond
+}
+
+type ExecutionSpotData struct {
+	OrderId     string `json:"orderId"`
+	OrderLinkId string `json:"orderLinkId"`
+	Symbol      string `json:"symbol"`
+	Side        string `json:"side"`
+	ExecPrice   string `json:"execPrice"`
+	ExecQty     string `json:"execQty"`
+	ExecValue   string `json:"execValue"`
+	ExecFee     string `json:"execFee"`
 }
 
 type WalletDataData struct {
 	Coins []Coin `json:"coin"`
 }
 type Coin struct {
-	Coin    string `json:"coin"`
-	Balance string `json:"walletBalance"`
+	Coin      string `json:"coin"`
+	Balance   string `json:"walletBalance"`
+	Available string `json:"availableToWithdraw"`
+	Locked    string `json:"locked"`
 }
 
 func (ws *Ws) HandlePrivateChannel() {
 	topics := []string{"order.spot", "execution.spot", "wallet"} // "order.spot", "execution.spot", "wallet"
 
+	b := &backoff{base: ws.ReconnectBase, max: ws.ReconnectMax}
 	for {
-		if err := ws.listenPrivateChannel(topics); err != nil {
-			ws.Slack.SystemLogs(fmt.Sprintf("Private channel connection, error: %v", err))
+		startedAt := time.Now()
+		err := ws.listenPrivateChannel(topics)
+		if ws.KillSwitch != nil {
+			ws.KillSwitch.SetPrivateChannelUp(false)
 		}
-		ws.Slack.SystemLogs("Private channel connection reconnecting...")
-		time.Sleep(3 * time.Second)
+		ws.waitReconnect(CONN_PRIVATE, b, startedAt, err)
 	}
 }
 
@@ -63,56 +86,64 @@ func (ws *Ws) listenPrivateChannel(topics []string) error {
 	}
 
 	// Check auth message
+	if ws.ReadTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(ws.ReadTimeout))
+	}
 	_, message, err := conn.ReadMessage()
 	if err != nil {
 		return fmt.Errorf("failed to read auth message, err: %v", err)
 	}
-	proceed, err := ws.handleOpResp(message)
+	proceed, err := ws.handleOpResp(&Message{Data: message})
 	if err != nil {
 		return err
 	}
 	if !proceed {
 		return nil
 	}
-	ws.Slack.SystemLogs("auth succeed!")
+	ws.Notifier.SystemLogs("auth succeed!")
+	if ws.KillSwitch != nil {
+		ws.KillSwitch.SetPrivateChannelUp(true)
+	}
 
 	// Subscribe order status, wallet, etc.
 	if err = conn.WriteJSON(MessageReq{Op: "subscribe", Args: topics}); err != nil {
 		return fmt.Errorf("failed to send op, args: %v, err: %v", topics, err)
 	}
-
-	// In order to prevent `conn.ReadMessage()` from blocking if there is no update pushed from Bybit and ping won't be
-	// executed due to this reason, it needed to be run in another goroutine
-	msgChan := make(chan []byte)
-	errChan := make(chan error)
-	go func() {
-		for {
-			_, message, err := conn.ReadMessage()
-			if err != nil {
-				errChan <- fmt.Errorf("failed to read message during running, err: %v", err)
-				return
-			}
-			msgChan <- message
-		}
-	}()
-
-	// Listen to response
-	ticker := time.NewTicker(20 * time.Second)
+	ws.announceConnected(CONN_PRIVATE, topics, "Private channel listening...")
+
+	done := make(chan struct{})
+	defer close(done)
+	msgChan, errChan := ws.readMessages(conn, done, func(data []byte, readAt time.Time) {
+		ws.Recorder.Record(recorder.CHANNEL_PRIVATE, 0, readAt, data)
+		ws.conns.received(CONN_PRIVATE, readAt)
+	})
+
+	// Listen to response, topics of the private channel are quiet without orders, so only the pong is checked
+	hb := newHeartbeat(ws.PongTimeout, 0)
+	ticker := time.NewTicker(time.Duration(PING_INTERVAL_SECOND) * time.Second)
 	defer ticker.Stop()
+	checkTicker := time.NewTicker(time.Duration(HEARTBEAT_CHECK_SECOND) * time.Second)
+	defer checkTicker.Stop()
 	for {
 		select {
-		case <-ticker.C:
+		case now := <-ticker.C:
 			if err = conn.WriteJSON(MessageReq{Op: "ping"}); err != nil {
 				return fmt.Errorf("failed to send op, err: %v", err)
 			}
+			hb.pinged(now)
+		case now := <-checkTicker.C:
+			if err = hb.check(now); err != nil {
+				return fmt.Errorf("heartbeat failed, err: %v", err)
+			}
 		case message := <-msgChan:
 			if ws.DebugPrintMessage {
-				log.Println("private:", string(message))
+				log.Println("private:", string(message.Data))
 			}
 			err = ws.handleResponse(message)
 			if err != nil {
 				return fmt.Errorf("failed to parse private message during running, err: %v", err)
 			}
+			hb.received(message)
 		case err := <-errChan:
 			return err
 		}
@@ -133,3 +164,30 @@ func (ws *Ws) generateSignature(expires string) string {
 
 	return signature
 }
+
+// updateInventory sets the balances of the coin as of updatedAt, the Bybit time of the wallet balance
+func updateInventory(inv *trade.Inventory, coin Coin, updatedAt time.Time) error {
+	wallet, err := decimalOrZero(coin.Balance)
+	if err != nil {
+		return fmt.Errorf("failed to new decimal '%s' walletBalance, err: %v", coin.Coin, err)
+	}
+	available, err := decimalOrZero(coin.Available)
+	if err != nil {
+		return fmt.Errorf("failed to new decimal '%s' availableToWithdraw, err: %v", coin.Coin, err)
+	}
+	locked, err := decimalOrZero(coin.Locked)
+	if err != nil {
+		return fmt.Errorf("failed to new decimal '%s' locked, err: %v", coin.Coin, err)
+	}
+	inv.Update(coin.Coin, wallet, available, locked, updatedAt)
+	metrics.Wallet.Set(coin.Coin, wallet.InexactFloat64())
+	return nil
+}
+
+// Bybit returns "" instead of "0" for some fields
+func decimalOrZero(s string) (decimal.Decimal, error) {
+	if s == "" {
+		return decimal.Zero, nil
+	}
+	return decimal.NewFromString(s)
+}
@@ -1,43 +1,65 @@
 package bybit
 
 import (
+	"crypto-triangular-arbitrage-watch/recorder"
 	"fmt"
 	"log"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/spf13/viper"
 )
 
-func (ws *Ws) HandlePublicChannel() {
-	var wg sync.WaitGroup
-	topics := ws.getOrderbookTopics()
-	chunkSize := 10 // bybit only accepts up to 10 symbols per connection
-	connNum := 1
-	for i := 0; i < len(topics); i += chunkSize {
-		end := i + chunkSize
-		if end > len(topics) {
-			end = len(topics)
+// publicConn is a public connection of a group, the first arrival of each update among replicas wins
+type publicConn struct {
+	Id    int // connection number of the recorder
+	Name  string
+	Group *publicGroup
+	sync  chan struct{} // topics of the group are changed
+}
+
+// replicaNames are names of the other replicas of the group
+func (pc *publicConn) replicaNames() []string {
+	var names []string
+	for _, replica := range pc.Group.replicas {
+		if replica != pc {
+			names = append(names, replica.Name)
 		}
-		wg.Add(1)
-		go ws.listenOrderbooksWithRetry(connNum, topics[i:end])
-		connNum++
 	}
-	wg.Wait()
+	return names
 }
 
-func (ws *Ws) listenOrderbooksWithRetry(connNum int, topics []string) {
+// HandlePublicChannel subscribes orderbooks of all symbols in the combinations, it blocks
+func (ws *Ws) HandlePublicChannel() {
+	if err := ws.Conns.AddTopics(ws.getOrderbookTopics()); err != nil {
+		log.Fatalf("Failed to subscribe orderbooks, err: %v", err)
+	}
+	select {}
+}
+
+// listenOrderbooksWithRetry stops once the group is closed by the connection manager
+func (ws *Ws) listenOrderbooksWithRetry(pc *publicConn) {
+	b := &backoff{base: ws.ReconnectBase, max: ws.ReconnectMax}
 	for {
-		if err := ws.listenOrderbooks(connNum, topics); err != nil {
-			ws.Slack.SystemLogs(fmt.Sprintf("Orderbooks connection(%d) error: %v", connNum, err))
+		startedAt := time.Now()
+		err := ws.listenOrderbooks(pc)
+		select {
+		case <-pc.Group.stopped:
+			ws.conns.remove(pc.Name)
+			ws.Notifier.SystemLogs(fmt.Sprintf("Orderbooks connection %s closed, it has no topics", pc.Name))
+			return
+		default:
+		}
+		// Orderbooks are outdated until they are updated after resubscribing, unless a replica is still connected
+		if !ws.conns.anyConnected(pc.replicaNames()) {
+			ws.setStale(pc.Group.Topics())
 		}
-		ws.Slack.SystemLogs(fmt.Sprintf("Orderbooks connection(%d) reconnecting...", connNum))
-		time.Sleep(3 * time.Second)
+		ws.waitReconnect(pc.Name, b, startedAt, err)
 	}
 }
 
-func (ws *Ws) listenOrderbooks(connNum int, topics []string) error {
+func (ws *Ws) listenOrderbooks(pc *publicConn) error {
 	var err error
 	conn, _, err := websocket.DefaultDialer.Dial(viper.GetString("BYBIT_PUBLIC_WS_SPOT"), nil)
 	if err != nil {
@@ -45,51 +67,120 @@ func (ws *Ws) listenOrderbooks(connNum int, topics []string) error {
 	}
 	defer conn.Close()
 
-	if err = conn.WriteJSON(MessageReq{Op: "subscribe", Args: topics}); err != nil {
-		return fmt.Errorf("failed to send op, err: %v", err)
+	subscribed := pc.Group.Topics()
+	for _, req := range ws.Conns.subscriptionRequests("subscribe", subscribed) {
+		if err = conn.WriteJSON(req); err != nil {
+			return fmt.Errorf("failed to send op, err: %v", err)
+		}
 	}
+	ws.announceConnected(pc.Name, subscribed, fmt.Sprintf("Orderbooks connection %s listening...", pc.Name))
 
-	// In order to prevent `conn.ReadMessage()` from blocking if there is no update pushed from bybit and ping won't be
-	// executed due to this reason, it needed to be run in another goroutine
-	msgChan := make(chan []byte)
-	errChan := make(chan error)
-	go func() {
-		for {
-			_, message, err := conn.ReadMessage()
-			if err != nil {
-				errChan <- fmt.Errorf("failed to read message during running, err: %v", err)
-				return
-			}
-			msgChan <- message
-		}
-	}()
+	done := make(chan struct{})
+	defer close(done)
+	msgChan, errChan := ws.readMessages(conn, done, func(data []byte, readAt time.Time) {
+		ws.Recorder.Record(recorder.CHANNEL_PUBLIC, pc.Id, readAt, data)
+		ws.conns.received(pc.Name, readAt)
+	})
 
 	// Handle incoming messages
-	ws.Slack.SystemLogs(fmt.Sprintf("Orderbooks connection(%d) listening...", connNum))
-	ticker := time.NewTicker(20 * time.Second)
+	hb := newHeartbeat(ws.PongTimeout, ws.NoDataTimeout)
+	ticker := time.NewTicker(time.Duration(PING_INTERVAL_SECOND) * time.Second)
 	defer ticker.Stop()
+	checkTicker := time.NewTicker(time.Duration(HEARTBEAT_CHECK_SECOND) * time.Second)
+	defer checkTicker.Stop()
 	for {
 		select {
-		case <-ticker.C:
-			// Bybit recommends client to send the ping heartbeat packet every 20 seconds to maintain the WebSocket connection.
-			// Otherwise, established connection will close after 5 minutes.
+		case now := <-ticker.C:
 			if err = conn.WriteJSON(MessageReq{Op: "ping"}); err != nil {
 				return fmt.Errorf("failed to send op, err: %v", err)
 			}
+			hb.pinged(now)
+		case now := <-checkTicker.C:
+			if err = hb.check(now); err != nil {
+				return fmt.Errorf("heartbeat failed, err: %v", err)
+			}
+		case <-pc.Group.stopped:
+			return nil
+		case <-pc.sync:
+			if subscribed, err = ws.syncTopics(conn, pc, subscribed, hb); err != nil {
+				return err
+			}
 		case message := <-msgChan:
+			message.Conn = pc.Name
 			if ws.DebugPrintMessage {
-				log.Println("orderbook:", string(message))
+				log.Println("orderbook:", string(message.Data))
 			}
 			err = ws.handleResponse(message)
 			if err != nil {
 				return fmt.Errorf("failed to parse orderbook message during running, err: %v", err)
 			}
+			hb.received(message)
 		case err := <-errChan:
 			return err
 		}
 	}
 }
 
+// syncTopics subscribes and unsubscribes the difference between topics of the group and the subscribed ones
+func (ws *Ws) syncTopics(conn *websocket.Conn, pc *publicConn, subscribed []string, hb *heartbeat) ([]string, error) {
+	topics := pc.Group.Topics()
+	var added, removed []string
+	for _, topic := range topics {
+		if !contains(subscribed, topic) {
+			added = append(added, topic)
+		}
+	}
+	for _, topic := range subscribed {
+		if !contains(topics, topic) {
+			removed = append(removed, topic)
+			hb.forget(topic)
+		}
+	}
+	reqs := append(ws.Conns.subscriptionRequests("subscribe", added), ws.Conns.subscriptionRequests("unsubscribe", removed)...)
+	for _, req := range reqs {
+		if err := conn.WriteJSON(req); err != nil {
+			return subscribed, fmt.Errorf("failed to send op, args: %v, err: %v", req.Args, err)
+		}
+	}
+	if len(reqs) > 0 {
+		ws.conns.subscribed(pc.Name, topics)
+		log.Printf("Orderbooks connection %s subscribed %v, unsubscribed %v", pc.Name, added, removed)
+	}
+	return topics, nil
+}
+
+// setStale marks orderbooks of the topics stale, their episodes are closed as they can't be traded anymore
+func (ws *Ws) setStale(topics []string) {
+	var merged []string
+	for _, topic := range topics {
+		// Symbols which aren't in the combinations are merged as well
+		merged = append(merged, topicSymbol(topic))
+	}
+	ws.merge.Reset(merged)
+	symbols := ws.symbolsOfTopics(topics)
+	ws.Tri.SetStale(symbols)
+	if ws.OrderbookRunner != nil {
+		ws.OrderbookRunner.CloseEpisodes(symbols)
+	}
+}
+
+// topicSymbol returns the symbol of an orderbook topic e.g. BTCUSDT of orderbook.1.BTCUSDT
+func topicSymbol(topic string) string {
+	return topic[strings.LastIndex(topic, ".")+1:]
+}
+
+func (ws *Ws) symbolsOfTopics(topics []string) []string {
+	var symbols []string
+	for _, topic := range topics {
+		for symbol, t := range ws.Tri.OrderbookTopics {
+			if t == topic {
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols
+}
+
 func (ws *Ws) getOrderbookTopics() []string {
 	var topics []string
 	for symbol, _ := range ws.Tri.SymbolCombinationsMap {
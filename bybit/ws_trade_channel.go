@@ -0,0 +1,255 @@
+package bybit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/viper"
+)
+
+const (
+	CONN_TRADE = "trade"
+
+	ORDER_ACK_TIMEOUT_MILLISECOND = 1000
+)
+
+var (
+	// ErrTradeWsDown means the order isn't sent
+	ErrTradeWsDown = errors.New("trade websocket isn't connected")
+	// ErrTradeWsNoAck means the order is sent, but it's unknown whether it's created
+	ErrTradeWsNoAck = errors.New("no ack from the trade websocket")
+)
+
+// TradeReq is a request of the trade websocket, reqId is echoed back in the response
+//
+//	{
+//		"reqId": "1",
+//		"header": {"X-BAPI-TIMESTAMP": "1711001595207", "X-BAPI-RECV-WINDOW": "3000"},
+//		"op": "order.create",
+//		"args": [{"symbol": "BTCUSDT", "side": "Buy", "orderType": "Market", "qty": "10", "category": "spot"}]
+//	}
+type TradeReq struct {
+	ReqId  string            `json:"reqId,omitempty"`
+	Header map[string]string `json:"header,omitempty"`
+	Op     string            `json:"op"`
+	Args   []any             `json:"args,omitempty"`
+}
+
+// TradeResp is a response of the trade websocket, auth and pong don't have reqId
+//
+//	{
+//		"reqId": "1",
+//		"retCode": 0,
+//		"retMsg": "OK",
+//		"op": "order.create",
+//		"data": {"orderId": "1321003749386327552", "orderLinkId": "spot-test-postonly"},
+//		"header": {"X-Bapi-Limit": "20", "Timenow": "1711001595211"},
+//		"connId": "cnj6gf4t5ggd2j1klho0-3"
+//	}
+type TradeResp struct {
+	ReqId   string          `json:"reqId"`
+	RetCode int             `json:"retCode"`
+	RetMsg  string          `json:"retMsg"`
+	Op      string          `json:"op"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// tradeChannel is shared by the goroutine of the connection and the callers of SendOrder
+type tradeChannel struct {
+	mu      sync.Mutex // guards writes to conn as well
+	conn    *websocket.Conn
+	reqNum  int64
+	pending map[string]chan *TradeResp // reqId -> ack, it's closed if the connection drops before the ack
+}
+
+func (tc *tradeChannel) up(conn *websocket.Conn) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.conn = conn
+	tc.pending = make(map[string]chan *TradeResp)
+}
+
+// down fails the requests waiting for acks at once, instead of letting them time out
+func (tc *tradeChannel) down() {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.conn = nil
+	for reqId, ack := range tc.pending {
+		close(ack)
+		delete(tc.pending, reqId)
+	}
+}
+
+func (tc *tradeChannel) write(req TradeReq) error {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.conn == nil {
+		return ErrTradeWsDown
+	}
+	return tc.conn.WriteJSON(req)
+}
+
+// send registers the ack before writing, the lock keeps the response from being handled before that
+func (tc *tradeChannel) send(op string, args any) (string, chan *TradeResp, error) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.conn == nil {
+		return "", nil, ErrTradeWsDown
+	}
+	tc.reqNum++
+	reqId := strconv.FormatInt(tc.reqNum, 10)
+	req := TradeReq{
+		ReqId: reqId,
+		Header: map[string]string{
+			"X-BAPI-TIMESTAMP":   strconv.FormatInt(time.Now().UnixMilli(), 10),
+			"X-BAPI-RECV-WINDOW": RECV_WINDOW_MILLISECOND,
+		},
+		Op:   op,
+		Args: []any{args},
+	}
+	ack := make(chan *TradeResp, 1)
+	tc.pending[reqId] = ack
+	if err := tc.conn.WriteJSON(req); err != nil {
+		delete(tc.pending, reqId)
+		return "", nil, fmt.Errorf("%w, failed to send %s, err: %v", ErrTradeWsDown, op, err)
+	}
+	return reqId, ack, nil
+}
+
+func (tc *tradeChannel) forget(reqId string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	delete(tc.pending, reqId)
+}
+
+// acked returns false if nobody is waiting for it e.g. it has timed out
+func (tc *tradeChannel) acked(resp *TradeResp) bool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	ack, ok := tc.pending[resp.ReqId]
+	if !ok {
+		return false
+	}
+	delete(tc.pending, resp.ReqId)
+	ack <- resp
+	return true
+}
+
+// SendOrder sends order.create or order.cancel and waits for the ack with the same reqId
+func (ws *Ws) SendOrder(op string, req any) (*OrderResp, error) {
+	reqId, ack, err := ws.trade.send(op, req)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(ws.AckTimeout)
+	defer timer.Stop()
+	select {
+	case resp, ok := <-ack:
+		if !ok {
+			return nil, fmt.Errorf("%w, the connection dropped, reqId: %s", ErrTradeWsNoAck, reqId)
+		}
+		orderResp := &OrderResp{RetCode: resp.RetCode, RetMsg: resp.RetMsg}
+		if len(resp.Data) > 0 {
+			// data is {} if it's rejected
+			if err := json.Unmarshal(resp.Data, &orderResp.Result); err != nil {
+				return nil, fmt.Errorf("failed to parse %s data, err: %v", op, err)
+			}
+		}
+		return orderResp, nil
+	case <-timer.C:
+		ws.trade.forget(reqId)
+		return nil, fmt.Errorf("%w within %v, reqId: %s", ErrTradeWsNoAck, ws.AckTimeout, reqId)
+	}
+}
+
+// HandleTradeChannel keeps the trade connection for order entry, orders go through REST while it's down
+func (ws *Ws) HandleTradeChannel() {
+	b := &backoff{base: ws.ReconnectBase, max: ws.ReconnectMax}
+	for {
+		startedAt := time.Now()
+		err := ws.listenTradeChannel()
+		ws.trade.down()
+		ws.waitReconnect(CONN_TRADE, b, startedAt, err)
+	}
+}
+
+func (ws *Ws) listenTradeChannel() error {
+	conn, _, err := websocket.DefaultDialer.Dial(viper.GetString("BYBIT_TRADE_WS"), nil)
+	if err != nil {
+		return fmt.Errorf("failed to dial, err: %v", err)
+	}
+	defer conn.Close()
+
+	// Auth message, it's the same as the private channel
+	expires := strconv.FormatInt(time.Now().Unix()*1000+1000, 10)
+	req := MessageReq{
+		Op:   "auth",
+		Args: []string{viper.GetString("BYBIT_API_KEY"), expires, ws.generateSignature(expires)},
+	}
+	if err = conn.WriteJSON(req); err != nil {
+		return fmt.Errorf("failed to send op, err: %v", err)
+	}
+	if ws.ReadTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(ws.ReadTimeout))
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("failed to read auth message, err: %v", err)
+	}
+	var authResp TradeResp
+	if err = json.Unmarshal(data, &authResp); err != nil {
+		return fmt.Errorf("failed to parse auth message, err: %v", err)
+	}
+	if authResp.Op != "auth" || authResp.RetCode != 0 {
+		return fmt.Errorf("auth failed, response: %s", string(data))
+	}
+	ws.trade.up(conn)
+	ws.announceConnected(CONN_TRADE, nil, "Trade channel listening...")
+
+	done := make(chan struct{})
+	defer close(done)
+	msgChan, errChan := ws.readMessages(conn, done, func(data []byte, readAt time.Time) {
+		ws.conns.received(CONN_TRADE, readAt)
+	})
+
+	// Acks only come after orders, so only the pong is checked
+	hb := newHeartbeat(ws.PongTimeout, 0)
+	ticker := time.NewTicker(time.Duration(PING_INTERVAL_SECOND) * time.Second)
+	defer ticker.Stop()
+	checkTicker := time.NewTicker(time.Duration(HEARTBEAT_CHECK_SECOND) * time.Second)
+	defer checkTicker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err = ws.trade.write(TradeReq{Op: "ping"}); err != nil {
+				return fmt.Errorf("failed to send op, err: %v", err)
+			}
+			hb.pinged(now)
+		case now := <-checkTicker.C:
+			if err = hb.check(now); err != nil {
+				return fmt.Errorf("heartbeat failed, err: %v", err)
+			}
+		case message := <-msgChan:
+			if ws.DebugPrintMessage {
+				log.Println("trade:", string(message.Data))
+			}
+			var resp TradeResp
+			if err = json.Unmarshal(message.Data, &resp); err != nil {
+				return fmt.Errorf("failed to parse trade message during running, err: %v", err)
+			}
+			message.Op = resp.Op
+			if resp.ReqId != "" && !ws.trade.acked(&resp) {
+				log.Printf("Ack of reqId %s arrived after the timeout, op: %s, retCode: %d, retMsg: %s", resp.ReqId, resp.Op, resp.RetCode, resp.RetMsg)
+			}
+			hb.received(message)
+		case err := <-errChan:
+			return err
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is injected wherever the current time matters, so replays and tests can control the time
+type Clock interface {
+	Now() time.Time
+}
+
+type Real struct{}
+
+func (Real) Now() time.Time {
+	return time.Now()
+}
+
+// Sim only moves when Set is called
+type Sim struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (s *Sim) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now
+}
+
+func (s *Sim) Set(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
@@ -0,0 +1,76 @@
+package clock
+
+import (
+	"log"
+	"time"
+	_ "time/tzdata" // TIMEZONE works on hosts without the zoneinfo database
+
+	"github.com/spf13/viper"
+)
+
+const (
+	DEFAULT_TIME_LAYOUT = "2006-01-02 15:04:05 MST"
+	DAY_LAYOUT          = "2006-01-02"
+)
+
+// Formatter renders timestamps of notifications and logs in TIMEZONE with TIME_LAYOUT
+type Formatter struct {
+	Clock    Clock
+	Location *time.Location
+	Layout   string
+}
+
+// DefaultFormatter is UTC with DEFAULT_TIME_LAYOUT, it's used until a formatter is set
+func DefaultFormatter() *Formatter {
+	return &Formatter{Clock: Real{}, Location: time.UTC, Layout: DEFAULT_TIME_LAYOUT}
+}
+
+func InitFormatter() *Formatter {
+	f := DefaultFormatter()
+	if name := viper.GetString("TIMEZONE"); name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			log.Fatalf("TIMEZONE '%s' is invalid: %v", name, err)
+		}
+		f.Location = location
+	}
+	if layout := viper.GetString("TIME_LAYOUT"); layout != "" {
+		f.Layout = layout
+	}
+	return f
+}
+
+func (f *Formatter) SetClock(c Clock) {
+	f.Clock = c
+}
+
+// Now is the time of the clock in the location
+func (f *Formatter) Now() time.Time {
+	return f.Clock.Now().In(f.Location)
+}
+
+func (f *Formatter) In(t time.Time) time.Time {
+	return t.In(f.Location)
+}
+
+func (f *Formatter) Format(t time.Time) string {
+	return t.In(f.Location).Format(f.Layout)
+}
+
+func (f *Formatter) FormatNow() string {
+	return f.Format(f.Clock.Now())
+}
+
+// Day is the date in the location, days of daily limits and summaries start at midnight of TIMEZONE
+func (f *Formatter) Day(t time.Time) string {
+	return t.In(f.Location).Format(DAY_LAYOUT)
+}
+
+func (f *Formatter) Today() string {
+	return f.Day(f.Clock.Now())
+}
+
+// ParseDay is the midnight of the date in the location
+func (f *Formatter) ParseDay(day string) (time.Time, error) {
+	return time.ParseInLocation(DAY_LAYOUT, day, f.Location)
+}
@@ -0,0 +1,89 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestFormatter(t *testing.T, name string, now time.Time) (*Formatter, *Sim) {
+	t.Helper()
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := &Sim{}
+	sim.Set(now)
+	f := &Formatter{Clock: Real{}, Location: location, Layout: DEFAULT_TIME_LAYOUT}
+	f.SetClock(sim)
+	return f, sim
+}
+
+func TestFormatterNow(t *testing.T) {
+	now := time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC)
+	f, _ := newTestFormatter(t, "Asia/Taipei", now)
+
+	if got := f.Now(); !got.Equal(now) || got.Location().String() != "Asia/Taipei" {
+		t.Errorf("Now() = %v, want %v in Asia/Taipei", got, now)
+	}
+	if got, want := f.FormatNow(), "2024-03-01 23:30:00 CST"; got != want {
+		t.Errorf("FormatNow() = %q, want %q", got, want)
+	}
+
+	f.Layout = time.RFC3339
+	if got, want := f.Format(now), "2024-03-01T23:30:00+08:00"; got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+}
+
+func TestFormatterDayBoundary(t *testing.T) {
+	// 15:59 UTC is 23:59 in Taipei, the day rolls over one minute later
+	f, sim := newTestFormatter(t, "Asia/Taipei", time.Date(2024, 3, 1, 15, 59, 0, 0, time.UTC))
+	if got := f.Today(); got != "2024-03-01" {
+		t.Errorf("Today() = %s, want 2024-03-01", got)
+	}
+	sim.Set(time.Date(2024, 3, 1, 16, 0, 0, 0, time.UTC))
+	if got := f.Today(); got != "2024-03-02" {
+		t.Errorf("Today() = %s, want 2024-03-02", got)
+	}
+
+	// DST, New York moves from -05:00 to -04:00 on 2024-03-10
+	f, sim = newTestFormatter(t, "America/New_York", time.Date(2024, 3, 10, 4, 59, 0, 0, time.UTC))
+	if got := f.Today(); got != "2024-03-09" {
+		t.Errorf("Today() = %s, want 2024-03-09", got)
+	}
+	sim.Set(time.Date(2024, 3, 11, 3, 59, 0, 0, time.UTC))
+	if got := f.Today(); got != "2024-03-10" {
+		t.Errorf("Today() = %s, want 2024-03-10", got)
+	}
+	sim.Set(time.Date(2024, 3, 11, 4, 0, 0, 0, time.UTC))
+	if got := f.Today(); got != "2024-03-11" {
+		t.Errorf("Today() = %s, want 2024-03-11", got)
+	}
+}
+
+func TestFormatterParseDay(t *testing.T) {
+	f, _ := newTestFormatter(t, "Asia/Taipei", time.Time{})
+	midnight, err := f.ParseDay("2024-03-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2024, 3, 1, 16, 0, 0, 0, time.UTC); !midnight.Equal(want) {
+		t.Errorf("ParseDay() = %v, want %v", midnight, want)
+	}
+	if _, err = f.ParseDay("2024/03/02"); err == nil {
+		t.Error("ParseDay() of an invalid date doesn't fail")
+	}
+}
+
+func TestDefaultFormatterIsUTC(t *testing.T) {
+	f := DefaultFormatter()
+	sim := &Sim{}
+	sim.Set(time.Date(2024, 3, 1, 23, 59, 59, 0, time.FixedZone("X", -3600)))
+	f.SetClock(sim)
+	if got, want := f.FormatNow(), "2024-03-02 00:59:59 UTC"; got != want {
+		t.Errorf("FormatNow() = %q, want %q", got, want)
+	}
+	if got := f.Today(); got != "2024-03-02" {
+		t.Errorf("Today() = %s, want 2024-03-02", got)
+	}
+}
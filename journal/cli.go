@@ -0,0 +1,118 @@
+package journal
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+// RunCommand handles `journal <pnl|fees|list> [flags]`
+//
+//	journal pnl --by=day --from=2023-11-01 --to=2023-11-30
+//	journal fees
+//	journal list --type=order --limit=20
+func RunCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal("usage: journal <pnl|fees|list> [flags]")
+	}
+	fs := flag.NewFlagSet("journal "+args[0], flag.ExitOnError)
+	path := fs.String("path", viper.GetString("JOURNAL_PATH"), "journal file")
+	by := fs.String("by", BY_DAY, "cycle, combination or day")
+	from := fs.String("from", "", "from date (TIMEZONE) e.g. 2023-11-01")
+	to := fs.String("to", "", "to date (TIMEZONE), inclusive")
+	recordType := fs.String("type", "", "record type")
+	limit := fs.Int("limit", 20, "latest N records")
+	fs.Parse(args[1:])
+	if *path == "" {
+		*path = DEFAULT_PATH
+	}
+
+	formatter := clock.InitFormatter()
+	filter, err := dateFilter(formatter, *from, *to)
+	if err != nil {
+		log.Fatal(err)
+	}
+	records, err := ReadAll(*path, filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	switch args[0] {
+	case "pnl":
+		summaries, err := SummarizePnl(records, *by, formatter)
+		if err != nil {
+			log.Fatal(err)
+		}
+		total := decimal.Zero
+		fmt.Fprintf(w, "%s\tcycles\twins\tstart\tpnl\n", *by)
+		for _, s := range summaries {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n", s.Key, s.Cycles, s.Wins, s.Start.StringFixed(2), s.Pnl.StringFixed(4))
+			total = total.Add(s.Pnl)
+		}
+		fmt.Fprintf(w, "total\t\t\t\t%s\n", total.StringFixed(4))
+	case "fees":
+		fees := SummarizeFees(records)
+		var coins []string
+		for coin := range fees {
+			coins = append(coins, coin)
+		}
+		sort.Strings(coins)
+		fmt.Fprintln(w, "coin\tfee")
+		for _, coin := range coins {
+			fmt.Fprintf(w, "%s\t%s\n", coin, fees[coin].String())
+		}
+	case "list":
+		var list []*Record
+		for _, rec := range records {
+			if *recordType == "" || rec.Type == *recordType {
+				list = append(list, rec)
+			}
+		}
+		if len(list) > *limit {
+			list = list[len(list)-*limit:]
+		}
+		fmt.Fprintln(w, "ts\ttype\tcycle\tcombination\tsymbol\tside\tstatus\tqty\tprice\tfee\tpnl")
+		for _, rec := range list {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s %s\t%s\n",
+				formatter.In(rec.Ts).Format(time.RFC3339), rec.Type, rec.CycleId, rec.Combination, rec.Symbol, rec.Side, rec.Status,
+				rec.Qty, rec.Price, rec.Fee, rec.FeeCoin, rec.Pnl)
+		}
+	default:
+		log.Fatalf("journal command '%s' not supported", args[0])
+	}
+}
+
+func dateFilter(f *clock.Formatter, from string, to string) (func(*Record) bool, error) {
+	var fromTime, toTime time.Time
+	var err error
+	if from != "" {
+		if fromTime, err = f.ParseDay(from); err != nil {
+			return nil, err
+		}
+	}
+	if to != "" {
+		if toTime, err = f.ParseDay(to); err != nil {
+			return nil, err
+		}
+		toTime = toTime.AddDate(0, 0, 1)
+	}
+	return func(rec *Record) bool {
+		if !fromTime.IsZero() && rec.Ts.Before(fromTime) {
+			return false
+		}
+		if !toTime.IsZero() && !rec.Ts.Before(toTime) {
+			return false
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,130 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+const (
+	TYPE_OPPORTUNITY = "opportunity"
+	TYPE_ORDER       = "order"
+	TYPE_FILL        = "fill"
+	TYPE_CYCLE       = "cycle"
+	TYPE_EPISODE     = "episode"
+
+	DEFAULT_PATH = "journal.jsonl"
+)
+
+// Journal is an append-only JSONL file, one record per line
+type Journal struct {
+	Path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Record is a union of all types, only the related fields are set. Amounts of cycles and opportunities are in trade.HOME_COIN
+type Record struct {
+	Type        string          `json:"type"`
+	Ts          time.Time       `json:"ts"`
+	CycleId     int64           `json:"cycle_id,omitempty"`
+	Combination string          `json:"combination,omitempty"`
+	Symbol      string          `json:"symbol,omitempty"`
+	Side        string          `json:"side,omitempty"`
+	OrderId     string          `json:"order_id,omitempty"`
+	OrderLinkId string          `json:"order_link_id,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	Qty         decimal.Decimal `json:"qty"`
+	Price       decimal.Decimal `json:"price"`
+	Value       decimal.Decimal `json:"value"`
+	Fee         decimal.Decimal `json:"fee"`
+	FeeCoin     string          `json:"fee_coin,omitempty"`
+	Start       decimal.Decimal `json:"start"`
+	End         decimal.Decimal `json:"end"`
+	Pnl         decimal.Decimal `json:"pnl"`
+	DurationMs  int64           `json:"duration_ms,omitempty"`
+	Updates     int64           `json:"updates,omitempty"`
+	PeakProfit  decimal.Decimal `json:"peak_profit"`
+	AvgProfit   decimal.Decimal `json:"avg_profit"`
+	Size        decimal.Decimal `json:"size"`
+	Error       string          `json:"error,omitempty"`
+}
+
+func Init() *Journal {
+	path := viper.GetString("JOURNAL_PATH")
+	if path == "" {
+		path = DEFAULT_PATH
+	}
+	return Open(path)
+}
+
+func Open(path string) *Journal {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatalf("Error opening journal '%s': %v", path, err)
+	}
+	return &Journal{Path: path, file: file}
+}
+
+func (j *Journal) Record(rec Record) {
+	if rec.Ts.IsZero() {
+		rec.Ts = time.Now()
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		log.Printf("Error marshaling journal record: %v", err)
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err = j.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing journal record: %v", err)
+	}
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.file.Close()
+}
+
+// Records reads the journal while it's being written, the lock prevents reading a partial line
+func (j *Journal) Records(filter func(*Record) bool) ([]*Record, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return ReadAll(j.Path, filter)
+}
+
+// ReadAll loads records of the journal file, filter is skipped if it's nil
+func ReadAll(path string, filter func(*Record) bool) ([]*Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d is invalid, err: %v", lineNum, err)
+		}
+		if filter == nil || filter(&rec) {
+			records = append(records, &rec)
+		}
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,76 @@
+package journal
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	BY_CYCLE       = "cycle"
+	BY_COMBINATION = "combination"
+	BY_DAY         = "day"
+)
+
+type PnlSummary struct {
+	Key    string
+	Cycles int
+	Wins   int
+	Start  decimal.Decimal
+	Pnl    decimal.Decimal
+}
+
+// SummarizePnl groups realised pnl of cycle records by cycle, combination or day of the formatter (TIMEZONE)
+func SummarizePnl(records []*Record, by string, f *clock.Formatter) ([]*PnlSummary, error) {
+	summaryMap := make(map[string]*PnlSummary)
+	for _, rec := range records {
+		if rec.Type != TYPE_CYCLE {
+			continue
+		}
+		var key string
+		switch by {
+		case BY_CYCLE:
+			key = strconv.FormatInt(rec.CycleId, 10)
+		case BY_COMBINATION:
+			key = rec.Combination
+		case BY_DAY:
+			key = f.Day(rec.Ts)
+		default:
+			return nil, fmt.Errorf("'%s' not supported", by)
+		}
+		summary, ok := summaryMap[key]
+		if !ok {
+			summary = &PnlSummary{Key: key}
+			summaryMap[key] = summary
+		}
+		summary.Cycles++
+		if rec.Pnl.IsPositive() {
+			summary.Wins++
+		}
+		summary.Start = summary.Start.Add(rec.Start)
+		summary.Pnl = summary.Pnl.Add(rec.Pnl)
+	}
+
+	var summaries []*PnlSummary
+	for _, summary := range summaryMap {
+		summaries = append(summaries, summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Key < summaries[j].Key
+	})
+	return summaries, nil
+}
+
+// SummarizeFees sums fees of fills by coin
+func SummarizeFees(records []*Record) map[string]decimal.Decimal {
+	fees := make(map[string]decimal.Decimal)
+	for _, rec := range records {
+		if rec.Type == TYPE_FILL {
+			fees[rec.FeeCoin] = fees[rec.FeeCoin].Add(rec.Fee)
+		}
+	}
+	return fees
+}
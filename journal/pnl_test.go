@@ -0,0 +1,40 @@
+package journal
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSummarizePnlByDayInTimezone(t *testing.T) {
+	location, err := time.LoadLocation("Asia/Taipei")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &clock.Formatter{Clock: clock.Real{}, Location: location, Layout: clock.DEFAULT_TIME_LAYOUT}
+	records := []*Record{
+		// 23:59 and 00:00 in Taipei, the same UTC day
+		{Type: TYPE_CYCLE, Ts: time.Date(2024, 3, 1, 15, 59, 0, 0, time.UTC), Start: decimal.NewFromInt(100), Pnl: decimal.NewFromInt(1)},
+		{Type: TYPE_CYCLE, Ts: time.Date(2024, 3, 1, 16, 0, 0, 0, time.UTC), Start: decimal.NewFromInt(100), Pnl: decimal.NewFromInt(-2)},
+		{Type: TYPE_FILL, Ts: time.Date(2024, 3, 1, 16, 0, 0, 0, time.UTC)},
+	}
+	summaries, err := SummarizePnl(records, BY_DAY, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("got %d days, want 2", len(summaries))
+	}
+	if summaries[0].Key != "2024-03-01" || !summaries[0].Pnl.Equal(decimal.NewFromInt(1)) || summaries[0].Wins != 1 {
+		t.Errorf("first day = %+v", summaries[0])
+	}
+	if summaries[1].Key != "2024-03-02" || !summaries[1].Pnl.Equal(decimal.NewFromInt(-2)) || summaries[1].Wins != 0 {
+		t.Errorf("second day = %+v", summaries[1])
+	}
+
+	if _, err = SummarizePnl(records, "week", f); err == nil {
+		t.Error("unsupported key doesn't fail")
+	}
+}
@@ -1,14 +1,25 @@
 package main
 
 import (
+	"crypto-triangular-arbitrage-watch/alert"
+	"crypto-triangular-arbitrage-watch/backtest"
 	"crypto-triangular-arbitrage-watch/bybit"
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/journal"
 	"crypto-triangular-arbitrage-watch/notification"
+	"crypto-triangular-arbitrage-watch/recorder"
+	"crypto-triangular-arbitrage-watch/report"
+	"crypto-triangular-arbitrage-watch/risk"
 	"crypto-triangular-arbitrage-watch/runner"
+	"crypto-triangular-arbitrage-watch/server"
 	"crypto-triangular-arbitrage-watch/trade"
 	"crypto-triangular-arbitrage-watch/tri"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/spf13/viper"
 )
@@ -16,33 +27,123 @@ import (
 func main() {
 	loadEnvConfig()
 
-	slack := notification.Init()
-	// Listen incoming messages and store these messages into buffer, so that it won't reach the rate limits of slack
-	go slack.HandleChannelSystemLogs()
-	slack.SystemLogs("Config has been loaded successfully.")
-	slack.SystemLogs(fmt.Sprintf("ENV: %s", viper.GetString("ENV")))
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "journal":
+			journal.RunCommand(os.Args[2:])
+		case "backtest":
+			backtest.RunCommand(os.Args[2:])
+		default:
+			log.Fatalf("command '%s' not supported", os.Args[1])
+		}
+		return
+	}
+
+	formatter := clock.InitFormatter()
+	notifier := notification.Init()
+	notifier.SetFormatter(formatter)
+	// Messages of system logs are combined and flushed periodically, so that it won't reach the rate limits of slack
+	go notifier.Listen()
+	notifier.SystemLogs("Config has been loaded successfully.")
+	notifier.SystemLogs(fmt.Sprintf("ENV: %s", viper.GetString("ENV")))
 	log.Println("DEBUG_PRINT_MESSAGE:", viper.GetBool("DEBUG_PRINT_MESSAGE"))
 	log.Println("DEBUG_PRINT_MOST_PROFIT:", viper.GetBool("DEBUG_PRINT_MOST_PROFIT"))
 
 	tri := tri.Init()
 	tri.Build()
-	tri.SetSlack(slack)
+	tri.SetNotifier(notifier)
 	tri.PrintAllSymbols()
 	// tri.printAllCombinations()
 
+	jou := journal.Init()
+
 	orderbookRunner := runner.Init(tri)
-	orderbookRunner.SetSlack(slack)
+	orderbookRunner.SetNotifier(notifier)
+	orderbookRunner.SetFormatter(formatter)
+	orderbookRunner.SetJournal(jou)
 	go orderbookRunner.ListenAll()
 
 	// Trade
 	tra := trade.Init()
+	ris := risk.Init(tri)
+	ris.SetNotifier(notifier)
+	ris.SetFormatter(formatter)
+	ris.SetInventory(tra.Inventory)
+	api := bybit.InitApi()
+	api.SetTri(tri)
+	api.SetRisk(ris)
+	api.SetInventory(tra.Inventory)
+	api.SetJournal(jou)
+	if err := api.SeedInventory(tra.Inventory); err != nil {
+		notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_WARNING, fmt.Sprintf("Failed to load wallet balance, err: %v", err))
+	}
+
+	// Kill switch
+	ks := risk.InitKillSwitch()
+	ks.SetNotifier(notifier)
+	ks.SetUnwinder(func() { api.Unwind(tra.Inventory.Frees()) })
+	ks.SetClockSkewChecker(api.ClockSkew)
+	ris.SetKillSwitch(ks)
+	api.SetKillSwitch(ks)
+	go ks.Listen()
 
 	// Have to be after initTri as it will set klines
 	ws := bybit.InitWs()
 	ws.SetTrade(tra)
 	ws.SetTri(tri)
 	ws.SetOrderbookRunner(orderbookRunner)
-	ws.SetSlack(slack)
+	ws.SetNotifier(notifier)
+	ws.SetKillSwitch(ks)
+	ws.SetJournal(jou)
+	// Alert rules, all opportunities go to the watch channel if ALERT_RULES is empty
+	if engine := alert.Init(notifier); engine != nil {
+		engine.SetConnStates(ws.ConnStates)
+		engine.SetFormatter(formatter)
+		orderbookRunner.SetAlerter(engine)
+		go engine.Listen()
+	}
+	// Scheduled summary reports
+	if rep := report.Init(); rep != nil {
+		rep.SetNotifier(notifier)
+		rep.SetJournal(jou)
+		rep.SetFormatter(formatter)
+		rep.SetConnStates(ws.ConnStates)
+		rep.SetWallets(tra.Inventory.Wallets)
+		go rep.Listen()
+	}
+	rec := recorder.Init()
+	if rec != nil {
+		go rec.Listen()
+		ws.SetRecorder(rec)
+	}
+	// Finish the recorder file on shutdown, otherwise the frames after the last flush are lost
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		if err := rec.Stop(); err != nil {
+			log.Printf("Failed to close the recorder, err: %v", err)
+		}
+		os.Exit(0)
+	}()
+
+	// HTTP server
+	srv := server.Init()
+	srv.SetNotifier(notifier)
+	srv.SetFormatter(formatter)
+	srv.SetKillSwitch(ks)
+	srv.SetTri(tri)
+	srv.SetOrderbookRunner(orderbookRunner)
+	srv.SetWs(ws)
+	srv.SetJournal(jou)
+	go srv.ListenAndServe()
+
+	// Order entry over the trade websocket, REST is the fallback
+	if viper.GetString("BYBIT_TRADE_WS") != "" {
+		api.SetOrderSender(ws)
+		go ws.HandleTradeChannel()
+	}
 	go ws.HandlePrivateChannel() // block
 	ws.HandlePublicChannel()     // block
 }
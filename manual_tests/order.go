@@ -2,7 +2,10 @@ package main
 
 import (
 	"crypto-triangular-arbitrage-watch/bybit"
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/journal"
 	"crypto-triangular-arbitrage-watch/notification"
+	"crypto-triangular-arbitrage-watch/risk"
 	"crypto-triangular-arbitrage-watch/runner"
 	"crypto-triangular-arbitrage-watch/trade"
 	"crypto-triangular-arbitrage-watch/tri"
@@ -30,16 +33,20 @@ func main() {
 
 	limit := flag.Int("limit", 1, "")
 
+	// Limit orders, market orders if it's empty
+	price := flag.String("price", "", "Limit price")
+	tif := flag.String("tif", "", "Time in force of limit orders: GTC, IOC, FOK or PostOnly")
+
 	// Parse the flags.
 	flag.Parse()
 
 	switch *action {
 	case trade.SIDE_BUY, trade.SIDE_SELL:
 		loadEnvConfig("")
-		placeOrder(*action, *sym, *qty)
+		placeOrder(*action, *sym, *qty, *price, *tif)
 	case "trii":
 		loadEnvConfig("")
-		trii(*qty)
+		trii(*qty, *tif)
 	case "instrument":
 		loadEnvConfig("prod-config")
 		instrument(*sym)
@@ -73,7 +80,7 @@ func loadEnvConfig(config string) {
 	fmt.Printf("ENV: %s\n", viper.GetString("ENV"))
 }
 
-func placeOrder(side string, sym string, qty string) {
+func placeOrder(side string, sym string, qty string, price string, tif string) {
 	tri := tri.Init()
 	tri.Build()
 	api := bybit.InitApi()
@@ -82,40 +89,61 @@ func placeOrder(side string, sym string, qty string) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	resp, err := api.PlaceOrder(side, sym, decimalQty)
+	var resp *bybit.OrderResp
+	if price == "" {
+		resp, err = api.PlaceOrder(side, sym, decimalQty)
+	} else {
+		var decimalPrice decimal.Decimal
+		if decimalPrice, err = decimal.NewFromString(price); err != nil {
+			log.Fatal(err)
+		}
+		if tif == "" {
+			tif = trade.TIME_IN_FORCE_GTC
+		}
+		resp, err = api.PlaceLimitOrder(side, sym, decimalQty, decimalPrice, tif)
+	}
 	if err != nil {
 		log.Println("err:", err)
 		return
 	}
-	log.Println(resp)
+	log.Printf("resp %+v\n", resp)
 }
 
-func trii(qty string) {
-	// slack
-	slack := notification.Init()
-	go slack.HandleChannelSystemLogs()
+// tif places IOC/FOK limit legs at the quoted prices instead of market orders
+func trii(qty string, tif string) {
+	// notifier
+	formatter := clock.InitFormatter()
+	notifier := notification.Init()
+	notifier.SetFormatter(formatter)
+	go notifier.Listen()
 
 	// tri
 	tri := tri.Init()
 	tri.Build()
-	tri.SetSlack(slack)
+	tri.SetNotifier(notifier)
 	tri.PrintAllSymbols()
 	tri.PrintAllCombinations()
 
 	// ordrebookRunner
 	orderbookRunner := runner.Init(tri)
 	orderbookRunner.CalculateTriArb = false
-	orderbookRunner.SetSlack(slack)
+	orderbookRunner.SetNotifier(notifier)
+	orderbookRunner.SetFormatter(formatter)
 	go orderbookRunner.ListenAll()
 
 	triTrade := trade.Init()
+	triRisk := risk.Init(tri)
+	triRisk.SetNotifier(notifier)
+	triRisk.SetKillSwitch(risk.InitKillSwitch())
+	triJournal := journal.Init()
 
 	// bybit
 	ws := bybit.InitWs()
 	ws.SetTri(tri)
 	ws.SetTrade(triTrade)
 	ws.SetOrderbookRunner(orderbookRunner)
-	ws.SetSlack(slack)
+	ws.SetNotifier(notifier)
+	ws.SetJournal(triJournal)
 	go ws.HandlePrivateChannel()
 	go ws.HandlePublicChannel() // block
 
@@ -137,53 +165,104 @@ func trii(qty string) {
 	log.Printf("Will use this combination: %s -> %s -> %s\n", combination.SymbolOrders[0].Symbol, combination.SymbolOrders[1].Symbol, combination.SymbolOrders[2].Symbol)
 
 	// Tri trade
+	triRisk.SetInventory(triTrade.Inventory)
 	api := bybit.InitApi()
 	api.SetTri(tri)
+	api.SetRisk(triRisk)
+	api.SetInventory(triTrade.Inventory)
+	api.SetFills(triTrade.Fills)
+	api.SetJournal(triJournal)
+	if err := api.SeedInventory(triTrade.Inventory); err != nil {
+		log.Fatal(err)
+	}
 
 	decimalQty, err := decimal.NewFromString(qty)
 	if err != nil {
 		log.Fatal(err)
 	}
+	cycleId, err := triRisk.BeginCycle(decimalQty)
+	if err != nil {
+		log.Fatal(err)
+	}
+	placeLeg := func(side string, symbol string, qty decimal.Decimal) (*bybit.OrderResp, error) {
+		if tif == "" {
+			return api.PlaceOrder(side, symbol, qty)
+		}
+		price := tri.SymbolOrdersMap[symbol].Ask.Price
+		if side == trade.SIDE_SELL {
+			price = tri.SymbolOrdersMap[symbol].Bid.Price
+		}
+		return api.PlaceLimitOrder(side, symbol, qty, price, tif)
+	}
 
 	// 1st trade
-	resp, err := api.PlaceOrder(trade.SIDE_BUY, combination.SymbolOrders[0].Symbol, decimalQty)
+	resp, err := placeLeg(trade.SIDE_BUY, combination.SymbolOrders[0].Symbol, decimalQty)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Printf("1st %s resp %+v\n", combination.SymbolOrders[0].Symbol, resp)
-	tradeQty := <-triTrade.Qty
+	tradeQty := waitFill(triTrade, resp)
 	log.Println("1st qty:", tradeQty)
+	if tradeQty.IsZero() {
+		log.Fatal("1st leg isn't filled")
+	}
 
 	// 2nd trade
 	if combination.BaseQuote {
 		fmt.Println("2nd sell")
-		resp, err = api.PlaceOrder(trade.SIDE_SELL, combination.SymbolOrders[1].Symbol, tradeQty)
+		resp, err = placeLeg(trade.SIDE_SELL, combination.SymbolOrders[1].Symbol, tradeQty)
 	} else {
 		fmt.Println("2nd buy")
-		resp, err = api.PlaceOrder(trade.SIDE_BUY, combination.SymbolOrders[1].Symbol, tradeQty)
+		resp, err = placeLeg(trade.SIDE_BUY, combination.SymbolOrders[1].Symbol, tradeQty)
 	}
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Printf("2nd %s resp %+v\n", combination.SymbolOrders[1].Symbol, resp)
-	tradeQty = <-triTrade.Qty
+	tradeQty = waitFill(triTrade, resp)
 	log.Println("2nd qty:", tradeQty)
+	if tradeQty.IsZero() {
+		log.Fatal("2nd leg isn't filled")
+	}
 
 	// 3rd trade
-	resp, err = api.PlaceOrder(trade.SIDE_SELL, combination.SymbolOrders[2].Symbol, tradeQty)
+	resp, err = placeLeg(trade.SIDE_SELL, combination.SymbolOrders[2].Symbol, tradeQty)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Printf("3rd %s resp %+v\n", combination.SymbolOrders[2].Symbol, resp)
-	tradeQty = <-triTrade.Qty
+	tradeQty = waitFill(triTrade, resp)
 	log.Println("3rd qty:", tradeQty)
+	if tradeQty.IsZero() {
+		log.Fatal("3rd leg isn't filled")
+	}
 	log.Printf("Done! %s -> %s", decimalQty.String(), tradeQty.String())
+	triJournal.Record(journal.Record{
+		Type:        journal.TYPE_CYCLE,
+		CycleId:     cycleId,
+		Combination: combination.Name(),
+		Start:       decimalQty,
+		End:         tradeQty,
+		Pnl:         tradeQty.Sub(decimalQty),
+	})
+	if err = triRisk.EndCycle(cycleId, tradeQty.Sub(decimalQty)); err != nil {
+		log.Fatal(err)
+	}
 
 	// TODO some issues with ETHUSDT -> ETHBTC -> BTCUSDT
 	// TODO order.spot might miss to notfiy order status, need to check by myself via order history api
 	// TODO retry logic for cancelled
 }
 
+// waitFill blocks until the leg is done, its filled qty is delivered by the private channel
+func waitFill(triTrade *trade.Trade, resp *bybit.OrderResp) decimal.Decimal {
+	qty, ok := triTrade.Fills.Wait(resp.Result.OrderLinkId)
+	if !ok {
+		log.Fatalf("orderLinkId '%s' isn't expected", resp.Result.OrderLinkId)
+	}
+	return qty
+}
+
 // TESTNET doesn't have MNTBTC, use prod bybit host
 func instrument(sym string) {
 	api := bybit.InitApi()
@@ -227,12 +306,15 @@ func generateInstruments(env string) {
 		}
 		if len(resp.Result.List) > 0 {
 			result[sym] = map[string]string{
+				"base_coin":       resp.Result.List[0].BaseCoin,
+				"quote_coin":      resp.Result.List[0].QuoteCoin,
 				"base_precision":  resp.Result.List[0].LotSizeFilter.BasePrecision,
 				"quote_precision": resp.Result.List[0].LotSizeFilter.QuotePrecision,
 				"min_order_qty":   resp.Result.List[0].LotSizeFilter.MinOrderQty,
 				"max_order_qty":   resp.Result.List[0].LotSizeFilter.MaxOrderQty,
 				"min_order_amt":   resp.Result.List[0].LotSizeFilter.MinOrderAmt,
 				"max_order_amt":   resp.Result.List[0].LotSizeFilter.MaxOrderAmt,
+				"tick_size":       resp.Result.List[0].PriceFilter.TickSize,
 			}
 		} else {
 			log.Printf("symbol: %s  no list", sym)
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stages of the pipeline, each one is measured from the previous timestamp
+//
+//	exchange event (ts) -> socket read -> queue dequeue -> calculation end
+//	order send -> REST ack -> fill event
+const (
+	STAGE_EXCHANGE_TO_READ     = "exchange_to_read"
+	STAGE_READ_TO_DEQUEUE      = "read_to_dequeue"
+	STAGE_DEQUEUE_TO_CALCULATE = "dequeue_to_calculate"
+	STAGE_EXCHANGE_TO_DECISION = "exchange_to_decision" // exchange event -> calculation end
+	STAGE_SEND_TO_ACK          = "send_to_ack"
+	STAGE_ACK_TO_FILL          = "ack_to_fill"
+	STAGE_SEND_TO_FILL         = "send_to_fill"
+
+	// Orders without fill events are dropped after this
+	ORDER_TIMESTAMPS_TTL_MINUTE = 10
+)
+
+var Latency = NewHistogramVec("tri_latency_seconds", "Latency of each stage of the pipeline.", "stage", ExponentialBuckets(0.0001, 2, 18))
+
+// Timestamps are captured along the way of an orderbook update, zero means it isn't captured e.g. replay
+type Timestamps struct {
+	Exchange   time.Time
+	Read       time.Time
+	Dequeue    time.Time
+	Calculated time.Time
+}
+
+func ObserveLatency(stage string, from time.Time, to time.Time) {
+	if from.IsZero() || to.IsZero() {
+		return
+	}
+	Latency.With(stage).Observe(to.Sub(from).Seconds())
+}
+
+// ObserveOrderbook is called once the calculation of the orderbook update is done
+func ObserveOrderbook(ts Timestamps) {
+	ObserveLatency(STAGE_EXCHANGE_TO_READ, ts.Exchange, ts.Read)
+	ObserveLatency(STAGE_READ_TO_DEQUEUE, ts.Read, ts.Dequeue)
+	ObserveLatency(STAGE_DEQUEUE_TO_CALCULATE, ts.Dequeue, ts.Calculated)
+	ObserveLatency(STAGE_EXCHANGE_TO_DECISION, ts.Exchange, ts.Calculated)
+}
+
+type orderTimestamps struct {
+	send time.Time
+	ack  time.Time
+}
+
+var orders = struct {
+	mu sync.Mutex
+	m  map[string]*orderTimestamps // orderLinkId -> timestamps
+}{m: make(map[string]*orderTimestamps)}
+
+// ObserveOrderAck is called once the ack of the order is received, from the trade websocket or REST
+func ObserveOrderAck(orderLinkId string, send time.Time, ack time.Time) {
+	ObserveLatency(STAGE_SEND_TO_ACK, send, ack)
+
+	orders.mu.Lock()
+	defer orders.mu.Unlock()
+	for id, ts := range orders.m {
+		if ack.Sub(ts.send) > time.Duration(ORDER_TIMESTAMPS_TTL_MINUTE)*time.Minute {
+			delete(orders.m, id)
+		}
+	}
+	orders.m[orderLinkId] = &orderTimestamps{send: send, ack: ack}
+}
+
+// ObserveOrderFill is called when the first fill event of the order is read from the private channel
+func ObserveOrderFill(orderLinkId string, read time.Time) {
+	orders.mu.Lock()
+	ts, ok := orders.m[orderLinkId]
+	delete(orders.m, orderLinkId)
+	orders.mu.Unlock()
+	if !ok {
+		return
+	}
+	ObserveLatency(STAGE_ACK_TO_FILL, ts.ack, read)
+	ObserveLatency(STAGE_SEND_TO_FILL, ts.send, read)
+}
+
+// LatencySummary keeps the previous snapshots, so each summary only covers the observations since the last one
+type LatencySummary struct {
+	prev map[string]HistogramSnapshot
+}
+
+func InitLatencySummary() *LatencySummary {
+	return &LatencySummary{prev: make(map[string]HistogramSnapshot)}
+}
+
+// e.g. `latency(ms) exchange_to_read n=120 p50=12.1 p90=30.5 p99=80.2`
+func (ls *LatencySummary) Summarize() string {
+	var lines []string
+	for _, stage := range Latency.labelValues() {
+		snapshot := Latency.With(stage).Snapshot()
+		diff := snapshot.Sub(ls.prev[stage])
+		ls.prev[stage] = snapshot
+		if diff.Count == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("latency(ms) %s n=%d p50=%.1f p90=%.1f p99=%.1f",
+			stage, diff.Count, diff.Quantile(0.5)*1000, diff.Quantile(0.9)*1000, diff.Quantile(0.99)*1000))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
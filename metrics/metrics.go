@@ -0,0 +1,194 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Registry holds all metrics, it's exported in the Prometheus text format
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler serves GET /metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Default.WritePrometheus(w)
+	})
+}
+
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64 // upper bounds
+	counts  []uint64  // not cumulative, the last one is +Inf
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+type HistogramSnapshot struct {
+	Buckets []float64
+	Counts  []uint64
+	Sum     float64
+	Count   uint64
+}
+
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  append([]uint64(nil), h.counts...),
+		Sum:     h.sum,
+		Count:   h.count,
+	}
+}
+
+// Sub returns the observations since the previous snapshot
+func (s HistogramSnapshot) Sub(prev HistogramSnapshot) HistogramSnapshot {
+	diff := HistogramSnapshot{Buckets: s.Buckets, Counts: make([]uint64, len(s.Counts)), Sum: s.Sum - prev.Sum, Count: s.Count - prev.Count}
+	for i := range s.Counts {
+		diff.Counts[i] = s.Counts[i]
+		if i < len(prev.Counts) {
+			diff.Counts[i] -= prev.Counts[i]
+		}
+	}
+	return diff
+}
+
+// Quantile is estimated by linear interpolation inside the bucket, like histogram_quantile() of Prometheus
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := q * float64(s.Count)
+	var cumulative uint64
+	for i, c := range s.Counts {
+		if float64(cumulative+c) < rank {
+			cumulative += c
+			continue
+		}
+		// +Inf bucket, the best guess is the highest bound
+		if i == len(s.Buckets) {
+			return s.Buckets[len(s.Buckets)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = s.Buckets[i-1]
+		}
+		if c == 0 {
+			return s.Buckets[i]
+		}
+		return lower + (s.Buckets[i]-lower)*(rank-float64(cumulative))/float64(c)
+	}
+	return s.Buckets[len(s.Buckets)-1]
+}
+
+// HistogramVec is a histogram partitioned by one label
+type HistogramVec struct {
+	name    string
+	help    string
+	label   string
+	buckets []float64
+	mu      sync.Mutex
+	m       map[string]*Histogram
+}
+
+func NewHistogramVec(name string, help string, label string, buckets []float64) *HistogramVec {
+	v := &HistogramVec{name: name, help: help, label: label, buckets: buckets, m: make(map[string]*Histogram)}
+	Default.register(v)
+	return v
+}
+
+func (v *HistogramVec) With(labelValue string) *Histogram {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	h, ok := v.m[labelValue]
+	if !ok {
+		h = newHistogram(v.buckets)
+		v.m[labelValue] = h
+	}
+	return h
+}
+
+func (v *HistogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", v.name, v.help, v.name)
+	for _, labelValue := range v.labelValues() {
+		s := v.With(labelValue).Snapshot()
+		var cumulative uint64
+		for i, c := range s.Counts {
+			cumulative += c
+			le := "+Inf"
+			if i < len(s.Buckets) {
+				le = formatFloat(s.Buckets[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{%s=%q,le=%q} %d\n", v.name, v.label, labelValue, le, cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum{%s=%q} %s\n", v.name, v.label, labelValue, formatFloat(s.Sum))
+		fmt.Fprintf(w, "%s_count{%s=%q} %d\n", v.name, v.label, labelValue, s.Count)
+	}
+}
+
+func (v *HistogramVec) labelValues() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var values []string
+	for value := range v.m {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// e.g. 0.0005, 0.001, 0.002 ... for latency in seconds
+func ExponentialBuckets(start float64, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
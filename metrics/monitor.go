@@ -0,0 +1,30 @@
+package metrics
+
+// Metrics of the monitor, they are exported at GET /metrics
+var (
+	Messages             = NewCounterVec("tri_messages_total", "Websocket messages received per topic.", "topic")
+	Reconnects           = NewCounterVec("tri_reconnects_total", "Websocket reconnections per connection.", "conn")
+	QueueDepth           = NewGaugeVec("tri_queue_depth", "Number of items waiting in the queue.", "queue")
+	Calculations         = NewCounterVec("tri_calculations_total", "Triangular arbitrage calculations, rate() gives calculations per second.", "")
+	Profit               = NewGaugeVec("tri_combination_profit", "Latest evaluated profit per combination (0.001 = 0.1%).", "combination")
+	BestProfit           = NewPeakGaugeVec("tri_combination_best_profit", "Best evaluated profit per combination since the previous scrape (0.001 = 0.1%), max_over_time() gives the best profit.", "combination")
+	Opportunities        = NewCounterVec("tri_opportunities_total", "Opportunities found per combination.", "combination")
+	Orders               = NewCounterVec("tri_orders_total", "Orders per status (placed, filled, rejected).", "status")
+	OrderRequests        = NewCounterVec("tri_order_requests_total", "Order create and cancel requests per path (ws, rest, fallback).", "path")
+	Wallet               = NewGaugeVec("tri_wallet_balance", "Wallet balance per coin.", "coin")
+	SlackDeliveries      = NewCounterVec("tri_slack_deliveries_total", "Slack delivery attempts per result (delivered, retried, rate_limited, failed, persisted, expired).", "result")
+	OrderbookUpdates     = NewCounterVec("tri_orderbook_updates_total", "Orderbook updates received per public connection, including duplicates of redundant connections.", "conn")
+	FirstArrivals        = NewCounterVec("tri_orderbook_first_arrivals_total", "Orderbook updates which arrived first per public connection.", "conn")
+	DroppedEpisodes      = NewCounterVec("tri_episodes_dropped_total", "Closed episodes dropped because the journal queue was full.", "")
+	NotificationFailures = NewCounterVec("tri_notification_send_failures_total", "Failed notifications per notifier e.g. slack.", "notifier")
+)
+
+const (
+	ORDER_PLACED   = "placed"
+	ORDER_FILLED   = "filled"
+	ORDER_REJECTED = "rejected"
+
+	ORDER_PATH_WS       = "ws"
+	ORDER_PATH_REST     = "rest"
+	ORDER_PATH_FALLBACK = "fallback" // REST after the trade websocket failed
+)
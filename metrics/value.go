@@ -0,0 +1,138 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	TYPE_COUNTER = "counter"
+	TYPE_GAUGE   = "gauge"
+)
+
+// ValueVec is a counter or a gauge partitioned by one label, the label can be empty if it isn't partitioned
+type ValueVec struct {
+	name   string
+	help   string
+	typ    string
+	label  string
+	mu     sync.Mutex
+	values map[string]float64
+	funcs  map[string]func() float64 // evaluated when it's exported
+	latest map[string]float64        // only for peak gauges, values restart from it after an export
+}
+
+func newValueVec(name string, help string, typ string, label string) *ValueVec {
+	v := &ValueVec{name: name, help: help, typ: typ, label: label, values: make(map[string]float64), funcs: make(map[string]func() float64)}
+	Default.register(v)
+	return v
+}
+
+func NewCounterVec(name string, help string, label string) *ValueVec {
+	return newValueVec(name, help, TYPE_COUNTER, label)
+}
+
+func NewGaugeVec(name string, help string, label string) *ValueVec {
+	return newValueVec(name, help, TYPE_GAUGE, label)
+}
+
+// NewPeakGaugeVec is a gauge of the highest value since the previous export, so spikes between scrapes aren't missed
+func NewPeakGaugeVec(name string, help string, label string) *ValueVec {
+	v := newValueVec(name, help, TYPE_GAUGE, label)
+	v.latest = make(map[string]float64)
+	return v
+}
+
+// Observe keeps the highest value of a peak gauge
+func (v *ValueVec) Observe(labelValue string, value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.latest[labelValue] = value
+	if peak, ok := v.values[labelValue]; !ok || value > peak {
+		v.values[labelValue] = value
+	}
+}
+
+func (v *ValueVec) Inc(labelValue string) {
+	v.Add(labelValue, 1)
+}
+
+func (v *ValueVec) Add(labelValue string, delta float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[labelValue] += delta
+}
+
+func (v *ValueVec) Set(labelValue string, value float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[labelValue] = value
+}
+
+// SetFunc makes the value evaluated on every export e.g. length of a channel
+func (v *ValueVec) SetFunc(labelValue string, f func() float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.funcs[labelValue] = f
+}
+
+func (v *ValueVec) Get(labelValue string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if f, ok := v.funcs[labelValue]; ok {
+		return f()
+	}
+	return v.values[labelValue]
+}
+
+// Snapshot returns all values, funcs are evaluated
+func (v *ValueVec) Snapshot() map[string]float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	snapshot := make(map[string]float64)
+	for labelValue, value := range v.values {
+		snapshot[labelValue] = value
+	}
+	for labelValue, f := range v.funcs {
+		snapshot[labelValue] = f()
+	}
+	return snapshot
+}
+
+func (v *ValueVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+	var snapshot map[string]float64
+	if v.latest != nil {
+		snapshot = v.exportPeaks()
+	} else {
+		snapshot = v.Snapshot()
+	}
+	var labelValues []string
+	for labelValue := range snapshot {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+	for _, labelValue := range labelValues {
+		if v.label == "" {
+			fmt.Fprintf(w, "%s %s\n", v.name, formatFloat(snapshot[labelValue]))
+			continue
+		}
+		fmt.Fprintf(w, "%s{%s=%q} %s\n", v.name, v.label, labelValue, formatFloat(snapshot[labelValue]))
+	}
+}
+
+// exportPeaks returns the peaks and restarts them from the latest values
+func (v *ValueVec) exportPeaks() map[string]float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	snapshot := make(map[string]float64)
+	for labelValue, value := range v.values {
+		snapshot[labelValue] = value
+	}
+	for labelValue, value := range v.latest {
+		v.values[labelValue] = value
+	}
+	return snapshot
+}
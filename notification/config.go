@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"log"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	TYPE_SLACK    = "slack"
+	TYPE_TELEGRAM = "telegram"
+	TYPE_DISCORD  = "discord"
+	TYPE_WEBHOOK  = "webhook"
+	TYPE_EMAIL    = "email"
+)
+
+// NotifierConfig is an item of NOTIFIERS in the config, only the fields of the type are used
+type NotifierConfig struct {
+	Name        string            `mapstructure:"name"` // the type if it's empty
+	Type        string            `mapstructure:"type"`
+	Channels    []string          `mapstructure:"channels"`     // all channels if it's empty
+	MinSeverity string            `mapstructure:"min_severity"` // debug, info, warning, critical
+	URL         string            `mapstructure:"url"`
+	Token       string            `mapstructure:"token"`
+	ChatId      string            `mapstructure:"chat_id"`     // telegram
+	ChannelMap  map[string]string `mapstructure:"channel_map"` // slack, logical channel -> slack channel
+	Headers     map[string]string `mapstructure:"headers"`     // webhook
+	SmtpAddr    string            `mapstructure:"smtp_addr"`   // email
+	Username    string            `mapstructure:"username"`
+	Password    string            `mapstructure:"password"`
+	From        string            `mapstructure:"from"`
+	To          []string          `mapstructure:"to"`
+
+	UndeliveredPath string `mapstructure:"undelivered_path"` // slack, undelivered messages are retried from the file
+}
+
+// Init builds the router from NOTIFIERS, it falls back to Slack of SLACK_* if NOTIFIERS isn't set
+func Init() *Router {
+	var configs []NotifierConfig
+	if err := viper.UnmarshalKey("NOTIFIERS", &configs); err != nil {
+		log.Fatalf("NOTIFIERS is invalid: %v", err)
+	}
+	if len(configs) == 0 {
+		configs = []NotifierConfig{{Type: TYPE_SLACK}}
+	}
+
+	var routes []*Route
+	for _, config := range configs {
+		routes = append(routes, newRoute(config))
+	}
+	return NewRouter(routes...)
+}
+
+func newRoute(config NotifierConfig) *Route {
+	name := config.Name
+	if name == "" {
+		name = config.Type
+	}
+	minSeverity, err := ParseSeverity(config.MinSeverity)
+	if err != nil {
+		log.Fatalf("Notifier '%s': %v", name, err)
+	}
+	route := &Route{Name: name, MinSeverity: minSeverity, Channels: make(map[string]bool)}
+	for _, channel := range config.Channels {
+		route.Channels[channel] = true
+	}
+
+	switch config.Type {
+	case TYPE_SLACK:
+		slack := newSlackFromConfig(config)
+		slack.Name = name
+		route.Backend = slack
+	case TYPE_TELEGRAM:
+		route.Backend = NewTelegram(config.URL, config.Token, config.ChatId)
+	case TYPE_DISCORD:
+		route.Backend = NewDiscord(config.URL)
+	case TYPE_WEBHOOK:
+		route.Backend = NewWebhook(config.URL, config.Headers)
+	case TYPE_EMAIL:
+		route.Backend = NewEmail(config.SmtpAddr, config.Username, config.Password, config.From, config.To)
+	default:
+		log.Fatalf("Notifier '%s': type '%s' not supported", name, config.Type)
+	}
+	return route
+}
+
+// SLACK_* are the defaults, so the old config still works
+func newSlackFromConfig(config NotifierConfig) *Slack {
+	token := config.Token
+	if token == "" {
+		token = viper.GetString("SLACK_TOKEN")
+	}
+	url := config.URL
+	if url == "" {
+		url = viper.GetString("SLACK_SEND_MESSAGE_URL")
+	}
+	channelMap := map[string]string{
+		CHANNEL_WATCH:       viper.GetString("SLACK_CHANNEL_WATCH"),
+		CHANNEL_SYSTEM_LOGS: viper.GetString("SLACK_CHANNEL_SYSTEM_LOGS"),
+	}
+	for channel, slackChannel := range config.ChannelMap {
+		channelMap[channel] = slackChannel
+	}
+	slack := NewSlack(token, url, channelMap)
+	if updateURL := viper.GetString("SLACK_UPDATE_MESSAGE_URL"); updateURL != "" {
+		slack.UpdateMessageURL = updateURL
+	}
+	if config.UndeliveredPath != "" {
+		slack.queue.path = config.UndeliveredPath
+	} else if path := viper.GetString("SLACK_UNDELIVERED_PATH"); path != "" {
+		slack.queue.path = path
+	}
+	return slack
+}
@@ -0,0 +1,21 @@
+package notification
+
+const DISCORD_TEXT_LIMIT = 2000
+
+// Discord posts messages to a webhook of a Discord channel
+type Discord struct {
+	WebhookURL string
+}
+
+func NewDiscord(webhookURL string) *Discord {
+	return &Discord{WebhookURL: webhookURL}
+}
+
+func (d *Discord) Send(msg *Message) error {
+	for _, text := range splitText(formatText(msg), DISCORD_TEXT_LIMIT) {
+		if _, err := postJSON(d.WebhookURL, nil, map[string]string{"content": text}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDiscordSend(t *testing.T) {
+	var content string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		content = body["content"]
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := NewDiscord(srv.URL).Send(&Message{Channel: CHANNEL_SYSTEM_LOGS, Severity: SEVERITY_INFO, Text: "started"}); err != nil {
+		t.Fatal(err)
+	}
+	if content != "[system_logs][info] started" {
+		t.Fatalf("content = %q", content)
+	}
+}
+
+func TestDiscordSendRateLimited(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	err := NewDiscord(srv.URL).Send(&Message{Channel: CHANNEL_WATCH, Text: "hello"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("err = %v, want *HTTPError", err)
+	}
+	if httpErr.StatusCode != http.StatusTooManyRequests || httpErr.RetryAfter != 2*time.Second {
+		t.Fatalf("status = %d, retry after = %v", httpErr.StatusCode, httpErr.RetryAfter)
+	}
+}
@@ -0,0 +1,48 @@
+package notification
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Email sends messages via SMTP, the auth is skipped if Username is empty
+type Email struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+func NewEmail(addr string, username string, password string, from string, to []string) *Email {
+	return &Email{Addr: addr, Username: username, Password: password, From: from, To: to}
+}
+
+func (e *Email) Send(msg *Message) error {
+	if len(e.To) == 0 {
+		return fmt.Errorf("no recipient")
+	}
+	var auth smtp.Auth
+	if e.Username != "" {
+		host, _, err := net.SplitHostPort(e.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	subject := fmt.Sprintf("[%s][%s] %s", msg.Channel, msg.Severity, firstLine(msg.Text))
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		e.From, strings.Join(e.To, ", "), subject, msg.Ts.Format(time.RFC1123Z), strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+	return smtp.SendMail(e.Addr, auth, e.From, e.To, []byte(body))
+}
+
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	if len(line) > 100 {
+		line = line[:100] + "..."
+	}
+	return line
+}
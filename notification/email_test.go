@@ -0,0 +1,99 @@
+package notification
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts one mail without auth and TLS, the data of the mail is sent to the channel
+func fakeSMTP(t *testing.T) (string, chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	data := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				lines, err := tp.ReadDotLines()
+				if err != nil {
+					return
+				}
+				data <- strings.Join(lines, "\n")
+				tp.PrintfLine("250 OK")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), data
+}
+
+func TestEmailSend(t *testing.T) {
+	addr, data := fakeSMTP(t)
+	email := NewEmail(addr, "", "", "bot@example.com", []string{"ops@example.com"})
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := email.Send(&Message{Channel: CHANNEL_SYSTEM_LOGS, Severity: SEVERITY_WARNING, Text: "reconnected\nconn 1", Ts: ts}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case mail := <-data:
+		for _, want := range []string{"To: ops@example.com", "Subject: [system_logs][warning] reconnected", "conn 1"} {
+			if !strings.Contains(mail, want) {
+				t.Errorf("mail doesn't contain %q:\n%s", want, mail)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no mail")
+	}
+}
+
+func TestEmailSendNoRecipient(t *testing.T) {
+	if err := NewEmail("127.0.0.1:25", "", "", "bot@example.com", nil).Send(&Message{Text: "hello"}); err == nil {
+		t.Fatal("err = nil, want an error without recipients")
+	}
+}
+
+func TestEmailSendRejected(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		w := bufio.NewWriter(conn)
+		w.WriteString("554 no service\r\n")
+		w.Flush()
+	}()
+	if err := NewEmail(ln.Addr().String(), "", "", "bot@example.com", []string{"ops@example.com"}).Send(&Message{Text: "hello"}); err == nil {
+		t.Fatal("err = nil, want an error when the server rejects")
+	}
+}
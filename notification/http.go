@@ -0,0 +1,94 @@
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const HTTP_TIMEOUT_SECOND = 10
+
+var httpClient = &http.Client{Timeout: time.Duration(HTTP_TIMEOUT_SECOND) * time.Second}
+
+// HTTPError is returned for status codes other than 2xx
+type HTTPError struct {
+	StatusCode int
+	RetryAfter time.Duration // from the Retry-After header, 0 if it isn't set
+	Body       []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("status: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// postJSON returns the body of the response, status codes other than 2xx are *HTTPError
+func postJSON(url string, headers map[string]string, payload any) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Add(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		httpErr := &HTTPError{StatusCode: resp.StatusCode, Body: respBody}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			httpErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return respBody, httpErr
+	}
+	return respBody, nil
+}
+
+// splitText splits the text by lines into chunks within the limit (bytes), a line over the limit is cut between runes
+func splitText(text string, limit int) []string {
+	var chunks []string
+	var chunk []byte
+	for _, line := range bytes.SplitAfter([]byte(text), []byte("\n")) {
+		for len(line) > limit {
+			if len(chunk) > 0 {
+				chunks = append(chunks, string(chunk))
+				chunk = nil
+			}
+			cut := limit
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = limit
+			}
+			chunks = append(chunks, string(line[:cut]))
+			line = line[cut:]
+		}
+		if len(chunk)+len(line) > limit {
+			chunks = append(chunks, string(chunk))
+			chunk = nil
+		}
+		chunk = append(chunk, line...)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, string(chunk))
+	}
+	return chunks
+}
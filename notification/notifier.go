@@ -0,0 +1,77 @@
+package notification
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Logical channels, each backend maps them to its own destination
+const (
+	CHANNEL_WATCH       = "watch"
+	CHANNEL_SYSTEM_LOGS = "system_logs"
+)
+
+type Severity int
+
+const (
+	SEVERITY_DEBUG Severity = iota
+	SEVERITY_INFO
+	SEVERITY_WARNING
+	SEVERITY_CRITICAL
+)
+
+var severityNames = []string{"debug", "info", "warning", "critical"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// ParseSeverity accepts the names of String(), an empty string is SEVERITY_DEBUG which lets every message through
+func ParseSeverity(name string) (Severity, error) {
+	if name == "" {
+		return SEVERITY_DEBUG, nil
+	}
+	for i, n := range severityNames {
+		if strings.EqualFold(name, n) {
+			return Severity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("severity '%s' not supported", name)
+}
+
+type Message struct {
+	Channel       string              `json:"channel"`
+	Severity      Severity            `json:"severity"`
+	Text          string              `json:"text"`
+	Ts            time.Time           `json:"ts"`
+	Opportunities []*OpportunityAlert `json:"opportunities,omitempty"` // optional, Text has the same content
+}
+
+// Notifier is used by all components to send messages, it never blocks the caller
+type Notifier interface {
+	Notify(channel string, severity Severity, text string)
+	// SystemLogs is Notify(CHANNEL_SYSTEM_LOGS, SEVERITY_INFO, text)
+	SystemLogs(text string)
+	// Publish sends a message with structured content e.g. opportunities
+	Publish(msg *Message)
+}
+
+// Backend delivers a message to a service e.g. Slack, Telegram
+type Backend interface {
+	Send(msg *Message) error
+}
+
+// Backends with a queue implement it, Router.Listen() starts them
+type listener interface {
+	Listen()
+}
+
+// Backends which render timestamps implement it, Router.SetFormatter() sets them
+type formatterSetter interface {
+	SetFormatter(f *clock.Formatter)
+}
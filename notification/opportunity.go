@@ -0,0 +1,39 @@
+package notification
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// OpportunityAlert is the structured opportunity of a Message, backends which can't render it use Message.Text
+type OpportunityAlert struct {
+	Combination   string
+	Symbol        string // which symbol trigger the calculation
+	Legs          []AlertLeg
+	Capital       decimal.Decimal
+	End           decimal.Decimal
+	Profit        decimal.Decimal // 0.001 = 0.1%
+	AvailableSize decimal.Decimal // in the same coin as Capital
+	EpisodeStart  time.Time       // zero if the episode is unknown
+	Ts            time.Time
+}
+
+type AlertLeg struct {
+	Symbol   string
+	Side     string
+	Price    decimal.Decimal
+	Size     decimal.Decimal
+	Notional decimal.Decimal // in the same coin as Capital
+}
+
+func (a *OpportunityAlert) AbsoluteProfit() decimal.Decimal {
+	return a.End.Sub(a.Capital)
+}
+
+func (a *OpportunityAlert) EpisodeDuration() time.Duration {
+	if a.EpisodeStart.IsZero() {
+		return 0
+	}
+	return a.Ts.Sub(a.EpisodeStart)
+}
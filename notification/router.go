@@ -0,0 +1,160 @@
+package notification
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/metrics"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SEND_TO_SYSTEM_LOGS_INTERVAL_SECOND = 3
+
+// Route sends messages of the channels at or above the severity to the backend
+type Route struct {
+	Name        string
+	Backend     Backend
+	Channels    map[string]bool // all channels if it's empty
+	MinSeverity Severity
+
+	mu      sync.Mutex
+	pending []*Message // batched messages, they are combined to prevent hitting the rate limits
+}
+
+func (r *Route) match(msg *Message) bool {
+	if msg.Severity < r.MinSeverity {
+		return false
+	}
+	return len(r.Channels) == 0 || r.Channels[msg.Channel]
+}
+
+// Router implements Notifier, messages of CHANNEL_SYSTEM_LOGS are batched per route until Listen() flushes them
+type Router struct {
+	Routes        []*Route
+	BatchChannels map[string]bool
+	Formatter     *clock.Formatter
+}
+
+func NewRouter(routes ...*Route) *Router {
+	return &Router{
+		Routes:        routes,
+		BatchChannels: map[string]bool{CHANNEL_SYSTEM_LOGS: true},
+		Formatter:     clock.DefaultFormatter(),
+	}
+}
+
+// SetFormatter is also passed to the backends which render timestamps
+func (r *Router) SetFormatter(f *clock.Formatter) {
+	r.Formatter = f
+	for _, route := range r.Routes {
+		if s, ok := route.Backend.(formatterSetter); ok {
+			s.SetFormatter(f)
+		}
+	}
+}
+
+func (r *Router) Notify(channel string, severity Severity, text string) {
+	r.Publish(&Message{Channel: channel, Severity: severity, Text: text, Ts: r.Formatter.Now()})
+}
+
+func (r *Router) Publish(msg *Message) {
+	log.Println(msg.Text)
+	if msg.Ts.IsZero() {
+		msg.Ts = r.Formatter.Now()
+	}
+	for _, route := range r.Routes {
+		if !route.match(msg) {
+			continue
+		}
+		if r.BatchChannels[msg.Channel] {
+			route.mu.Lock()
+			route.pending = append(route.pending, msg)
+			route.mu.Unlock()
+			continue
+		}
+		go r.send(route, msg)
+	}
+}
+
+func (r *Router) SystemLogs(text string) {
+	r.Notify(CHANNEL_SYSTEM_LOGS, SEVERITY_INFO, text)
+}
+
+// PublishTo sends the message to the named routes regardless of their channels and severity, it's used by alert rules
+func (r *Router) PublishTo(names []string, msg *Message) {
+	log.Println(msg.Text)
+	if msg.Ts.IsZero() {
+		msg.Ts = r.Formatter.Now()
+	}
+	for _, route := range r.Routes {
+		for _, name := range names {
+			if route.Name == name {
+				go r.send(route, msg)
+				break
+			}
+		}
+	}
+}
+
+// HasRoute is used to validate targets of alert rules
+func (r *Router) HasRoute(name string) bool {
+	for _, route := range r.Routes {
+		if route.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Listen starts backends with a queue and flushes batched messages, it blocks
+func (r *Router) Listen() {
+	for _, route := range r.Routes {
+		if l, ok := route.Backend.(listener); ok {
+			go l.Listen()
+		}
+	}
+	ticker := time.NewTicker(time.Duration(SEND_TO_SYSTEM_LOGS_INTERVAL_SECOND) * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		r.Flush()
+	}
+}
+
+// Flush sends the batched messages of each route as a combined message
+func (r *Router) Flush() {
+	for _, route := range r.Routes {
+		route.mu.Lock()
+		pending := route.pending
+		route.pending = nil
+		route.mu.Unlock()
+
+		for channel, msgs := range groupByChannel(pending) {
+			combined := &Message{Channel: channel, Ts: msgs[0].Ts}
+			var texts []string
+			for _, msg := range msgs {
+				texts = append(texts, msg.Text)
+				if msg.Severity > combined.Severity {
+					combined.Severity = msg.Severity
+				}
+			}
+			combined.Text = strings.Join(texts, "\n")
+			go r.send(route, combined)
+		}
+	}
+}
+
+func (r *Router) send(route *Route, msg *Message) {
+	if err := route.Backend.Send(msg); err != nil {
+		metrics.NotificationFailures.Inc(route.Name)
+		log.Printf("Error sending message to '%s' (%s): %v\n", route.Name, msg.Channel, err)
+	}
+}
+
+func groupByChannel(msgs []*Message) map[string][]*Message {
+	groups := make(map[string][]*Message)
+	for _, msg := range msgs {
+		groups[msg.Channel] = append(groups[msg.Channel], msg)
+	}
+	return groups
+}
@@ -0,0 +1,127 @@
+package notification
+
+import (
+	"crypto-triangular-arbitrage-watch/metrics"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeBackend passes the messages to the channel, it fails if err is set
+type fakeBackend struct {
+	msgs chan *Message
+	err  error
+}
+
+func newFakeBackend(err error) *fakeBackend {
+	return &fakeBackend{msgs: make(chan *Message, 10), err: err}
+}
+
+func (b *fakeBackend) Send(msg *Message) error {
+	b.msgs <- msg
+	return b.err
+}
+
+func (b *fakeBackend) received(t *testing.T) *Message {
+	t.Helper()
+	select {
+	case msg := <-b.msgs:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+		return nil
+	}
+}
+
+func (b *fakeBackend) nothing(t *testing.T) {
+	t.Helper()
+	select {
+	case msg := <-b.msgs:
+		t.Fatalf("unexpected message %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRouterRoutesByChannel(t *testing.T) {
+	watch := newFakeBackend(nil)
+	all := newFakeBackend(nil)
+	router := NewRouter(
+		&Route{Name: "watch", Backend: watch, Channels: map[string]bool{CHANNEL_WATCH: true}},
+		&Route{Name: "all", Backend: all},
+	)
+	router.BatchChannels = nil
+
+	router.Notify(CHANNEL_WATCH, SEVERITY_INFO, "opportunity")
+	if msg := watch.received(t); msg.Text != "opportunity" {
+		t.Errorf("watch got %q", msg.Text)
+	}
+	all.received(t)
+
+	router.Notify(CHANNEL_SYSTEM_LOGS, SEVERITY_INFO, "started")
+	all.received(t)
+	watch.nothing(t)
+}
+
+func TestRouterFiltersSeverity(t *testing.T) {
+	pager := newFakeBackend(nil)
+	router := NewRouter(&Route{Name: "pager", Backend: pager, MinSeverity: SEVERITY_WARNING})
+	router.BatchChannels = nil
+
+	router.Notify(CHANNEL_WATCH, SEVERITY_INFO, "info")
+	pager.nothing(t)
+	router.Notify(CHANNEL_WATCH, SEVERITY_CRITICAL, "critical")
+	if msg := pager.received(t); msg.Severity != SEVERITY_CRITICAL {
+		t.Errorf("severity = %s", msg.Severity)
+	}
+}
+
+func TestRouterBatchesSystemLogs(t *testing.T) {
+	backend := newFakeBackend(nil)
+	router := NewRouter(&Route{Name: "batch", Backend: backend})
+
+	router.SystemLogs("first")
+	router.Notify(CHANNEL_SYSTEM_LOGS, SEVERITY_WARNING, "second")
+	backend.nothing(t)
+
+	router.Flush()
+	msg := backend.received(t)
+	if msg.Text != "first\nsecond" || msg.Severity != SEVERITY_WARNING {
+		t.Fatalf("combined = %q (%s), want both lines at the highest severity", msg.Text, msg.Severity)
+	}
+	router.Flush()
+	backend.nothing(t)
+}
+
+func TestRouterPublishTo(t *testing.T) {
+	ops := newFakeBackend(nil)
+	other := newFakeBackend(nil)
+	router := NewRouter(
+		&Route{Name: "ops", Backend: ops, Channels: map[string]bool{CHANNEL_SYSTEM_LOGS: true}, MinSeverity: SEVERITY_CRITICAL},
+		&Route{Name: "other", Backend: other},
+	)
+
+	// Channels and severity of the route are ignored
+	router.PublishTo([]string{"ops"}, &Message{Channel: CHANNEL_WATCH, Severity: SEVERITY_INFO, Text: "rule"})
+	ops.received(t)
+	other.nothing(t)
+	if !router.HasRoute("ops") || router.HasRoute("missing") {
+		t.Error("HasRoute doesn't match the route names")
+	}
+}
+
+func TestRouterCountsFailures(t *testing.T) {
+	failing := newFakeBackend(errors.New("down"))
+	router := NewRouter(&Route{Name: "failing_test", Backend: failing})
+	router.BatchChannels = nil
+
+	before := metrics.NotificationFailures.Get("failing_test")
+	router.Notify(CHANNEL_WATCH, SEVERITY_INFO, "hello")
+	failing.received(t)
+	deadline := time.Now().Add(time.Second)
+	for metrics.NotificationFailures.Get("failing_test") != before+1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("failures = %v, want %v", metrics.NotificationFailures.Get("failing_test"), before+1)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
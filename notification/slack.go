@@ -1,124 +1,185 @@
 package notification
 
 import (
-	"bytes"
+	"crypto-triangular-arbitrage-watch/clock"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/spf13/viper"
 )
 
-const (
-	SEND_TO_SYSTEM_LOGS_INTERVAL_SECOND = 3
-	SLACK_CHANNEL_WATCH                 = "watch"
-	SLACK_CHANNEL_SYSTEM_LOGS           = "system_logs"
-)
+// A re-triggered combination updates its message within the window instead of posting a new one
+const SLACK_UPDATE_WINDOW_SECOND = 60
 
+// Slack posts messages with chat.postMessage, opportunities are Block Kit messages updated with chat.update
 type Slack struct {
-	Token          string
-	SendMessageURL string
-	ChannelMap     map[string]*Channel
+	Name             string // for metrics
+	Token            string
+	SendMessageURL   string
+	UpdateMessageURL string
+	ChannelMap       map[string]string // logical channel -> slack channel
+	Formatter        *clock.Formatter
+
+	mu    sync.Mutex
+	posts map[string]*slackPost // combination -> the latest opportunity message
+	queue *slackQueue
 }
 
-type Channel struct {
-	Name string
-	Chan chan string
+// slackPost is where a message is, chat.update needs the channel id and ts of the message
+type slackPost struct {
+	Channel   string
+	Ts        string
+	UpdatedAt time.Time
+	Updates   int
 }
 
 // SlackRequestBody structure to hold the message payload
 type SlackRequestBody struct {
-	Channel string `json:"channel"`
-	Text    string `json:"text"`
+	Channel     string            `json:"channel"`
+	Ts          string            `json:"ts,omitempty"` // chat.update
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
 }
 
-func Init() *Slack {
+type SlackAttachment struct {
+	Color  string       `json:"color"`
+	Blocks []SlackBlock `json:"blocks"`
+}
+
+type SlackResponse struct {
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"` // channel id
+	Ts      string `json:"ts"`
+}
+
+func NewSlack(token string, sendMessageURL string, channelMap map[string]string) *Slack {
 	return &Slack{
-		Token:          viper.GetString("SLACK_TOKEN"),
-		SendMessageURL: viper.GetString("SLACK_SEND_MESSAGE_URL"),
-		ChannelMap:     loadChannelMap(),
+		Name:             TYPE_SLACK,
+		Token:            token,
+		SendMessageURL:   sendMessageURL,
+		UpdateMessageURL: strings.Replace(sendMessageURL, "chat.postMessage", "chat.update", 1),
+		ChannelMap:       channelMap,
+		Formatter:        clock.DefaultFormatter(),
+		posts:            make(map[string]*slackPost),
+		queue:            newSlackQueue(SLACK_DEFAULT_UNDELIVERED_PATH),
 	}
 }
 
-func loadChannelMap() map[string]*Channel {
-	channelMap := make(map[string]*Channel)
-	channelWatch := Channel{
-		Name: viper.GetString("SLACK_CHANNEL_WATCH"),
-		Chan: make(chan string),
+func (s *Slack) SetFormatter(f *clock.Formatter) {
+	s.Formatter = f
+}
+
+// deliver is called by the queue, the error is *SlackError if Slack returns `ok: false`
+func (s *Slack) deliver(msg *Message) error {
+	channel, ok := s.ChannelMap[msg.Channel]
+	if !ok || channel == "" {
+		return &SlackConfigError{Channel: msg.Channel}
+	}
+	if len(msg.Opportunities) == 0 {
+		_, err := s.call(s.SendMessageURL, SlackRequestBody{Channel: channel, Text: msg.Text})
+		return err
 	}
-	channelSystemLogs := Channel{
-		Name: viper.GetString("SLACK_CHANNEL_SYSTEM_LOGS"),
-		Chan: make(chan string),
+	var errs []string
+	var wrapped error
+	for _, alert := range msg.Opportunities {
+		if err := s.sendOpportunity(channel, alert); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", alert.Combination, err))
+			// The message is retried if one of them can succeed by retrying
+			if _, retryable := retryDelay(err, 0); wrapped == nil || retryable {
+				wrapped = err
+			}
+		}
 	}
-	channelMap[SLACK_CHANNEL_WATCH] = &channelWatch
-	channelMap[SLACK_CHANNEL_SYSTEM_LOGS] = &channelSystemLogs
-
-	return channelMap
+	if wrapped != nil {
+		return fmt.Errorf("%w, errors: %s", wrapped, strings.Join(errs, "; "))
+	}
+	return nil
 }
 
-func (s *Slack) sendSlackNotification(channel string, msg string) error {
-	slackBody, err := json.Marshal(SlackRequestBody{Channel: channel, Text: msg})
-	if err != nil {
-		return err
+func (s *Slack) sendOpportunity(channel string, alert *OpportunityAlert) error {
+	s.mu.Lock()
+	post, ok := s.posts[alert.Combination]
+	if ok && alert.Ts.Sub(post.UpdatedAt) > time.Duration(SLACK_UPDATE_WINDOW_SECOND)*time.Second {
+		ok = false
 	}
-	req, err := http.NewRequest(http.MethodPost, s.SendMessageURL, bytes.NewBuffer(slackBody))
-	if err != nil {
-		return err
+	var updates int
+	if ok {
+		updates = post.Updates + 1
 	}
+	s.mu.Unlock()
 
-	req.Header.Add("Authorization", "Bearer "+s.Token)
-	req.Header.Add("Content-Type", "application/json")
+	body := SlackRequestBody{
+		Channel:     channel,
+		Text:        opportunityText(alert),
+		Attachments: []SlackAttachment{{Color: profitColor(alert.Profit), Blocks: opportunityBlocks(alert, updates, s.Formatter)}},
+	}
+	if ok {
+		body.Channel = post.Channel
+		body.Ts = post.Ts
+		if _, err := s.call(s.UpdateMessageURL, body); err == nil {
+			s.mu.Lock()
+			post.UpdatedAt = alert.Ts
+			post.Updates = updates
+			s.mu.Unlock()
+			return nil
+		}
+		// e.g. the message is deleted, post a new one
+		body.Channel = channel
+		body.Ts = ""
+		body.Attachments[0].Blocks = opportunityBlocks(alert, 0, s.Formatter)
+	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.call(s.SendMessageURL, body)
 	if err != nil {
 		return err
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts[alert.Combination] = &slackPost{Channel: resp.Channel, Ts: resp.Ts, UpdatedAt: alert.Ts}
+	return nil
+}
 
-	defer resp.Body.Close()
-
-	_, err = io.ReadAll(resp.Body)
+func (s *Slack) call(url string, body SlackRequestBody) (*SlackResponse, error) {
+	respBody, err := postJSON(url, map[string]string{"Authorization": "Bearer " + s.Token}, body)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// Slack returns 200 with `ok: false` when it fails
+	var resp SlackResponse
+	if err = json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response, err: %v, body: %s", err, respBody)
 	}
+	if !resp.Ok {
+		return nil, &SlackError{Code: resp.Error}
+	}
+	return &resp, nil
+}
 
-	return nil
+// SlackError is `error` of the response e.g. channel_not_found, ratelimited
+type SlackError struct {
+	Code string
 }
 
-func (s *Slack) SystemLogs(msg string) {
-	s.ChannelMap[SLACK_CHANNEL_SYSTEM_LOGS].Chan <- msg
+func (e *SlackError) Error() string {
+	return fmt.Sprintf("slack error: %s", e.Code)
 }
 
-func (s *Slack) SendToChannel(channel string, msg string) {
-	log.Println(msg)
-	err := s.sendSlackNotification(channel, msg)
-	if err != nil {
-		log.Printf("Error sending message to '%s': %v\n", channel, err)
-	}
+// SlackConfigError won't succeed by retrying, the logical channel isn't mapped to a slack channel
+type SlackConfigError struct {
+	Channel string
 }
 
-func (s *Slack) HandleChannelSystemLogs() {
-	ticker := time.NewTicker(time.Duration(SEND_TO_SYSTEM_LOGS_INTERVAL_SECOND) * time.Second)
-	defer ticker.Stop()
-
-	// To show counters for result e.g. `map[997:1762 998:466]` means result 997 gets 1762 times, 998 gets 466 times
-	var combinedMsg string
-	for {
-		select {
-		case msg := <-s.ChannelMap[SLACK_CHANNEL_SYSTEM_LOGS].Chan:
-			combinedMsg += fmt.Sprintf("%s\n", msg)
-		case <-ticker.C:
-			if combinedMsg == "" {
-				continue
-			}
-			go s.SendToChannel(s.ChannelMap[SLACK_CHANNEL_SYSTEM_LOGS].Name, combinedMsg)
-			log.Println(combinedMsg)
+func (e *SlackConfigError) Error() string {
+	return fmt.Sprintf("slack channel of '%s' isn't set", e.Channel)
+}
 
-			// Reset the combined message
-			combinedMsg = ""
-		}
-	}
+// Temporary errors of Slack, the others won't succeed by retrying
+var slackRetryableErrors = map[string]bool{
+	"ratelimited":         true,
+	"internal_error":      true,
+	"fatal_error":         true,
+	"service_unavailable": true,
+	"request_timeout":     true,
 }
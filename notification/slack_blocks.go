@@ -0,0 +1,99 @@
+package notification
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Colours of the attachment bar by profit band
+const (
+	PROFIT_BAND_HIGH   = 0.005 // 0.5%
+	PROFIT_BAND_MEDIUM = 0.002 // 0.2%
+
+	COLOR_PROFIT_HIGH   = "#7b2cbf"
+	COLOR_PROFIT_MEDIUM = "#2eb886"
+	COLOR_PROFIT_LOW    = "#daa038"
+)
+
+type SlackBlock struct {
+	Type     string      `json:"type"`
+	Text     *SlackText  `json:"text,omitempty"`
+	Elements []SlackText `json:"elements,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func mrkdwn(text string) *SlackText {
+	return &SlackText{Type: "mrkdwn", Text: text}
+}
+
+func profitColor(profit decimal.Decimal) string {
+	switch {
+	case profit.GreaterThanOrEqual(decimal.NewFromFloat(PROFIT_BAND_HIGH)):
+		return COLOR_PROFIT_HIGH
+	case profit.GreaterThanOrEqual(decimal.NewFromFloat(PROFIT_BAND_MEDIUM)):
+		return COLOR_PROFIT_MEDIUM
+	default:
+		return COLOR_PROFIT_LOW
+	}
+}
+
+// opportunityText is the fallback of notifications and clients which can't render blocks
+func opportunityText(alert *OpportunityAlert) string {
+	return fmt.Sprintf("%s %s%% ($%s)", alert.Combination, alert.Profit.Mul(decimal.NewFromInt(100)).StringFixed(3), alert.AbsoluteProfit().StringFixed(2))
+}
+
+// e.g.
+//
+//	*BTCUSDT->ETHBTC->ETHUSDT*  *+0.123%*  (+1.23: 1000 -> 1001.23)
+//	Side  Symbol   Price     Size    Notional
+//	Buy   BTCUSDT  30000     0.5     15000
+//	...
+//	Triggered by ETHUSDT | episode 12.3s | 15:04:05 | updated 3 times
+func opportunityBlocks(alert *OpportunityAlert, updates int, formatter *clock.Formatter) []SlackBlock {
+	title := fmt.Sprintf("*%s*  *%s%%*  (%s: %s -> %s)",
+		alert.Combination,
+		signed(alert.Profit.Mul(decimal.NewFromInt(100)).StringFixed(3)),
+		signed(alert.AbsoluteProfit().StringFixed(2)),
+		alert.Capital.String(),
+		alert.End.StringFixed(2),
+	)
+
+	var legs strings.Builder
+	w := tabwriter.NewWriter(&legs, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Side\tSymbol\tPrice\tSize\tNotional")
+	for _, leg := range alert.Legs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", leg.Side, leg.Symbol, leg.Price.String(), leg.Size.String(), leg.Notional.StringFixed(0))
+	}
+	w.Flush()
+
+	context := []string{fmt.Sprintf("Triggered by %s", alert.Symbol)}
+	if d := alert.EpisodeDuration(); d > 0 {
+		context = append(context, fmt.Sprintf("episode %s", d.Round(100*time.Millisecond)))
+	}
+	context = append(context, formatter.Format(alert.Ts))
+	if updates > 0 {
+		context = append(context, fmt.Sprintf("updated %d times", updates))
+	}
+
+	return []SlackBlock{
+		{Type: "section", Text: mrkdwn(title)},
+		{Type: "section", Text: mrkdwn("```" + strings.TrimRight(legs.String(), "\n") + "```")},
+		{Type: "context", Elements: []SlackText{*mrkdwn(strings.Join(context, " | "))}},
+	}
+}
+
+func signed(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return s
+	}
+	return "+" + s
+}
@@ -0,0 +1,229 @@
+package notification
+
+import (
+	"bufio"
+	"crypto-triangular-arbitrage-watch/metrics"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	SLACK_TEXT_LIMIT                        = 40000
+	SLACK_QUEUE_SIZE                        = 1000
+	SLACK_MAX_ATTEMPTS                      = 5
+	SLACK_BACKOFF_INITIAL_SECOND            = 1
+	SLACK_BACKOFF_MAX_SECOND                = 60
+	SLACK_RETRY_UNDELIVERED_INTERVAL_SECOND = 300
+	SLACK_UNDELIVERED_MAX_AGE_HOUR          = 24
+	SLACK_DEFAULT_UNDELIVERED_PATH          = "slack_undelivered.jsonl"
+
+	// Results of tri_slack_deliveries_total
+	DELIVERY_DELIVERED    = "delivered"
+	DELIVERY_RETRIED      = "retried"
+	DELIVERY_RATE_LIMITED = "rate_limited"
+	DELIVERY_FAILED       = "failed"
+	DELIVERY_PERSISTED    = "persisted"
+	DELIVERY_EXPIRED      = "expired"
+)
+
+// slackQueue delivers messages one by one, so rate limits apply to all of them
+type slackQueue struct {
+	path       string // undelivered messages
+	deliveries chan *slackDelivery
+	mu         sync.Mutex // for the file
+}
+
+// slackDelivery is a line of the undelivered file
+type slackDelivery struct {
+	Message  *Message `json:"message"`
+	Attempts int      `json:"attempts"`
+}
+
+func newSlackQueue(path string) *slackQueue {
+	q := &slackQueue{path: path, deliveries: make(chan *slackDelivery, SLACK_QUEUE_SIZE)}
+	metrics.QueueDepth.SetFunc("slack", func() float64 { return float64(len(q.deliveries)) })
+	return q
+}
+
+// Send queues the message, text over SLACK_TEXT_LIMIT is split into several messages
+func (s *Slack) Send(msg *Message) error {
+	if len(msg.Opportunities) > 0 || len(msg.Text) <= SLACK_TEXT_LIMIT {
+		s.queue.push(&slackDelivery{Message: msg})
+		return nil
+	}
+	for _, text := range splitText(msg.Text, SLACK_TEXT_LIMIT) {
+		part := *msg
+		part.Text = text
+		s.queue.push(&slackDelivery{Message: &part})
+	}
+	return nil
+}
+
+// Listen delivers queued messages and retries undelivered ones periodically, it blocks
+func (s *Slack) Listen() {
+	s.queue.retryUndelivered()
+	ticker := time.NewTicker(time.Duration(SLACK_RETRY_UNDELIVERED_INTERVAL_SECOND) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case d := <-s.queue.deliveries:
+			s.deliverWithRetry(d)
+		case <-ticker.C:
+			s.queue.retryUndelivered()
+		}
+	}
+}
+
+func (s *Slack) deliverWithRetry(d *slackDelivery) {
+	backoff := time.Duration(SLACK_BACKOFF_INITIAL_SECOND) * time.Second
+	for {
+		d.Attempts++
+		err := s.deliver(d.Message)
+		if err == nil {
+			metrics.SlackDeliveries.Inc(DELIVERY_DELIVERED)
+			return
+		}
+
+		wait, retryable := retryDelay(err, backoff)
+		if !retryable {
+			// It won't succeed later either, so it isn't persisted
+			metrics.SlackDeliveries.Inc(DELIVERY_FAILED)
+			metrics.NotificationFailures.Inc(s.Name)
+			log.Printf("Slack failed to deliver message to '%s', err: %v", d.Message.Channel, err)
+			return
+		}
+		if d.Attempts%SLACK_MAX_ATTEMPTS == 0 {
+			metrics.SlackDeliveries.Inc(DELIVERY_FAILED)
+			metrics.NotificationFailures.Inc(s.Name)
+			log.Printf("Slack failed to deliver message to '%s' after %d attempts, err: %v", d.Message.Channel, d.Attempts, err)
+			s.queue.persist(d)
+			return
+		}
+		if isRateLimited(err) {
+			metrics.SlackDeliveries.Inc(DELIVERY_RATE_LIMITED)
+		} else {
+			metrics.SlackDeliveries.Inc(DELIVERY_RETRIED)
+		}
+		log.Printf("Slack retries message to '%s' in %v, err: %v", d.Message.Channel, wait, err)
+		time.Sleep(wait)
+
+		backoff *= 2
+		if backoff > time.Duration(SLACK_BACKOFF_MAX_SECOND)*time.Second {
+			backoff = time.Duration(SLACK_BACKOFF_MAX_SECOND) * time.Second
+		}
+	}
+}
+
+// retryDelay honours Retry-After of 429, network errors and 5xx are retried with the backoff, unknown errors aren't retried
+func retryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		switch {
+		case httpErr.StatusCode == http.StatusTooManyRequests:
+			if httpErr.RetryAfter > 0 {
+				return httpErr.RetryAfter, true
+			}
+			return backoff, true
+		case httpErr.StatusCode >= 500:
+			return backoff, true
+		default:
+			return 0, false
+		}
+	}
+	var slackErr *SlackError
+	if errors.As(err, &slackErr) {
+		return backoff, slackRetryableErrors[slackErr.Code]
+	}
+	// e.g. timeout, connection refused, *url.Error of the client is a net.Error
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return backoff, true
+	}
+	return 0, false
+}
+
+func isRateLimited(err error) bool {
+	var httpErr *HTTPError
+	var slackErr *SlackError
+	return (errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests) ||
+		(errors.As(err, &slackErr) && slackErr.Code == "ratelimited")
+}
+
+// push never blocks, the message is persisted if the queue is full
+func (q *slackQueue) push(d *slackDelivery) {
+	select {
+	case q.deliveries <- d:
+	default:
+		log.Printf("Slack queue is full, message to '%s' is persisted", d.Message.Channel)
+		q.persist(d)
+	}
+}
+
+func (q *slackQueue) persist(d *slackDelivery) {
+	line, err := json.Marshal(d)
+	if err != nil {
+		log.Printf("Error marshaling undelivered slack message: %v", err)
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	file, err := os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Error opening '%s': %v", q.path, err)
+		return
+	}
+	defer file.Close()
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing '%s': %v", q.path, err)
+		return
+	}
+	metrics.SlackDeliveries.Inc(DELIVERY_PERSISTED)
+}
+
+// retryUndelivered moves persisted messages back to the queue, messages older than SLACK_UNDELIVERED_MAX_AGE_HOUR are dropped
+func (q *slackQueue) retryUndelivered() {
+	q.mu.Lock()
+	file, err := os.Open(q.path)
+	if err != nil {
+		q.mu.Unlock()
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error opening '%s': %v", q.path, err)
+		}
+		return
+	}
+	var deliveries []*slackDelivery
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*SLACK_TEXT_LIMIT)
+	for scanner.Scan() {
+		var d slackDelivery
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil || d.Message == nil {
+			log.Printf("Skip invalid undelivered slack message: %s", scanner.Text())
+			continue
+		}
+		deliveries = append(deliveries, &d)
+	}
+	file.Close()
+	if err = scanner.Err(); err != nil {
+		q.mu.Unlock()
+		log.Printf("Error reading '%s': %v", q.path, err)
+		return
+	}
+	if err = os.Remove(q.path); err != nil {
+		log.Printf("Error removing '%s': %v", q.path, err)
+	}
+	q.mu.Unlock()
+
+	for _, d := range deliveries {
+		if time.Since(d.Message.Ts) > time.Duration(SLACK_UNDELIVERED_MAX_AGE_HOUR)*time.Hour {
+			metrics.SlackDeliveries.Inc(DELIVERY_EXPIRED)
+			continue
+		}
+		q.push(d)
+	}
+}
@@ -0,0 +1,103 @@
+package notification
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestRetryDelay(t *testing.T) {
+	backoff := 3 * time.Second
+	_, dialErr := http.Get("http://127.0.0.1:1")
+	cases := []struct {
+		name      string
+		err       error
+		wait      time.Duration
+		retryable bool
+	}{
+		{"429 with Retry-After", &HTTPError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Second}, 10 * time.Second, true},
+		{"429", &HTTPError{StatusCode: http.StatusTooManyRequests}, backoff, true},
+		{"503", &HTTPError{StatusCode: http.StatusServiceUnavailable}, backoff, true},
+		{"404", &HTTPError{StatusCode: http.StatusNotFound}, 0, false},
+		{"ratelimited", &SlackError{Code: "ratelimited"}, backoff, true},
+		{"channel_not_found", &SlackError{Code: "channel_not_found"}, backoff, false},
+		{"network", dialErr, backoff, true},
+		{"unmapped channel", &SlackConfigError{Channel: CHANNEL_WATCH}, 0, false},
+		{"wrapped", fmt.Errorf("%w, errors: ...", &SlackError{Code: "internal_error"}), backoff, true},
+		{"unknown", errors.New("failed to parse response"), 0, false},
+	}
+	for _, c := range cases {
+		wait, retryable := retryDelay(c.err, backoff)
+		if wait != c.wait || retryable != c.retryable {
+			t.Errorf("%s: retryDelay() = %v, %v, want %v, %v", c.name, wait, retryable, c.wait, c.retryable)
+		}
+	}
+}
+
+func TestSlackDoesNotPersistNonRetryableFailures(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"ok":false,"error":"channel_not_found"}`))
+	}))
+	defer srv.Close()
+
+	slack := NewSlack("xoxb", srv.URL+"/chat.postMessage", map[string]string{CHANNEL_WATCH: "C1"})
+	slack.queue.path = filepath.Join(t.TempDir(), "undelivered.jsonl")
+
+	slack.deliverWithRetry(&slackDelivery{Message: &Message{Channel: CHANNEL_WATCH, Text: "hello", Ts: time.Now()}})
+	slack.deliverWithRetry(&slackDelivery{Message: &Message{Channel: CHANNEL_SYSTEM_LOGS, Text: "unmapped", Ts: time.Now()}})
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 without retries", calls)
+	}
+	if _, err := os.Stat(slack.queue.path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("non-retryable failures are persisted, err: %v", err)
+	}
+}
+
+func TestSlackPersistsAfterMaxAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"error":"ratelimited"}`))
+	}))
+	defer srv.Close()
+
+	slack := NewSlack("xoxb", srv.URL+"/chat.postMessage", map[string]string{CHANNEL_WATCH: "C1"})
+	slack.queue.path = filepath.Join(t.TempDir(), "undelivered.jsonl")
+	// The last attempt fails, it isn't retried without a sleep
+	d := &slackDelivery{Message: &Message{Channel: CHANNEL_WATCH, Text: "hello", Ts: time.Now()}, Attempts: SLACK_MAX_ATTEMPTS - 1}
+	slack.deliverWithRetry(d)
+	data, err := os.ReadFile(slack.queue.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"text":"hello"`) {
+		t.Errorf("undelivered file = %s", data)
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	// By lines
+	chunks := splitText("aaa\nbbb\nccc\n", 8)
+	if len(chunks) != 2 || chunks[0] != "aaa\nbbb\n" || chunks[1] != "ccc\n" {
+		t.Errorf("chunks = %q", chunks)
+	}
+
+	// A long line is cut between runes, 日本 is 3 bytes per rune
+	text := strings.Repeat("日本", 5)
+	chunks = splitText(text, 8)
+	if strings.Join(chunks, "") != text {
+		t.Fatalf("chunks %q don't make the text", chunks)
+	}
+	for _, chunk := range chunks {
+		if len(chunk) > 8 || !utf8.ValidString(chunk) {
+			t.Errorf("chunk %q is over the limit or cuts a rune", chunk)
+		}
+	}
+}
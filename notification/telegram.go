@@ -0,0 +1,51 @@
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	TELEGRAM_DEFAULT_URL = "https://api.telegram.org"
+	TELEGRAM_TEXT_LIMIT  = 4096
+)
+
+// Telegram sends messages with sendMessage of the Bot API, all channels go to the same chat
+type Telegram struct {
+	URL    string
+	Token  string
+	ChatId string
+}
+
+func NewTelegram(url string, token string, chatId string) *Telegram {
+	if url == "" {
+		url = TELEGRAM_DEFAULT_URL
+	}
+	return &Telegram{URL: strings.TrimSuffix(url, "/"), Token: token, ChatId: chatId}
+}
+
+func (t *Telegram) Send(msg *Message) error {
+	for _, text := range splitText(formatText(msg), TELEGRAM_TEXT_LIMIT) {
+		body, err := postJSON(fmt.Sprintf("%s/bot%s/sendMessage", t.URL, t.Token), nil, map[string]string{"chat_id": t.ChatId, "text": text})
+		if err != nil {
+			return err
+		}
+		var resp struct {
+			Ok          bool   `json:"ok"`
+			Description string `json:"description"`
+		}
+		if err = json.Unmarshal(body, &resp); err != nil {
+			return fmt.Errorf("failed to parse response, err: %v, body: %s", err, body)
+		}
+		if !resp.Ok {
+			return fmt.Errorf("telegram error: %s", resp.Description)
+		}
+	}
+	return nil
+}
+
+// Backends without channels prefix the text with the channel and the severity
+func formatText(msg *Message) string {
+	return fmt.Sprintf("[%s][%s] %s", msg.Channel, msg.Severity, msg.Text)
+}
@@ -0,0 +1,58 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTelegramSend(t *testing.T) {
+	var texts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bot123:abc/sendMessage" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body["chat_id"] != "42" {
+			t.Errorf("chat_id = %s", body["chat_id"])
+		}
+		texts = append(texts, body["text"])
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	telegram := NewTelegram(srv.URL+"/", "123:abc", "42")
+	if err := telegram.Send(&Message{Channel: CHANNEL_WATCH, Severity: SEVERITY_WARNING, Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) != 1 || texts[0] != "[watch][warning] hello" {
+		t.Fatalf("texts = %q", texts)
+	}
+
+	// Over the limit, it's split by lines
+	texts = nil
+	line := strings.Repeat("a", TELEGRAM_TEXT_LIMIT/3) + "\n"
+	if err := telegram.Send(&Message{Channel: CHANNEL_WATCH, Text: line + line + line}); err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(texts))
+	}
+}
+
+func TestTelegramSendError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":false,"description":"Bad Request: chat not found"}`))
+	}))
+	defer srv.Close()
+
+	err := NewTelegram(srv.URL, "123:abc", "42").Send(&Message{Channel: CHANNEL_WATCH, Text: "hello"})
+	if err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package notification
+
+import "time"
+
+// Webhook posts the message as JSON to any URL
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+}
+
+type WebhookBody struct {
+	Channel  string    `json:"channel"`
+	Severity string    `json:"severity"`
+	Text     string    `json:"text"`
+	Ts       time.Time `json:"ts"`
+}
+
+func NewWebhook(url string, headers map[string]string) *Webhook {
+	return &Webhook{URL: url, Headers: headers}
+}
+
+func (w *Webhook) Send(msg *Message) error {
+	_, err := postJSON(w.URL, w.Headers, WebhookBody{Channel: msg.Channel, Severity: msg.Severity.String(), Text: msg.Text, Ts: msg.Ts})
+	return err
+}
@@ -0,0 +1,45 @@
+package notification
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookSend(t *testing.T) {
+	var body WebhookBody
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer srv.Close()
+
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	webhook := NewWebhook(srv.URL, map[string]string{"Authorization": "Bearer xxx"})
+	if err := webhook.Send(&Message{Channel: CHANNEL_WATCH, Severity: SEVERITY_CRITICAL, Text: "kill switch", Ts: ts}); err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Bearer xxx" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	want := WebhookBody{Channel: CHANNEL_WATCH, Severity: "critical", Text: "kill switch", Ts: ts}
+	if !body.Ts.Equal(want.Ts) || body.Channel != want.Channel || body.Severity != want.Severity || body.Text != want.Text {
+		t.Fatalf("body = %+v, want %+v", body, want)
+	}
+}
+
+func TestWebhookSendError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.URL, nil).Send(&Message{Channel: CHANNEL_WATCH, Text: "hello"}); err == nil {
+		t.Fatal("err = nil, want an error for 500")
+	}
+}
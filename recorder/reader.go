@@ -0,0 +1,71 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files returns recorded files of the dir in time order
+func Files(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "frames-*.jsonl*"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ReadFiles replays frames of the files in order, both .jsonl.gz and .jsonl are supported
+func ReadFiles(paths []string, fn func(*Frame) error) error {
+	for _, path := range paths {
+		if err := readFile(path, fn); err != nil {
+			return fmt.Errorf("failed to read '%s', err: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func readFile(path string, fn func(*Frame) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var frame Frame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return err
+		}
+		if err := fn(&frame); err != nil {
+			return err
+		}
+	}
+	// The file which is still being written doesn't have the gzip footer
+	if errors.Is(scanner.Err(), io.ErrUnexpectedEOF) {
+		log.Printf("'%s' is incomplete, the rest is skipped", path)
+		return nil
+	}
+	return scanner.Err()
+}
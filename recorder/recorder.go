@@ -0,0 +1,208 @@
+package recorder
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto-triangular-arbitrage-watch/metrics"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	CHANNEL_PUBLIC  = "public"
+	CHANNEL_PRIVATE = "private"
+
+	DEFAULT_DIR           = "records"
+	DEFAULT_ROTATE_MINUTE = 60
+	FRAME_CHANNEL_BUFFER  = 4096
+	FLUSH_INTERVAL_SECOND = 30
+	FILE_TIME_LAYOUT      = "20060102T150405Z"
+)
+
+// Recorder writes every raw websocket frame into rotating gzip JSONL files, so they can be replayed later
+type Recorder struct {
+	Dir      string
+	Rotate   time.Duration
+	frames   chan *Frame
+	stop     chan chan error
+	dropped  atomic.Int64
+	file     *os.File
+	gz       *gzip.Writer
+	buf      *bufio.Writer
+	openedAt time.Time
+}
+
+// Frame is a line in the file
+type Frame struct {
+	Ts      int64           `json:"ts"` // receipt time, unix nano
+	Channel string          `json:"channel"`
+	Conn    int             `json:"conn"` // connection number, private channel is 0
+	Data    json.RawMessage `json:"data"`
+}
+
+// Init returns nil if RECORDER_ENABLED isn't true, Record() of nil recorder is no-op
+func Init() *Recorder {
+	if !viper.GetBool("RECORDER_ENABLED") {
+		return nil
+	}
+	dir := viper.GetString("RECORDER_DIR")
+	if dir == "" {
+		dir = DEFAULT_DIR
+	}
+	rotate := viper.GetInt("RECORDER_ROTATE_MINUTE")
+	if rotate <= 0 {
+		rotate = DEFAULT_ROTATE_MINUTE
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalf("Error creating recorder dir '%s': %v", dir, err)
+	}
+	r := &Recorder{
+		Dir:    dir,
+		Rotate: time.Duration(rotate) * time.Minute,
+		frames: make(chan *Frame, FRAME_CHANNEL_BUFFER),
+		stop:   make(chan chan error),
+	}
+	metrics.QueueDepth.SetFunc("recorder_frames", func() float64 { return float64(len(r.frames)) })
+	return r
+}
+
+// Record never blocks the caller, frames are dropped if the writer can't keep up
+func (r *Recorder) Record(channel string, conn int, receivedAt time.Time, message []byte) {
+	if r == nil {
+		return
+	}
+	// Bybit sends compact JSON, but the frame has to be valid JSON to be embedded
+	if !json.Valid(message) {
+		return
+	}
+	frame := &Frame{Ts: receivedAt.UnixNano(), Channel: channel, Conn: conn, Data: message}
+	select {
+	case r.frames <- frame:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Stop writes the queued frames and closes the current file in the goroutine of Listen, it's called on shutdown
+func (r *Recorder) Stop() error {
+	if r == nil {
+		return nil
+	}
+	done := make(chan error)
+	r.stop <- done
+	return <-done
+}
+
+// Listen writes frames into files, it blocks until Stop
+func (r *Recorder) Listen() {
+	ticker := time.NewTicker(time.Duration(FLUSH_INTERVAL_SECOND) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case frame := <-r.frames:
+			if err := r.write(frame); err != nil {
+				log.Printf("Recorder failed to write frame, err: %v", err)
+			}
+		case <-ticker.C:
+			if r.buf != nil {
+				if err := r.flush(); err != nil {
+					log.Printf("Recorder failed to flush, err: %v", err)
+				}
+			}
+			if dropped := r.dropped.Swap(0); dropped > 0 {
+				log.Printf("Recorder dropped %d frames", dropped)
+			}
+		case done := <-r.stop:
+			r.drain()
+			done <- r.Close()
+			return
+		}
+	}
+}
+
+func (r *Recorder) drain() {
+	for {
+		select {
+		case frame := <-r.frames:
+			if err := r.write(frame); err != nil {
+				log.Printf("Recorder failed to write frame, err: %v", err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (r *Recorder) write(frame *Frame) error {
+	ts := time.Unix(0, frame.Ts)
+	if r.file == nil || ts.Sub(r.openedAt) >= r.Rotate {
+		if err := r.rotate(ts); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	_, err = r.buf.Write(append(line, '\n'))
+	return err
+}
+
+func (r *Recorder) rotate(ts time.Time) error {
+	if r.file != nil {
+		name := r.file.Name()
+		if err := r.Close(); err != nil {
+			log.Printf("Recorder failed to close '%s', err: %v", name, err)
+		}
+	}
+	path := filepath.Join(r.Dir, fmt.Sprintf("frames-%s.jsonl.gz", ts.UTC().Format(FILE_TIME_LAYOUT)))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.gz = gzip.NewWriter(file)
+	r.buf = bufio.NewWriter(r.gz)
+	r.openedAt = ts
+	return nil
+}
+
+func (r *Recorder) flush() error {
+	if err := r.buf.Flush(); err != nil {
+		return err
+	}
+	return r.gz.Flush()
+}
+
+// Close finishes the current file, a gzip file without footer can still be read until the last flush.
+// The file is closed even if the flush fails, the first error is returned.
+func (r *Recorder) Close() error {
+	if r == nil || r.file == nil {
+		return nil
+	}
+	var errs []error
+	if err := r.buf.Flush(); err != nil {
+		errs = append(errs, fmt.Errorf("flush: %v", err))
+	}
+	if err := r.gz.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("gzip: %v", err))
+	}
+	if err := r.file.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("file: %v", err))
+	}
+	r.file, r.gz, r.buf = nil, nil, nil
+	if len(errs) == 0 {
+		return nil
+	}
+	if len(errs) > 1 {
+		return fmt.Errorf("%v, and %d more errors: %v", errs[0], len(errs)-1, errs[1:])
+	}
+	return errs[0]
+}
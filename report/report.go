@@ -0,0 +1,168 @@
+package report
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/journal"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Report summarizes a period from the journal, websocket connections and wallet balances
+type Report struct {
+	From         time.Time                  `json:"from"`
+	To           time.Time                  `json:"to"`
+	Combinations []*CombinationSummary      `json:"combinations"`
+	Cycles       int                        `json:"cycles"`
+	Wins         int                        `json:"wins"`
+	Pnl          decimal.Decimal            `json:"pnl"` // trade.HOME_COIN
+	Fees         map[string]decimal.Decimal `json:"fees"`
+	Connections  []*ConnectionSummary       `json:"connections"`
+	Balances     []*BalanceChange           `json:"balances"`
+}
+
+type CombinationSummary struct {
+	Combination   string          `json:"combination"`
+	Opportunities int             `json:"opportunities"`
+	BestProfit    decimal.Decimal `json:"best_profit"` // 0.001 = 0.1%
+	MedianProfit  decimal.Decimal `json:"median_profit"`
+	Episodes      int             `json:"episodes"`
+	EpisodeMs     int64           `json:"episode_ms"` // total time above the threshold
+	Cycles        int             `json:"cycles"`
+	Pnl           decimal.Decimal `json:"pnl"`
+	profits       []decimal.Decimal
+}
+
+type ConnectionSummary struct {
+	Name       string  `json:"name"`
+	Uptime     float64 `json:"uptime"` // 0.999 = 99.9% of samples are connected
+	Reconnects int64   `json:"reconnects"`
+}
+
+type BalanceChange struct {
+	Coin   string          `json:"coin"`
+	Start  decimal.Decimal `json:"start"`
+	End    decimal.Decimal `json:"end"`
+	Change decimal.Decimal `json:"change"`
+}
+
+// summarizeJournal fills opportunities, episodes, cycles and fees of records within [From, To)
+func (r *Report) summarizeJournal(records []*journal.Record) {
+	combinationMap := make(map[string]*CombinationSummary)
+	combination := func(name string) *CombinationSummary {
+		summary, ok := combinationMap[name]
+		if !ok {
+			summary = &CombinationSummary{Combination: name}
+			combinationMap[name] = summary
+		}
+		return summary
+	}
+
+	for _, rec := range records {
+		switch rec.Type {
+		case journal.TYPE_OPPORTUNITY:
+			if rec.Start.IsZero() {
+				continue
+			}
+			summary := combination(rec.Combination)
+			summary.Opportunities++
+			summary.profits = append(summary.profits, rec.Pnl.Div(rec.Start))
+		case journal.TYPE_EPISODE:
+			summary := combination(rec.Combination)
+			summary.Episodes++
+			summary.EpisodeMs += rec.DurationMs
+		case journal.TYPE_CYCLE:
+			summary := combination(rec.Combination)
+			summary.Cycles++
+			summary.Pnl = summary.Pnl.Add(rec.Pnl)
+			r.Cycles++
+			if rec.Pnl.IsPositive() {
+				r.Wins++
+			}
+			r.Pnl = r.Pnl.Add(rec.Pnl)
+		}
+	}
+	r.Fees = journal.SummarizeFees(records)
+
+	r.Combinations = make([]*CombinationSummary, 0, len(combinationMap))
+	for _, summary := range combinationMap {
+		sort.Slice(summary.profits, func(i, j int) bool { return summary.profits[i].LessThan(summary.profits[j]) })
+		if n := len(summary.profits); n > 0 {
+			summary.BestProfit = summary.profits[n-1]
+			summary.MedianProfit = median(summary.profits)
+		}
+		r.Combinations = append(r.Combinations, summary)
+	}
+	sort.Slice(r.Combinations, func(i, j int) bool {
+		if r.Combinations[i].Opportunities != r.Combinations[j].Opportunities {
+			return r.Combinations[i].Opportunities > r.Combinations[j].Opportunities
+		}
+		return r.Combinations[i].Combination < r.Combinations[j].Combination
+	})
+}
+
+// median of sorted values
+func median(sorted []decimal.Decimal) decimal.Decimal {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return sorted[n/2-1].Add(sorted[n/2]).Div(decimal.NewFromInt(2))
+}
+
+// Text is posted to the notifiers and saved next to the JSON file
+func (r *Report) Text(formatter *clock.Formatter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Report %s - %s\n", formatter.Format(r.From), formatter.Format(r.To))
+	fmt.Fprintf(&b, "Cycles: %d (%d wins), PnL: %s USDT\n", r.Cycles, r.Wins, r.Pnl.StringFixed(4))
+
+	var fees []string
+	for coin, fee := range r.Fees {
+		fees = append(fees, fmt.Sprintf("%s %s", fee.String(), coin))
+	}
+	sort.Strings(fees)
+	fmt.Fprintf(&b, "Fees: %s\n", orNone(strings.Join(fees, ", ")))
+
+	b.WriteString("Combinations:\n")
+	if len(r.Combinations) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, c := range r.Combinations {
+		fmt.Fprintf(&b, "  %s: %d opportunities, best %s%%, median %s%%, %d episodes (%s), %d cycles, PnL %s\n",
+			c.Combination, c.Opportunities,
+			c.BestProfit.Shift(2).StringFixed(3), c.MedianProfit.Shift(2).StringFixed(3),
+			c.Episodes, (time.Duration(c.EpisodeMs) * time.Millisecond).Round(time.Second),
+			c.Cycles, c.Pnl.StringFixed(4))
+	}
+
+	b.WriteString("Connections:\n")
+	if len(r.Connections) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, c := range r.Connections {
+		fmt.Fprintf(&b, "  %s: uptime %.2f%%, %d reconnects\n", c.Name, c.Uptime*100, c.Reconnects)
+	}
+
+	b.WriteString("Balances:\n")
+	if len(r.Balances) == 0 {
+		b.WriteString("  none\n")
+	}
+	for _, c := range r.Balances {
+		change := c.Change.String()
+		if !c.Change.IsNegative() {
+			change = "+" + change
+		}
+		fmt.Fprintf(&b, "  %s: %s -> %s (%s)\n", c.Coin, c.Start.String(), c.End.String(), change)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
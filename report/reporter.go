@@ -0,0 +1,267 @@
+package report
+
+import (
+	"crypto-triangular-arbitrage-watch/bybit"
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/journal"
+	"crypto-triangular-arbitrage-watch/notification"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+const (
+	SCHEDULE_DAILY  = "daily"
+	SCHEDULE_HOURLY = "hourly"
+
+	DEFAULT_DIR            = "reports"
+	SAMPLE_INTERVAL_SECOND = 10
+	FILE_TIME_LAYOUT       = "20060102-1504"
+)
+
+// Reporter builds a report at the scheduled times, posts it to system_logs and saves it into Dir
+type Reporter struct {
+	Schedule   string
+	Times      []time.Duration // daily: since midnight, hourly: since the hour
+	Dir        string
+	Notifier   notification.Notifier
+	Journal    *journal.Journal
+	Formatter  *clock.Formatter // the schedule is in its timezone
+	ConnStates func() []bybit.ConnState
+	Wallets    func() map[string]decimal.Decimal
+
+	from       time.Time
+	samples    map[string]int // connection -> samples
+	upSamples  map[string]int // connection -> connected samples
+	reconnects map[string]int64
+	wallets    map[string]decimal.Decimal
+}
+
+// Init returns nil if REPORT_SCHEDULE isn't set
+func Init() *Reporter {
+	schedule := viper.GetString("REPORT_SCHEDULE")
+	if schedule == "" {
+		return nil
+	}
+	times, err := parseTimes(schedule, viper.GetStringSlice("REPORT_TIMES"))
+	if err != nil {
+		log.Fatalf("REPORT_TIMES is invalid: %v", err)
+	}
+	dir := viper.GetString("REPORT_DIR")
+	if dir == "" {
+		dir = DEFAULT_DIR
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Fatalf("Error creating report dir '%s': %v", dir, err)
+	}
+	return &Reporter{
+		Schedule:  schedule,
+		Times:     times,
+		Dir:       dir,
+		Formatter: clock.DefaultFormatter(),
+	}
+}
+
+// parseTimes parses HH:MM of daily or MM of hourly, it defaults to midnight or o'clock
+func parseTimes(schedule string, values []string) ([]time.Duration, error) {
+	if len(values) == 0 {
+		return []time.Duration{0}, nil
+	}
+	var times []time.Duration
+	for _, value := range values {
+		switch schedule {
+		case SCHEDULE_DAILY:
+			t, err := time.Parse("15:04", value)
+			if err != nil {
+				return nil, fmt.Errorf("'%s' of daily has to be HH:MM", value)
+			}
+			times = append(times, time.Duration(t.Hour())*time.Hour+time.Duration(t.Minute())*time.Minute)
+		case SCHEDULE_HOURLY:
+			minute, err := strconv.Atoi(value)
+			if err != nil || minute < 0 || minute > 59 {
+				return nil, fmt.Errorf("'%s' of hourly has to be the minute MM", value)
+			}
+			times = append(times, time.Duration(minute)*time.Minute)
+		default:
+			return nil, fmt.Errorf("REPORT_SCHEDULE '%s' not supported", schedule)
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	return times, nil
+}
+
+func (r *Reporter) SetNotifier(notifier notification.Notifier) {
+	r.Notifier = notifier
+}
+
+func (r *Reporter) SetJournal(j *journal.Journal) {
+	r.Journal = j
+}
+
+func (r *Reporter) SetFormatter(f *clock.Formatter) {
+	r.Formatter = f
+}
+
+func (r *Reporter) SetConnStates(connStates func() []bybit.ConnState) {
+	r.ConnStates = connStates
+}
+
+func (r *Reporter) SetWallets(wallets func() map[string]decimal.Decimal) {
+	r.Wallets = wallets
+}
+
+// next returns the first scheduled time after now
+func (r *Reporter) next(now time.Time) time.Time {
+	now = r.Formatter.In(now)
+	for i := 0; ; i++ {
+		for _, t := range r.Times {
+			var at time.Time
+			if r.Schedule == SCHEDULE_HOURLY {
+				at = time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+i, 0, 0, 0, now.Location()).Add(t)
+			} else {
+				at = time.Date(now.Year(), now.Month(), now.Day()+i, int(t/time.Hour), int(t%time.Hour/time.Minute), 0, 0, now.Location())
+			}
+			if at.After(now) {
+				return at
+			}
+		}
+	}
+}
+
+// Listen samples connections and reports at the scheduled times, it blocks
+func (r *Reporter) Listen() {
+	r.reset(r.Formatter.Now())
+	sampleTicker := time.NewTicker(time.Duration(SAMPLE_INTERVAL_SECOND) * time.Second)
+	defer sampleTicker.Stop()
+	for {
+		at := r.next(r.Formatter.Now())
+		timer := time.NewTimer(at.Sub(r.Formatter.Now()))
+	wait:
+		for {
+			select {
+			case <-sampleTicker.C:
+				r.sample()
+			case <-timer.C:
+				break wait
+			}
+		}
+		r.Report(at)
+	}
+}
+
+// Report builds the report since the last one, then posts and saves it
+func (r *Reporter) Report(to time.Time) *Report {
+	rep := r.Build(to)
+	text := rep.Text(r.Formatter)
+	if r.Notifier != nil {
+		r.Notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_INFO, text)
+	} else {
+		log.Println(text)
+	}
+	if err := r.save(rep, text); err != nil {
+		log.Printf("Error saving report: %v", err)
+	}
+	r.reset(to)
+	return rep
+}
+
+// Build doesn't reset the period, it can be used for an ad-hoc report
+func (r *Reporter) Build(to time.Time) *Report {
+	rep := &Report{From: r.from, To: to}
+	if r.Journal != nil {
+		records, err := r.Journal.Records(func(rec *journal.Record) bool {
+			return !rec.Ts.Before(r.from) && rec.Ts.Before(to)
+		})
+		if err != nil {
+			log.Printf("Error reading journal for the report: %v", err)
+		}
+		rep.summarizeJournal(records)
+	} else {
+		rep.summarizeJournal(nil)
+	}
+
+	rep.Connections = make([]*ConnectionSummary, 0)
+	if r.ConnStates != nil {
+		for _, state := range r.ConnStates() {
+			summary := &ConnectionSummary{Name: state.Name, Reconnects: state.Reconnects - r.reconnects[state.Name]}
+			if samples := r.samples[state.Name]; samples > 0 {
+				summary.Uptime = float64(r.upSamples[state.Name]) / float64(samples)
+			} else if state.Connected {
+				summary.Uptime = 1
+			}
+			rep.Connections = append(rep.Connections, summary)
+		}
+	}
+
+	rep.Balances = make([]*BalanceChange, 0)
+	if r.Wallets != nil {
+		wallets := r.Wallets()
+		coins := make(map[string]bool)
+		for coin := range wallets {
+			coins[coin] = true
+		}
+		for coin := range r.wallets {
+			coins[coin] = true
+		}
+		for coin := range coins {
+			start, end := r.wallets[coin], wallets[coin]
+			if start.IsZero() && end.IsZero() {
+				continue
+			}
+			rep.Balances = append(rep.Balances, &BalanceChange{Coin: coin, Start: start, End: end, Change: end.Sub(start)})
+		}
+		sort.Slice(rep.Balances, func(i, j int) bool { return rep.Balances[i].Coin < rep.Balances[j].Coin })
+	}
+	return rep
+}
+
+func (r *Reporter) sample() {
+	if r.ConnStates == nil {
+		return
+	}
+	for _, state := range r.ConnStates() {
+		r.samples[state.Name]++
+		if state.Connected {
+			r.upSamples[state.Name]++
+		}
+	}
+}
+
+// reset starts a new period, reconnects and wallets are the baseline of the period
+func (r *Reporter) reset(from time.Time) {
+	r.from = from
+	r.samples = make(map[string]int)
+	r.upSamples = make(map[string]int)
+	r.reconnects = make(map[string]int64)
+	if r.ConnStates != nil {
+		for _, state := range r.ConnStates() {
+			r.reconnects[state.Name] = state.Reconnects
+		}
+	}
+	r.wallets = make(map[string]decimal.Decimal)
+	if r.Wallets != nil {
+		r.wallets = r.Wallets()
+	}
+}
+
+// save writes report-<to>.json and report-<to>.txt
+func (r *Reporter) save(rep *Report, text string) error {
+	name := "report-" + r.Formatter.In(rep.To).Format(FILE_TIME_LAYOUT)
+	body, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filepath.Join(r.Dir, name+".json"), body, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(r.Dir, name+".txt"), []byte(strings.TrimSpace(text)+"\n"), 0644)
+}
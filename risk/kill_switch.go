@@ -0,0 +1,270 @@
+package risk
+
+import (
+	"crypto-triangular-arbitrage-watch/notification"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+const (
+	CHECK_KILL_SWITCH = "kill_switch"
+
+	KILL_SWITCH_CHECK_INTERVAL_SECOND      = 1
+	KILL_SWITCH_CLOCK_SKEW_INTERVAL_SECOND = 60
+	KILL_SWITCH_API_ERRORS_WINDOW_SECOND   = 60
+)
+
+// KillSwitch halts new executions once it's triggered, it stays triggered (even after restarts) until it's re-armed explicitly
+type KillSwitch struct {
+	Notifier                notification.Notifier
+	StatePath               string // kill_switch.json
+	FlagPath                string // Trigger if the file exists
+	Unwind                  bool   // Sell all coins back to trade.HOME_COIN when it's triggered
+	MaxConsecutiveLosses    int
+	MaxDrawdown             decimal.Decimal // trade.HOME_COIN
+	MaxApiErrors            int             // within KILL_SWITCH_API_ERRORS_WINDOW_SECOND
+	PrivateChannelDownLimit time.Duration
+	MaxClockSkew            time.Duration
+	Unwinder                func()
+	ClockSkewChecker        func() (time.Duration, error) // local time - exchange time
+
+	mu                   sync.Mutex
+	state                KillSwitchState
+	consecutiveLosses    int
+	pnl                  decimal.Decimal
+	peakPnl              decimal.Decimal
+	apiErrors            []time.Time
+	privateChannelDownAt time.Time
+}
+
+type KillSwitchState struct {
+	Triggered   bool      `json:"triggered"`
+	Reason      string    `json:"reason"`
+	TriggeredAt time.Time `json:"triggered_at"`
+	ArmedAt     time.Time `json:"armed_at"`
+}
+
+func InitKillSwitch() *KillSwitch {
+	ks := &KillSwitch{
+		StatePath:               viper.GetString("KILL_SWITCH_STATE_PATH"),
+		FlagPath:                viper.GetString("KILL_SWITCH_FLAG_PATH"),
+		Unwind:                  viper.GetBool("KILL_SWITCH_UNWIND"),
+		MaxConsecutiveLosses:    viper.GetInt("KILL_SWITCH_MAX_CONSECUTIVE_LOSSES"),
+		MaxDrawdown:             decimalFromConfig("KILL_SWITCH_MAX_DRAWDOWN"),
+		MaxApiErrors:            viper.GetInt("KILL_SWITCH_MAX_API_ERRORS"),
+		PrivateChannelDownLimit: time.Duration(viper.GetInt("KILL_SWITCH_PRIVATE_CHANNEL_DOWN_SECOND")) * time.Second,
+		MaxClockSkew:            time.Duration(viper.GetInt("KILL_SWITCH_MAX_CLOCK_SKEW_MILLISECOND")) * time.Millisecond,
+	}
+	if ks.StatePath == "" {
+		ks.StatePath = "kill_switch.json"
+	}
+	ks.loadState()
+	return ks
+}
+
+func (ks *KillSwitch) SetNotifier(notifier notification.Notifier) {
+	ks.Notifier = notifier
+}
+
+func (ks *KillSwitch) SetUnwinder(unwinder func()) {
+	ks.Unwinder = unwinder
+}
+
+func (ks *KillSwitch) SetClockSkewChecker(checker func() (time.Duration, error)) {
+	ks.ClockSkewChecker = checker
+}
+
+func (ks *KillSwitch) loadState() {
+	body, err := os.ReadFile(ks.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error reading kill switch state: %v", err)
+	}
+	if err = json.Unmarshal(body, &ks.state); err != nil {
+		log.Fatalf("Error unmarshaling kill switch state: %v", err)
+	}
+	if ks.state.Triggered {
+		log.Printf("Kill switch is still triggered since %s, reason: %s", ks.state.TriggeredAt, ks.state.Reason)
+	}
+}
+
+func (ks *KillSwitch) saveState() {
+	body, err := json.Marshal(ks.state)
+	if err != nil {
+		log.Printf("Error marshaling kill switch state: %v", err)
+		return
+	}
+	if err = os.WriteFile(ks.StatePath, body, 0644); err != nil {
+		log.Printf("Error writing kill switch state: %v", err)
+	}
+}
+
+func (ks *KillSwitch) State() KillSwitchState {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.state
+}
+
+func (ks *KillSwitch) Triggered() bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.state.Triggered
+}
+
+func (ks *KillSwitch) Trigger(reason string) {
+	ks.mu.Lock()
+	if ks.state.Triggered {
+		ks.mu.Unlock()
+		return
+	}
+	ks.state.Triggered = true
+	ks.state.Reason = reason
+	ks.state.TriggeredAt = time.Now()
+	ks.saveState()
+	ks.mu.Unlock()
+
+	ks.log(notification.SEVERITY_CRITICAL, fmt.Sprintf("Kill switch triggered, reason: %s", reason))
+	if ks.Unwind && ks.Unwinder != nil {
+		go ks.Unwinder()
+	}
+}
+
+// Arm re-enables executions, the flag file has to be removed before arming otherwise it will be triggered again
+func (ks *KillSwitch) Arm() {
+	ks.mu.Lock()
+	ks.state = KillSwitchState{ArmedAt: time.Now()}
+	ks.consecutiveLosses = 0
+	ks.pnl = decimal.Zero
+	ks.peakPnl = decimal.Zero
+	ks.apiErrors = nil
+	ks.saveState()
+	ks.mu.Unlock()
+
+	ks.log(notification.SEVERITY_WARNING, "Kill switch armed")
+}
+
+// Check is used by Risk to reject new orders and cycles
+func (ks *KillSwitch) Check() error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if ks.state.Triggered {
+		return &RejectError{Check: CHECK_KILL_SWITCH, Reason: ks.state.Reason}
+	}
+	return nil
+}
+
+// RecordCycle tracks consecutive losing cycles and drawdown of the cumulative pnl
+func (ks *KillSwitch) RecordCycle(pnl decimal.Decimal) {
+	ks.mu.Lock()
+	if pnl.IsNegative() {
+		ks.consecutiveLosses++
+	} else {
+		ks.consecutiveLosses = 0
+	}
+	ks.pnl = ks.pnl.Add(pnl)
+	if ks.pnl.GreaterThan(ks.peakPnl) {
+		ks.peakPnl = ks.pnl
+	}
+	drawdown := ks.peakPnl.Sub(ks.pnl)
+	consecutiveLosses := ks.consecutiveLosses
+	ks.mu.Unlock()
+
+	if ks.MaxConsecutiveLosses > 0 && consecutiveLosses >= ks.MaxConsecutiveLosses {
+		ks.Trigger(fmt.Sprintf("%d consecutive losing cycles", consecutiveLosses))
+	}
+	if !ks.MaxDrawdown.IsZero() && drawdown.GreaterThanOrEqual(ks.MaxDrawdown) {
+		ks.Trigger(fmt.Sprintf("drawdown %s reaches %s", drawdown, ks.MaxDrawdown))
+	}
+}
+
+func (ks *KillSwitch) RecordApiError(err error) {
+	ks.mu.Lock()
+	now := time.Now()
+	var errs []time.Time
+	for _, t := range ks.apiErrors {
+		if now.Sub(t) <= time.Duration(KILL_SWITCH_API_ERRORS_WINDOW_SECOND)*time.Second {
+			errs = append(errs, t)
+		}
+	}
+	ks.apiErrors = append(errs, now)
+	count := len(ks.apiErrors)
+	ks.mu.Unlock()
+
+	if ks.MaxApiErrors > 0 && count >= ks.MaxApiErrors {
+		ks.Trigger(fmt.Sprintf("%d API errors in %ds, last: %v", count, KILL_SWITCH_API_ERRORS_WINDOW_SECOND, err))
+	}
+}
+
+func (ks *KillSwitch) SetPrivateChannelUp(up bool) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if up {
+		ks.privateChannelDownAt = time.Time{}
+	} else if ks.privateChannelDownAt.IsZero() {
+		ks.privateChannelDownAt = time.Now()
+	}
+}
+
+// Listen watches the flag file, SIGUSR1, the private channel and the clock skew
+func (ks *KillSwitch) Listen() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+
+	ticker := time.NewTicker(time.Duration(KILL_SWITCH_CHECK_INTERVAL_SECOND) * time.Second)
+	defer ticker.Stop()
+	clockSkewTicker := time.NewTicker(time.Duration(KILL_SWITCH_CLOCK_SKEW_INTERVAL_SECOND) * time.Second)
+	defer clockSkewTicker.Stop()
+	for {
+		select {
+		case sig := <-sigs:
+			ks.Trigger(fmt.Sprintf("signal %v", sig))
+		case <-ticker.C:
+			if ks.FlagPath != "" {
+				if _, err := os.Stat(ks.FlagPath); err == nil {
+					ks.Trigger(fmt.Sprintf("flag file '%s' exists", ks.FlagPath))
+				}
+			}
+			ks.mu.Lock()
+			downAt := ks.privateChannelDownAt
+			ks.mu.Unlock()
+			if ks.PrivateChannelDownLimit > 0 && !downAt.IsZero() && time.Since(downAt) >= ks.PrivateChannelDownLimit {
+				ks.Trigger(fmt.Sprintf("private channel has been down since %s", downAt.Format(time.RFC3339)))
+			}
+		case <-clockSkewTicker.C:
+			if ks.MaxClockSkew == 0 || ks.ClockSkewChecker == nil {
+				continue
+			}
+			skew, err := ks.ClockSkewChecker()
+			if err != nil {
+				ks.RecordApiError(err)
+				continue
+			}
+			if skew < 0 {
+				skew = -skew
+			}
+			if skew >= ks.MaxClockSkew {
+				ks.Trigger(fmt.Sprintf("clock skew %v reaches %v", skew, ks.MaxClockSkew))
+			}
+		}
+	}
+}
+
+func (ks *KillSwitch) log(severity notification.Severity, msg string) {
+	if ks.Notifier == nil {
+		log.Println(msg)
+		return
+	}
+	ks.Notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, severity, msg)
+}
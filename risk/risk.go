@@ -0,0 +1,321 @@
+package risk
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/notification"
+	"crypto-triangular-arbitrage-watch/trade"
+	"crypto-triangular-arbitrage-watch/tri"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+	"github.com/spf13/viper"
+)
+
+const (
+	CHECK_ALLOWLIST          = "allowlist"
+	CHECK_INSTRUMENT         = "instrument"
+	CHECK_PRICE              = "price"
+	CHECK_MIN_ORDER_QTY      = "min_order_qty"
+	CHECK_MAX_ORDER_QTY      = "max_order_qty"
+	CHECK_MIN_ORDER_AMT      = "min_order_amt"
+	CHECK_MAX_ORDER_AMT      = "max_order_amt"
+	CHECK_MAX_ORDER_NOTIONAL = "max_order_notional"
+	CHECK_MAX_CYCLE_NOTIONAL = "max_cycle_notional"
+	CHECK_MAX_OPEN_CYCLES    = "max_open_cycles"
+	CHECK_DAILY_LOSS_LIMIT   = "daily_loss_limit"
+	CHECK_INVENTORY_CAP      = "inventory_cap"
+	CHECK_CYCLE              = "cycle"
+)
+
+// Risk sits in front of order placement, every order and every cycle has to pass its checks first.
+// Notional values are measured in trade.HOME_COIN, zero limits mean unlimited.
+type Risk struct {
+	Tri              *tri.Tri
+	Notifier         notification.Notifier
+	KillSwitch       *KillSwitch
+	MaxOrderNotional decimal.Decimal
+	MaxCycleNotional decimal.Decimal
+	MaxOpenCycles    int
+	DailyLossLimit   decimal.Decimal
+	InventoryCaps    map[string]decimal.Decimal // coin -> max balance
+	AllowedSymbols   map[string]bool
+	Inventory        *trade.Inventory
+	Formatter        *clock.Formatter // the day of DailyLossLimit starts at midnight of TIMEZONE
+
+	mu          sync.Mutex
+	openCycles  map[int64]decimal.Decimal // cycle id -> notional
+	nextCycleId int64
+	day         string // date of dailyPnl in TIMEZONE
+	dailyPnl    decimal.Decimal
+}
+
+// RejectError is returned when an order or a cycle fails one of the checks
+type RejectError struct {
+	Check  string
+	Symbol string
+	Reason string
+}
+
+func (e *RejectError) Error() string {
+	if e.Symbol == "" {
+		return fmt.Sprintf("risk check '%s' rejected: %s", e.Check, e.Reason)
+	}
+	return fmt.Sprintf("risk check '%s' rejected '%s': %s", e.Check, e.Symbol, e.Reason)
+}
+
+func Init(tri *tri.Tri) *Risk {
+	r := &Risk{
+		Tri:              tri,
+		MaxOrderNotional: decimalFromConfig("RISK_MAX_ORDER_NOTIONAL"),
+		MaxCycleNotional: decimalFromConfig("RISK_MAX_CYCLE_NOTIONAL"),
+		MaxOpenCycles:    viper.GetInt("RISK_MAX_OPEN_CYCLES"),
+		DailyLossLimit:   decimalFromConfig("RISK_DAILY_LOSS_LIMIT"),
+		InventoryCaps:    make(map[string]decimal.Decimal),
+		AllowedSymbols:   make(map[string]bool),
+		openCycles:       make(map[int64]decimal.Decimal),
+		Formatter:        clock.DefaultFormatter(),
+	}
+	for coin, cap := range viper.GetStringMapString("RISK_INVENTORY_CAPS") {
+		c, err := decimal.NewFromString(cap)
+		if err != nil {
+			log.Fatalf("RISK_INVENTORY_CAPS '%s' is invalid: %v", coin, err)
+		}
+		// viper lowercases map keys
+		r.InventoryCaps[strings.ToUpper(coin)] = c
+	}
+
+	// Only symbols in the combinations can be traded if the allowlist isn't set
+	symbols := viper.GetStringSlice("RISK_ALLOWED_SYMBOLS")
+	if len(symbols) == 0 {
+		for symbol := range tri.SymbolOrdersMap {
+			symbols = append(symbols, symbol)
+		}
+	}
+	for _, symbol := range symbols {
+		r.AllowedSymbols[symbol] = true
+	}
+	return r
+}
+
+func decimalFromConfig(key string) decimal.Decimal {
+	if viper.GetString(key) == "" {
+		return decimal.Zero
+	}
+	d, err := decimal.NewFromString(viper.GetString(key))
+	if err != nil {
+		log.Fatalf("%s is invalid: %v", key, err)
+	}
+	return d
+}
+
+func (r *Risk) SetNotifier(notifier notification.Notifier) {
+	r.Notifier = notifier
+}
+
+func (r *Risk) SetKillSwitch(ks *KillSwitch) {
+	r.KillSwitch = ks
+}
+
+func (r *Risk) SetInventory(inventory *trade.Inventory) {
+	r.Inventory = inventory
+}
+
+func (r *Risk) SetFormatter(f *clock.Formatter) {
+	r.Formatter = f
+}
+
+// CheckOrder has to be called with the qty which will be sent to Bybit,
+// qty is quote coin for Buy and base coin for Sell (market order)
+func (r *Risk) CheckOrder(side string, symbol string, qty decimal.Decimal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkKillSwitch(); err != nil {
+		return err
+	}
+	if !r.AllowedSymbols[symbol] {
+		return r.reject(CHECK_ALLOWLIST, symbol, "symbol isn't in the allowlist")
+	}
+	instrument, ok := r.Tri.SymbolInstrumentMap[symbol]
+	if !ok {
+		return r.reject(CHECK_INSTRUMENT, symbol, "instrument doesn't exist")
+	}
+
+	// Order amount in quote coin and the coin (and its amount) that will be received
+	var amt, received decimal.Decimal
+	var receivedCoin string
+	switch side {
+	case trade.SIDE_BUY:
+		if err := r.checkRange(CHECK_MIN_ORDER_AMT, CHECK_MAX_ORDER_AMT, symbol, qty, instrument.MinOrderAmt, instrument.MaxOrderAmt); err != nil {
+			return err
+		}
+		// The symbol can be allowlisted without being in the combinations e.g. to unwind
+		_, ask, ok := r.Tri.TopPrices(symbol)
+		if !ok || ask.IsZero() {
+			return r.reject(CHECK_PRICE, symbol, "ask price isn't available")
+		}
+		amt = qty
+		received = qty.Div(ask)
+		receivedCoin = instrument.BaseCoin
+	case trade.SIDE_SELL:
+		if err := r.checkRange(CHECK_MIN_ORDER_QTY, CHECK_MAX_ORDER_QTY, symbol, qty, instrument.MinOrderQty, instrument.MaxOrderQty); err != nil {
+			return err
+		}
+		bid, _, ok := r.Tri.TopPrices(symbol)
+		if !ok || bid.IsZero() {
+			return r.reject(CHECK_PRICE, symbol, "bid price isn't available")
+		}
+		amt = qty.Mul(bid)
+		received = amt
+		receivedCoin = instrument.QuoteCoin
+	default:
+		return r.reject(CHECK_INSTRUMENT, symbol, fmt.Sprintf("side '%s' not supported", side))
+	}
+
+	if !r.MaxOrderNotional.IsZero() {
+		notional, err := r.toHomeCoin(instrument.QuoteCoin, amt)
+		if err != nil {
+			return r.reject(CHECK_PRICE, symbol, err.Error())
+		}
+		if notional.GreaterThan(r.MaxOrderNotional) {
+			return r.reject(CHECK_MAX_ORDER_NOTIONAL, symbol, fmt.Sprintf("notional %s exceeds %s", notional.StringFixed(2), r.MaxOrderNotional))
+		}
+	}
+
+	if cap, ok := r.InventoryCaps[receivedCoin]; ok {
+		var after decimal.Decimal
+		if r.Inventory != nil {
+			after = r.Inventory.Wallet(receivedCoin)
+		}
+		after = after.Add(received)
+		if after.GreaterThan(cap) {
+			return r.reject(CHECK_INVENTORY_CAP, symbol, fmt.Sprintf("%s balance %s would exceed %s", receivedCoin, after, cap))
+		}
+	}
+	return nil
+}
+
+func (r *Risk) checkRange(minCheck string, maxCheck string, symbol string, qty decimal.Decimal, min string, max string) error {
+	if min != "" {
+		m, err := decimal.NewFromString(min)
+		if err != nil {
+			return r.reject(minCheck, symbol, err.Error())
+		}
+		if qty.LessThan(m) {
+			return r.reject(minCheck, symbol, fmt.Sprintf("%s is less than %s", qty, min))
+		}
+	}
+	if max != "" {
+		m, err := decimal.NewFromString(max)
+		if err != nil {
+			return r.reject(maxCheck, symbol, err.Error())
+		}
+		if qty.GreaterThan(m) {
+			return r.reject(maxCheck, symbol, fmt.Sprintf("%s is greater than %s", qty, max))
+		}
+	}
+	return nil
+}
+
+// e.g. BTC -> USDT uses the bid price of BTCUSDT
+func (r *Risk) toHomeCoin(coin string, amt decimal.Decimal) (decimal.Decimal, error) {
+	if coin == trade.HOME_COIN {
+		return amt, nil
+	}
+	bid, _, ok := r.Tri.TopPrices(coin + trade.HOME_COIN)
+	if !ok || bid.IsZero() {
+		return decimal.Zero, fmt.Errorf("price of %s%s isn't available", coin, trade.HOME_COIN)
+	}
+	return amt.Mul(bid), nil
+}
+
+// BeginCycle has to be called by the executor before the first order of a triangular trade, notional is in trade.HOME_COIN.
+// The cycle limits are only enforced here, the order path checks each order alone.
+func (r *Risk) BeginCycle(notional decimal.Decimal) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.checkKillSwitch(); err != nil {
+		return 0, err
+	}
+	if !r.MaxCycleNotional.IsZero() && notional.GreaterThan(r.MaxCycleNotional) {
+		return 0, r.reject(CHECK_MAX_CYCLE_NOTIONAL, "", fmt.Sprintf("notional %s exceeds %s", notional, r.MaxCycleNotional))
+	}
+	if r.MaxOpenCycles > 0 && len(r.openCycles) >= r.MaxOpenCycles {
+		return 0, r.reject(CHECK_MAX_OPEN_CYCLES, "", fmt.Sprintf("%d cycles are open", len(r.openCycles)))
+	}
+	r.rollDay()
+	if !r.DailyLossLimit.IsZero() && r.dailyPnl.Neg().GreaterThanOrEqual(r.DailyLossLimit) {
+		return 0, r.reject(CHECK_DAILY_LOSS_LIMIT, "", fmt.Sprintf("today's loss %s reaches %s", r.dailyPnl.Neg(), r.DailyLossLimit))
+	}
+
+	r.nextCycleId++
+	r.openCycles[r.nextCycleId] = notional
+	return r.nextCycleId, nil
+}
+
+// EndCycle closes the cycle with its realised pnl in trade.HOME_COIN
+func (r *Risk) EndCycle(id int64, pnl decimal.Decimal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.openCycles[id]; !ok {
+		return r.reject(CHECK_CYCLE, "", fmt.Sprintf("cycle %d isn't open", id))
+	}
+	delete(r.openCycles, id)
+	r.rollDay()
+	r.dailyPnl = r.dailyPnl.Add(pnl)
+	if r.KillSwitch != nil {
+		go r.KillSwitch.RecordCycle(pnl)
+	}
+	return nil
+}
+
+func (r *Risk) OpenCycles() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.openCycles)
+}
+
+func (r *Risk) DailyPnl() decimal.Decimal {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rollDay()
+	return r.dailyPnl
+}
+
+func (r *Risk) rollDay() {
+	today := r.Formatter.Today()
+	if r.day != today {
+		r.day = today
+		r.dailyPnl = decimal.Zero
+	}
+}
+
+func (r *Risk) checkKillSwitch() error {
+	if r.KillSwitch == nil {
+		return nil
+	}
+	if err := r.KillSwitch.Check(); err != nil {
+		r.logReject(err)
+		return err
+	}
+	return nil
+}
+
+func (r *Risk) reject(check string, symbol string, reason string) error {
+	err := &RejectError{Check: check, Symbol: symbol, Reason: reason}
+	r.logReject(err)
+	return err
+}
+
+func (r *Risk) logReject(err error) {
+	if r.Notifier == nil {
+		log.Println(err)
+		return
+	}
+	r.Notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_WARNING, err.Error())
+}
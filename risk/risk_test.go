@@ -0,0 +1,201 @@
+package risk
+
+import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/notification"
+	"crypto-triangular-arbitrage-watch/trade"
+	"crypto-triangular-arbitrage-watch/tri"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestDailyPnlRollsAtMidnightOfTimezone(t *testing.T) {
+	location, err := time.LoadLocation("Asia/Taipei")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := &clock.Sim{}
+	sim.Set(time.Date(2024, 3, 1, 15, 0, 0, 0, time.UTC)) // 23:00 in Taipei
+	f := &clock.Formatter{Clock: sim, Location: location, Layout: clock.DEFAULT_TIME_LAYOUT}
+	r := &Risk{openCycles: make(map[int64]decimal.Decimal)}
+	r.SetFormatter(f)
+
+	r.openCycles[1] = decimal.NewFromInt(100)
+	if err = r.EndCycle(1, decimal.NewFromInt(-5)); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.DailyPnl(); !got.Equal(decimal.NewFromInt(-5)) {
+		t.Errorf("DailyPnl() = %s, want -5", got)
+	}
+
+	// Still the same UTC day, but the next day in Taipei
+	sim.Set(time.Date(2024, 3, 1, 16, 0, 0, 0, time.UTC))
+	if got := r.DailyPnl(); !got.IsZero() {
+		t.Errorf("DailyPnl() = %s after midnight, want 0", got)
+	}
+}
+
+// testRisk allows BTCUSDT, ETHBTC and DOGEUSDT, DOGEUSDT has no instrument
+func testRisk(t *testing.T) *Risk {
+	tr := tri.Init()
+	for _, symbol := range []string{"BTCUSDT", "ETHBTC", "ETHUSDT"} {
+		tr.SymbolOrdersMap[symbol] = &tri.SymbolOrder{Symbol: symbol}
+	}
+	tr.SymbolInstrumentMap["BTCUSDT"] = &tri.Instrument{BaseCoin: "BTC", QuoteCoin: "USDT", MinOrderQty: "0.0001", MaxOrderQty: "10", MinOrderAmt: "1", MaxOrderAmt: "100000"}
+	tr.SymbolInstrumentMap["ETHBTC"] = &tri.Instrument{BaseCoin: "ETH", QuoteCoin: "BTC", MinOrderQty: "0.01", MaxOrderQty: "100", MinOrderAmt: "0.0001", MaxOrderAmt: "10"}
+	tr.SymbolInstrumentMap["ETHUSDT"] = &tri.Instrument{BaseCoin: "ETH", QuoteCoin: "USDT", MinOrderQty: "0.01", MaxOrderQty: "100", MinOrderAmt: "1", MaxOrderAmt: "100000"}
+	setPrices(t, tr, "BTCUSDT", "40000", "40001")
+	setPrices(t, tr, "ETHBTC", "0.05", "0.051")
+	return &Risk{
+		Tri:            tr,
+		InventoryCaps:  make(map[string]decimal.Decimal),
+		AllowedSymbols: map[string]bool{"BTCUSDT": true, "ETHBTC": true, "ETHUSDT": true, "DOGEUSDT": true},
+		Inventory:      trade.InitInventory(),
+		Formatter:      clock.DefaultFormatter(),
+		openCycles:     make(map[int64]decimal.Decimal),
+		Notifier:       discardNotifier{},
+	}
+}
+
+func setPrices(t *testing.T, tr *tri.Tri, symbol string, bid string, ask string) {
+	if err := tr.UpdatePrice(trade.BID, symbol, tri.Price{bid, "1"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tr.UpdatePrice(trade.ASK, symbol, tri.Price{ask, "1"}, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type discardNotifier struct{}
+
+func (discardNotifier) Notify(channel string, severity notification.Severity, text string) {}
+func (discardNotifier) SystemLogs(text string)                                             {}
+func (discardNotifier) Publish(msg *notification.Message)                                  {}
+
+func TestCheckOrder(t *testing.T) {
+	cases := []struct {
+		name   string
+		setup  func(r *Risk)
+		side   string
+		symbol string
+		qty    string
+		want   string // check of the RejectError, empty if it passes
+	}{
+		{"buy passes", nil, trade.SIDE_BUY, "BTCUSDT", "100", ""},
+		{"sell passes", nil, trade.SIDE_SELL, "BTCUSDT", "0.001", ""},
+		{"not in the allowlist", nil, trade.SIDE_BUY, "XRPUSDT", "100", CHECK_ALLOWLIST},
+		{"unknown instrument", nil, trade.SIDE_BUY, "DOGEUSDT", "100", CHECK_INSTRUMENT},
+		{"unknown side", nil, "Hold", "BTCUSDT", "100", CHECK_INSTRUMENT},
+		{"missing ask", nil, trade.SIDE_BUY, "ETHUSDT", "100", CHECK_PRICE},
+		{"missing bid", nil, trade.SIDE_SELL, "ETHUSDT", "1", CHECK_PRICE},
+		{"zero ask", func(r *Risk) { setPrices(t, r.Tri, "BTCUSDT", "0", "0") }, trade.SIDE_BUY, "BTCUSDT", "100", CHECK_PRICE},
+		{"min order amt", nil, trade.SIDE_BUY, "BTCUSDT", "0.5", CHECK_MIN_ORDER_AMT},
+		{"max order amt", nil, trade.SIDE_BUY, "BTCUSDT", "100001", CHECK_MAX_ORDER_AMT},
+		{"min order qty", nil, trade.SIDE_SELL, "BTCUSDT", "0.00001", CHECK_MIN_ORDER_QTY},
+		{"max order qty", nil, trade.SIDE_SELL, "BTCUSDT", "11", CHECK_MAX_ORDER_QTY},
+		{"max order notional", func(r *Risk) { r.MaxOrderNotional = decimal.NewFromInt(50) }, trade.SIDE_BUY, "BTCUSDT", "100", CHECK_MAX_ORDER_NOTIONAL},
+		// 2 ETH * 0.05 BTC * 40000 USDT = 4000 USDT
+		{"max order notional of a non-home quote", func(r *Risk) { r.MaxOrderNotional = decimal.NewFromInt(1000) }, trade.SIDE_SELL, "ETHBTC", "2", CHECK_MAX_ORDER_NOTIONAL},
+		{"notional can't be converted", func(r *Risk) {
+			r.MaxOrderNotional = decimal.NewFromInt(1000)
+			r.Tri.SymbolOrdersMap["BTCUSDT"].Bid = nil
+		}, trade.SIDE_SELL, "ETHBTC", "2", CHECK_PRICE},
+		{"inventory cap", func(r *Risk) {
+			r.InventoryCaps["BTC"] = decimal.NewFromFloat(0.01)
+			r.Inventory.Update("BTC", decimal.NewFromFloat(0.009), decimal.NewFromFloat(0.009), decimal.Zero, time.Now())
+		}, trade.SIDE_BUY, "BTCUSDT", "100", CHECK_INVENTORY_CAP},
+		{"kill switch", func(r *Risk) {
+			r.KillSwitch = &KillSwitch{StatePath: filepath.Join(t.TempDir(), "kill_switch.json")}
+			r.KillSwitch.state.Triggered = true
+		}, trade.SIDE_BUY, "BTCUSDT", "100", CHECK_KILL_SWITCH},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := testRisk(t)
+			if c.setup != nil {
+				c.setup(r)
+			}
+			err := r.CheckOrder(c.side, c.symbol, decimal.RequireFromString(c.qty))
+			assertReject(t, err, c.want)
+		})
+	}
+}
+
+func TestBeginCycle(t *testing.T) {
+	cases := []struct {
+		name     string
+		setup    func(r *Risk)
+		notional int64
+		want     string
+	}{
+		{"passes", nil, 100, ""},
+		{"max cycle notional", func(r *Risk) { r.MaxCycleNotional = decimal.NewFromInt(50) }, 100, CHECK_MAX_CYCLE_NOTIONAL},
+		{"max open cycles", func(r *Risk) {
+			r.MaxOpenCycles = 1
+			if _, err := r.BeginCycle(decimal.NewFromInt(10)); err != nil {
+				t.Fatal(err)
+			}
+		}, 100, CHECK_MAX_OPEN_CYCLES},
+		{"daily loss limit", func(r *Risk) {
+			r.DailyLossLimit = decimal.NewFromInt(10)
+			id, err := r.BeginCycle(decimal.NewFromInt(10))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.EndCycle(id, decimal.NewFromInt(-10)); err != nil {
+				t.Fatal(err)
+			}
+		}, 100, CHECK_DAILY_LOSS_LIMIT},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := testRisk(t)
+			if c.setup != nil {
+				c.setup(r)
+			}
+			_, err := r.BeginCycle(decimal.NewFromInt(c.notional))
+			assertReject(t, err, c.want)
+		})
+	}
+}
+
+func TestEndCycle(t *testing.T) {
+	r := testRisk(t)
+	r.MaxOpenCycles = 1
+	id, err := r.BeginCycle(decimal.NewFromInt(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.EndCycle(id, decimal.NewFromInt(1)); err != nil {
+		t.Fatal(err)
+	}
+	if r.OpenCycles() != 0 {
+		t.Errorf("OpenCycles() = %d, want 0", r.OpenCycles())
+	}
+	assertReject(t, r.EndCycle(id, decimal.Zero), CHECK_CYCLE)
+	// The slot is free again
+	if _, err = r.BeginCycle(decimal.NewFromInt(10)); err != nil {
+		t.Errorf("BeginCycle() after EndCycle = %v", err)
+	}
+}
+
+func assertReject(t *testing.T, err error, check string) {
+	t.Helper()
+	if check == "" {
+		if err != nil {
+			t.Fatalf("err = %v, want nil", err)
+		}
+		return
+	}
+	var reject *RejectError
+	if !errors.As(err, &reject) {
+		t.Fatalf("err = %v, want a RejectError of '%s'", err, check)
+	}
+	if reject.Check != check {
+		t.Fatalf("check = '%s' (%s), want '%s'", reject.Check, reject.Reason, check)
+	}
+}
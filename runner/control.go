@@ -0,0 +1,137 @@
+package runner
+
+import (
+	"crypto-triangular-arbitrage-watch/tri"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// control holds settings which are changed at runtime e.g. by Slack commands
+type control struct {
+	mu       sync.RWMutex
+	paused   bool
+	disabled map[string]bool // combination name
+}
+
+// Pause stops detection, prices of orderbooks are still updated
+func (or *OrderbookRunner) Pause() {
+	or.control.mu.Lock()
+	defer or.control.mu.Unlock()
+	or.control.paused = true
+}
+
+func (or *OrderbookRunner) Resume() {
+	or.control.mu.Lock()
+	defer or.control.mu.Unlock()
+	or.control.paused = false
+}
+
+func (or *OrderbookRunner) Paused() bool {
+	or.control.mu.RLock()
+	defer or.control.mu.RUnlock()
+	return or.control.paused
+}
+
+func (or *OrderbookRunner) SetTargetProfit(targetProfit decimal.Decimal) {
+	or.control.mu.Lock()
+	defer or.control.mu.Unlock()
+	or.TargetProfit = targetProfit
+}
+
+func (or *OrderbookRunner) GetTargetProfit() decimal.Decimal {
+	or.control.mu.RLock()
+	defer or.control.mu.RUnlock()
+	return or.TargetProfit
+}
+
+// EnableCombination and DisableCombination return an error if the combination doesn't exist
+func (or *OrderbookRunner) EnableCombination(name string) error {
+	return or.setCombinationDisabled(name, false)
+}
+
+func (or *OrderbookRunner) DisableCombination(name string) error {
+	return or.setCombinationDisabled(name, true)
+}
+
+func (or *OrderbookRunner) setCombinationDisabled(name string, disabled bool) error {
+	if !or.combinationExists(name) {
+		return fmt.Errorf("combination '%s' doesn't exist", name)
+	}
+	or.control.mu.Lock()
+	if or.control.disabled == nil {
+		or.control.disabled = make(map[string]bool)
+	}
+	if disabled {
+		or.control.disabled[name] = true
+	} else {
+		delete(or.control.disabled, name)
+	}
+	or.control.mu.Unlock()
+
+	// The opportunity of a disabled combination is over
+	if disabled {
+		or.Episodes.CloseIf(func(c *tri.Combination) bool { return c.Name() == name }, or.Clock.Now())
+		if or.Alerter != nil {
+			or.Alerter.Reset(func(combination string) bool { return combination == name })
+		}
+	}
+	return nil
+}
+
+// CloseEpisodes closes the episodes of combinations which have one of the symbols, e.g. their orderbooks are stale
+func (or *OrderbookRunner) CloseEpisodes(symbols []string) {
+	or.Episodes.CloseIf(func(c *tri.Combination) bool {
+		for _, so := range c.SymbolOrders {
+			for _, symbol := range symbols {
+				if so.Symbol == symbol {
+					return true
+				}
+			}
+		}
+		return false
+	}, or.Clock.Now())
+	if or.Alerter != nil {
+		or.Alerter.Reset(func(combination string) bool {
+			for _, s := range strings.Split(combination, "->") {
+				for _, symbol := range symbols {
+					if s == symbol {
+						return true
+					}
+				}
+			}
+			return false
+		})
+	}
+}
+
+func (or *OrderbookRunner) DisabledCombinations() []string {
+	or.control.mu.RLock()
+	defer or.control.mu.RUnlock()
+	var names []string
+	for name := range or.control.disabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (or *OrderbookRunner) combinationDisabled(name string) bool {
+	or.control.mu.RLock()
+	defer or.control.mu.RUnlock()
+	return or.control.disabled[name]
+}
+
+func (or *OrderbookRunner) combinationExists(name string) bool {
+	for _, combinations := range or.Tri.SymbolCombinationsMap {
+		for _, c := range combinations {
+			if c.Name() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package runner
+
+import (
+	"crypto-triangular-arbitrage-watch/metrics"
+	"crypto-triangular-arbitrage-watch/tri"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const EPISODE_CHANNEL_BUFFER = 100
+
+// Episode is the lifetime of an opportunity of a combination, from the first update above the threshold to the first update below it,
+// or until its orderbooks are stale or it's disabled
+type Episode struct {
+	Combination *tri.Combination
+	FirstSeen   time.Time
+	LastSeen    time.Time
+	ClosedAt    time.Time
+	PeakProfit  decimal.Decimal // 0.001 = 0.1%
+	PeakSize    decimal.Decimal // available size (trade.HOME_COIN) at the peak profit
+	Updates     int64           // orderbook updates during the episode
+	sumProfit   decimal.Decimal
+}
+
+// Duration lasts until ClosedAt once it's closed e.g. seen on one update and closed by stale orderbooks, otherwise until LastSeen
+func (e *Episode) Duration() time.Duration {
+	if !e.ClosedAt.IsZero() {
+		return e.ClosedAt.Sub(e.FirstSeen)
+	}
+	return e.LastSeen.Sub(e.FirstSeen)
+}
+
+func (e *Episode) AvgProfit() decimal.Decimal {
+	if e.Updates == 0 {
+		return decimal.Zero
+	}
+	return e.sumProfit.Div(decimal.NewFromInt(e.Updates))
+}
+
+type EpisodeTracker struct {
+	mu       sync.Mutex
+	episodes map[*tri.Combination]*Episode // open episodes
+	closed   chan *Episode
+}
+
+func initEpisodeTracker() *EpisodeTracker {
+	return &EpisodeTracker{
+		episodes: make(map[*tri.Combination]*Episode),
+		closed:   make(chan *Episode, EPISODE_CHANNEL_BUFFER),
+	}
+}
+
+// Update is called whenever the profit of the combination is calculated
+func (et *EpisodeTracker) Update(combination *tri.Combination, profit decimal.Decimal, size decimal.Decimal, ts time.Time, threshold decimal.Decimal) {
+	if closed := et.update(combination, profit, size, ts, threshold); closed != nil {
+		et.emit(closed)
+	}
+}
+
+// update returns the episode if it's closed
+func (et *EpisodeTracker) update(combination *tri.Combination, profit decimal.Decimal, size decimal.Decimal, ts time.Time, threshold decimal.Decimal) *Episode {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	episode, open := et.episodes[combination]
+	if profit.LessThan(threshold) {
+		if !open {
+			return nil
+		}
+		episode.ClosedAt = ts
+		delete(et.episodes, combination)
+		return episode
+	}
+
+	if !open {
+		episode = &Episode{Combination: combination, FirstSeen: ts}
+		et.episodes[combination] = episode
+	}
+	episode.LastSeen = ts
+	episode.Updates++
+	episode.sumProfit = episode.sumProfit.Add(profit)
+	if episode.Updates == 1 || profit.GreaterThan(episode.PeakProfit) {
+		episode.PeakProfit = profit
+		episode.PeakSize = size
+	}
+	return nil
+}
+
+// CloseIf closes the open episodes of the combinations which match, e.g. their orderbooks are stale
+func (et *EpisodeTracker) CloseIf(match func(combination *tri.Combination) bool, ts time.Time) {
+	et.mu.Lock()
+	var closed []*Episode
+	for combination, episode := range et.episodes {
+		if match(combination) {
+			episode.ClosedAt = ts
+			delete(et.episodes, combination)
+			closed = append(closed, episode)
+		}
+	}
+	et.mu.Unlock()
+	for _, episode := range closed {
+		et.emit(episode)
+	}
+}
+
+// emit doesn't block the calculation, the episode is dropped if the journal can't keep up
+func (et *EpisodeTracker) emit(episode *Episode) {
+	select {
+	case et.closed <- episode:
+	default:
+		metrics.DroppedEpisodes.Inc("")
+		log.Printf("episode of %s is dropped, the queue is full", episode.Combination.Name())
+	}
+}
+
+// Open returns a copy of the open episode of the combination
+func (et *EpisodeTracker) Open(combination *tri.Combination) (Episode, bool) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	episode, ok := et.episodes[combination]
+	if !ok {
+		return Episode{}, false
+	}
+	return *episode, true
+}
+
+// Closed emits episodes once they are closed
+func (et *EpisodeTracker) Closed() <-chan *Episode {
+	return et.closed
+}
@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"crypto-triangular-arbitrage-watch/tri"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestEpisodeDurationOfSingleUpdate(t *testing.T) {
+	et := initEpisodeTracker()
+	c := &tri.Combination{}
+	threshold := decimal.NewFromFloat(0.001)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	et.Update(c, decimal.NewFromFloat(0.002), decimal.NewFromInt(100), start, threshold)
+	open, ok := et.Open(c)
+	if !ok || open.Duration() != 0 {
+		t.Fatalf("open episode = %v, %v, want a 0s open episode", open.Duration(), ok)
+	}
+
+	// Its orderbooks go stale without another update
+	et.CloseIf(func(*tri.Combination) bool { return true }, start.Add(1500*time.Millisecond))
+	episode := <-et.Closed()
+	if episode.Updates != 1 {
+		t.Errorf("updates = %d, want 1", episode.Updates)
+	}
+	if episode.Duration() != 1500*time.Millisecond {
+		t.Errorf("duration = %v, want 1.5s", episode.Duration())
+	}
+}
+
+func TestEpisodeDurationUntilBelowThreshold(t *testing.T) {
+	et := initEpisodeTracker()
+	c := &tri.Combination{}
+	threshold := decimal.NewFromFloat(0.001)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	et.Update(c, decimal.NewFromFloat(0.002), decimal.NewFromInt(100), start, threshold)
+	et.Update(c, decimal.NewFromFloat(0.003), decimal.NewFromInt(50), start.Add(time.Second), threshold)
+	et.Update(c, decimal.NewFromFloat(0.0005), decimal.NewFromInt(50), start.Add(3*time.Second), threshold)
+	episode := <-et.Closed()
+	if episode.Duration() != 3*time.Second {
+		t.Errorf("duration = %v, want 3s", episode.Duration())
+	}
+	if !episode.PeakProfit.Equal(decimal.NewFromFloat(0.003)) || !episode.PeakSize.Equal(decimal.NewFromInt(50)) {
+		t.Errorf("peak = %s at %s, want 0.003 at 50", episode.PeakProfit, episode.PeakSize)
+	}
+	if !episode.AvgProfit().Equal(decimal.NewFromFloat(0.0025)) {
+		t.Errorf("avg = %s, want 0.0025", episode.AvgProfit())
+	}
+}
@@ -0,0 +1,160 @@
+package runner
+
+import (
+	"crypto-triangular-arbitrage-watch/trade"
+	"crypto-triangular-arbitrage-watch/tri"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	RECENT_OPPORTUNITIES          = 100
+	OPPORTUNITY_SUBSCRIBER_BUFFER = 100
+)
+
+// CombinationProfit is the latest evaluated profit of a combination
+type CombinationProfit struct {
+	Combination   string          `json:"combination"`
+	Profit        decimal.Decimal `json:"profit"`         // 0.001 = 0.1%
+	AvailableSize decimal.Decimal `json:"available_size"` // trade.HOME_COIN
+	UpdatedAt     time.Time       `json:"updated_at"`
+	Ready         bool            `json:"ready"` // false if an orderbook is missing or stale
+}
+
+// Leg is a trade of the combination at the top of the orderbook
+type Leg struct {
+	Symbol   string          `json:"symbol"`
+	Side     string          `json:"side"`
+	Price    decimal.Decimal `json:"price"`
+	Size     decimal.Decimal `json:"size"`
+	Notional decimal.Decimal `json:"notional"` // trade.HOME_COIN
+}
+
+// Opportunity is a structured MostProfit which is over the target profit
+type Opportunity struct {
+	Ts            time.Time       `json:"ts"`
+	Symbol        string          `json:"symbol"` // which symbol trigger the calculation
+	Combination   string          `json:"combination"`
+	Legs          []Leg           `json:"legs"`
+	Capital       decimal.Decimal `json:"capital"`
+	End           decimal.Decimal `json:"end"`
+	Profit        decimal.Decimal `json:"profit"`         // 0.001 = 0.1%
+	AvailableSize decimal.Decimal `json:"available_size"` // trade.HOME_COIN
+}
+
+// Legs are built from the prices when it's calculated
+func newOpportunity(p *MostProfit) *Opportunity {
+	c := p.Prices
+	notionals := legNotionals(c)
+	secondLeg := Leg{Symbol: c.SymbolOrders[1].Symbol, Side: trade.SIDE_BUY, Price: c.SymbolOrders[1].Ask.Price, Size: c.SymbolOrders[1].Ask.Size, Notional: notionals[1]}
+	if c.BaseQuote {
+		secondLeg = Leg{Symbol: c.SymbolOrders[1].Symbol, Side: trade.SIDE_SELL, Price: c.SymbolOrders[1].Bid.Price, Size: c.SymbolOrders[1].Bid.Size, Notional: notionals[1]}
+	}
+	return &Opportunity{
+		Ts:          p.Ts,
+		Symbol:      p.Symbol,
+		Combination: p.Combination.Name(),
+		Legs: []Leg{
+			{Symbol: c.SymbolOrders[0].Symbol, Side: trade.SIDE_BUY, Price: c.SymbolOrders[0].Ask.Price, Size: c.SymbolOrders[0].Ask.Size, Notional: notionals[0]},
+			secondLeg,
+			{Symbol: c.SymbolOrders[2].Symbol, Side: trade.SIDE_SELL, Price: c.SymbolOrders[2].Bid.Price, Size: c.SymbolOrders[2].Bid.Size, Notional: notionals[2]},
+		},
+		Capital:       decimal.NewFromInt(CAPITAL),
+		End:           p.RemainingBalance,
+		Profit:        p.Profit(),
+		AvailableSize: AvailableSize(c),
+	}
+}
+
+// state keeps what the status API needs, it's written by the listeners of all symbols
+type state struct {
+	mu      sync.RWMutex
+	profits map[*tri.Combination]*CombinationProfit
+	recent  []*Opportunity // ring buffer
+	next    int
+
+	subscribers map[chan *Opportunity]struct{}
+}
+
+func (s *state) updateProfit(c *tri.Combination, profit decimal.Decimal, size decimal.Decimal, ts time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.profits == nil {
+		s.profits = make(map[*tri.Combination]*CombinationProfit)
+	}
+	s.profits[c] = &CombinationProfit{Combination: c.Name(), Profit: profit, AvailableSize: size, UpdatedAt: ts}
+}
+
+// addOpportunity keeps the opportunity for the status API and publishes it to the subscribers
+func (s *state) addOpportunity(o *Opportunity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- o:
+		default:
+		}
+	}
+	if len(s.recent) < RECENT_OPPORTUNITIES {
+		s.recent = append(s.recent, o)
+		return
+	}
+	s.recent[s.next] = o
+	s.next = (s.next + 1) % RECENT_OPPORTUNITIES
+}
+
+// Profits returns the latest profit of every evaluated combination, sorted by name
+func (or *OrderbookRunner) Profits() []CombinationProfit {
+	or.state.mu.RLock()
+	defer or.state.mu.RUnlock()
+	profits := make([]CombinationProfit, 0, len(or.state.profits))
+	for c, p := range or.state.profits {
+		profit := *p
+		profit.Ready = or.Tri.Ready(c)
+		profits = append(profits, profit)
+	}
+	sort.Slice(profits, func(i, j int) bool { return profits[i].Combination < profits[j].Combination })
+	return profits
+}
+
+// RecentOpportunities returns the latest opportunities, the newest first
+func (or *OrderbookRunner) RecentOpportunities(limit int) []*Opportunity {
+	or.state.mu.RLock()
+	defer or.state.mu.RUnlock()
+	n := len(or.state.recent)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	opportunities := make([]*Opportunity, 0, limit)
+	for i := 0; i < limit; i++ {
+		// The newest one is before `next` once the buffer is full
+		idx := (or.state.next - 1 - i + 2*n) % n
+		if n < RECENT_OPPORTUNITIES {
+			idx = n - 1 - i
+		}
+		opportunities = append(opportunities, or.state.recent[idx])
+	}
+	return opportunities
+}
+
+// Subscribe returns a channel of new opportunities, they are dropped if the subscriber can't keep up. Call the cancel func to unsubscribe
+func (or *OrderbookRunner) Subscribe() (<-chan *Opportunity, func()) {
+	ch := make(chan *Opportunity, OPPORTUNITY_SUBSCRIBER_BUFFER)
+	or.state.mu.Lock()
+	defer or.state.mu.Unlock()
+	if or.state.subscribers == nil {
+		or.state.subscribers = make(map[chan *Opportunity]struct{})
+	}
+	or.state.subscribers[ch] = struct{}{}
+	return ch, func() {
+		or.state.mu.Lock()
+		defer or.state.mu.Unlock()
+		if _, ok := or.state.subscribers[ch]; ok {
+			delete(or.state.subscribers, ch)
+			close(ch)
+		}
+	}
+}
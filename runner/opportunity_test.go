@@ -0,0 +1,53 @@
+package runner
+
+import (
+	"crypto-triangular-arbitrage-watch/trade"
+	"crypto-triangular-arbitrage-watch/tri"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Profits is called by the status API while the listeners update the prices, run it with -race
+func TestProfitsWhilePricesAreUpdated(t *testing.T) {
+	tr := tri.Init()
+	symbols := []string{"BTCUSDT", "ETHBTC", "ETHUSDT"}
+	c := &tri.Combination{BaseQuote: true}
+	for _, symbol := range symbols {
+		so := &tri.SymbolOrder{Symbol: symbol}
+		tr.SymbolOrdersMap[symbol] = so
+		c.SymbolOrders = append(c.SymbolOrders, so)
+	}
+	or := &OrderbookRunner{Tri: tr}
+	or.state.updateProfit(c, decimal.NewFromFloat(0.001), decimal.NewFromInt(1), time.Now())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			for _, symbol := range symbols {
+				tr.UpdatePrice(trade.BID, symbol, tri.Price{"1", "1"}, int64(i))
+				tr.UpdatePrice(trade.ASK, symbol, tri.Price{"1.1", "1"}, int64(i))
+			}
+			tr.SetStale(symbols[:1])
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		or.Profits()
+	}
+	wg.Wait()
+
+	tr.UpdatePrice(trade.BID, symbols[0], tri.Price{"1", "1"}, 100)
+	tr.UpdatePrice(trade.ASK, symbols[0], tri.Price{"1.1", "1"}, 100)
+	profits := or.Profits()
+	if len(profits) != 1 || !profits[0].Ready {
+		t.Fatalf("profits = %+v, want 1 ready combination", profits)
+	}
+	tr.SetStale(symbols[:1])
+	if or.Profits()[0].Ready {
+		t.Fatal("the combination shouldn't be ready once an orderbook is stale")
+	}
+}
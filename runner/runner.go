@@ -1,6 +1,9 @@
 package runner
 
 import (
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/journal"
+	"crypto-triangular-arbitrage-watch/metrics"
 	"crypto-triangular-arbitrage-watch/notification"
 	"crypto-triangular-arbitrage-watch/trade"
 	"crypto-triangular-arbitrage-watch/tri"
@@ -20,12 +23,12 @@ const (
 	// Slack
 	SLACK_CHANNEL_WATCH_TRI_INTERVAL_SECOND                   = 3
 	SLACK_CHANNEL_SYSTEM_LOGS_BALANCE_COUNTER_INTERVAL_SECOND = 30
+	SLACK_CHANNEL_SYSTEM_LOGS_LATENCY_INTERVAL_SECOND         = 300
 
 	// TODO DEBUG
 	CAPITAL = 1000
 
-	// Only place the order when it is over the target profit threshold
-	// TODO Put it into the config?
+	// Only place the order when it is over the target profit threshold, it can be overridden by TARGET_PROFIT_FOR_TRADE in the config
 	TARGET_PROFIT_FOR_TRADE = 0.001
 )
 
@@ -37,18 +40,36 @@ type OrderbookData struct {
 	Asks     []tri.Price `json:"a"`
 	UpdateId int64       `json:"u"`   // Update ID. It's a sequence. Occasionally, you'll receive "u"=1, which is a snapshot data due to the restart of the service. So please overwrite your local orderbook
 	Seq      int64       `json:"seq"` // You can use this field to compare different levels orderbook data, and for the smaller seq, then it means the data is generated earlier.
+
+	Timestamps metrics.Timestamps `json:"-"`
 }
 
 type OrderbookRunner struct {
 	Tri                  *tri.Tri
 	Fee                  decimal.Decimal // 0.01 = 1%
 	NetPercent           decimal.Decimal // to get amount without fee  e.g. 1 - 0.1% fee = 0.999
+	TargetProfit         decimal.Decimal // 0.001 = 0.1%
+	Clock                clock.Clock
+	Formatter            *clock.Formatter
 	OrderbookListeners   map[string]*OrderbookListener
-	Slack                *notification.Slack
+	Notifier             notification.Notifier
+	Alerter              Alerter
+	Journal              *journal.Journal
+	Episodes             *EpisodeTracker
 	ChannelWatch         chan *MostProfit
 	ChannelSystemLogs    chan *MostProfit
 	DebugPrintMostProfit bool
 	CalculateTriArb      bool
+	state                state
+	control              control
+}
+
+// Alerter decides which opportunities are sent and where, e.g. alert.Engine
+type Alerter interface {
+	// Update is called on every calculation of a combination, alert builds the legs only when it's sent
+	Update(combination string, profit decimal.Decimal, size decimal.Decimal, ts time.Time, alert func() *notification.OpportunityAlert)
+	// Reset ends the matches of the combinations e.g. they are disabled or their orderbooks are stale
+	Reset(match func(combination string) bool)
 }
 
 type OrderbookListener struct {
@@ -64,28 +85,61 @@ type MostProfit struct {
 	RemainingBalance decimal.Decimal
 	// Store the most profitable combination
 	Combination *tri.Combination
+	// Copy of the combination when it's calculated, legs are built from it instead of the latest prices
+	Prices *tri.Combination
 	// Time
 	Ts time.Time
 }
 
 func Init(tri *tri.Tri) *OrderbookRunner {
 	fee := decimal.NewFromFloat(0.001)
+	targetProfit := decimal.NewFromFloat(TARGET_PROFIT_FOR_TRADE)
+	if viper.IsSet("TARGET_PROFIT_FOR_TRADE") {
+		targetProfit = decimal.NewFromFloat(viper.GetFloat64("TARGET_PROFIT_FOR_TRADE"))
+	}
 	orderbookRunner := &OrderbookRunner{
 		Fee:                  fee,
 		NetPercent:           decimal.NewFromInt(1).Sub(fee),
+		TargetProfit:         targetProfit,
+		Clock:                clock.Real{},
+		Formatter:            clock.DefaultFormatter(),
 		Tri:                  tri,
 		OrderbookListeners:   make(map[string]*OrderbookListener),
+		Episodes:             initEpisodeTracker(),
 		ChannelWatch:         make(chan *MostProfit),
 		ChannelSystemLogs:    make(chan *MostProfit),
 		DebugPrintMostProfit: viper.GetBool("DEBUG_PRINT_MOST_PROFIT"),
 		CalculateTriArb:      true,
 	}
 	orderbookRunner.initOrderbookListeners()
+	metrics.QueueDepth.SetFunc("episodes", func() float64 { return float64(len(orderbookRunner.Episodes.closed)) })
 	return orderbookRunner
 }
 
-func (or *OrderbookRunner) SetSlack(slack *notification.Slack) {
-	or.Slack = slack
+func (or *OrderbookRunner) SetNotifier(notifier notification.Notifier) {
+	or.Notifier = notifier
+}
+
+// SetAlerter replaces sending all opportunities to the watch channel
+func (or *OrderbookRunner) SetAlerter(alerter Alerter) {
+	or.Alerter = alerter
+}
+
+func (or *OrderbookRunner) SetJournal(j *journal.Journal) {
+	or.Journal = j
+}
+
+func (or *OrderbookRunner) SetClock(c clock.Clock) {
+	or.Clock = c
+}
+
+func (or *OrderbookRunner) SetFormatter(f *clock.Formatter) {
+	or.Formatter = f
+}
+
+func (or *OrderbookRunner) SetFee(fee decimal.Decimal) {
+	or.Fee = fee
+	or.NetPercent = decimal.NewFromInt(1).Sub(fee)
 }
 
 func (or *OrderbookRunner) initOrderbookListeners() {
@@ -104,6 +158,7 @@ func (or *OrderbookRunner) ListenAll() {
 	// Send messages to slack
 	go or.handleWatchMsgs()
 	go or.handleSystemLogsMsgs()
+	go or.handleEpisodeMsgs()
 }
 
 func (or *OrderbookRunner) listenOrderbook(symbol string) {
@@ -111,19 +166,26 @@ func (or *OrderbookRunner) listenOrderbook(symbol string) {
 	for {
 		select {
 		case orderbookData := <-listener.OrderbookDataCh:
-			if listener.ignoreIncomingOrder {
-				continue
-			}
+			orderbookData.Timestamps.Dequeue = time.Now()
+			or.HandleOrderbookData(symbol, orderbookData)
+		}
+	}
+}
 
-			// Skip if it's less than interval
-			if time.Since(listener.lastTimeOfTriArbFound) <= time.Duration(TRI_ARB_FOUND_INTERVAL_MILLISECOND)*time.Millisecond {
-				continue
-			}
+// HandleOrderbookData is called by the listener of the symbol, backtest calls it directly to replay orderbooks
+func (or *OrderbookRunner) HandleOrderbookData(symbol string, orderbookData *OrderbookData) {
+	listener := or.OrderbookListeners[symbol]
+	if listener.ignoreIncomingOrder {
+		return
+	}
 
-			listener.ignoreIncomingOrder = true
-			or.UpdateBidAskPrice(symbol, listener, orderbookData)
-		}
+	// Skip if it's less than interval
+	if or.Clock.Now().Sub(listener.lastTimeOfTriArbFound) <= time.Duration(TRI_ARB_FOUND_INTERVAL_MILLISECOND)*time.Millisecond {
+		return
 	}
+
+	listener.ignoreIncomingOrder = true
+	or.UpdateBidAskPrice(symbol, listener, orderbookData)
 }
 
 func (or *OrderbookRunner) UpdateBidAskPrice(symbol string, listener *OrderbookListener, orderbookData *OrderbookData) {
@@ -136,13 +198,16 @@ func (or *OrderbookRunner) UpdateBidAskPrice(symbol string, listener *OrderbookL
 		or.Tri.UpdatePrice(trade.ASK, orderbookData.Symbol, orderbookData.Asks[0], orderbookData.Seq)
 	}
 
-	if or.CalculateTriArb {
+	if or.CalculateTriArb && !or.Paused() {
 		or.calculateTriangularArbitrage(symbol, listener)
+		orderbookData.Timestamps.Calculated = time.Now()
+		metrics.ObserveOrderbook(orderbookData.Timestamps)
 	}
 }
 
 func (or *OrderbookRunner) calculateTriangularArbitrage(symbol string, listener *OrderbookListener) {
 	mostProfit := MostProfit{Symbol: symbol}
+	targetProfit := or.GetTargetProfit()
 
 	combinations := or.Tri.SymbolCombinationsMap[symbol]
 	if len(combinations) == 0 {
@@ -150,37 +215,76 @@ func (or *OrderbookRunner) calculateTriangularArbitrage(symbol string, listener
 	}
 	for _, combination := range combinations {
 		if len(combination.SymbolOrders) < 3 {
-			return
+			continue
+		}
+		// Make sure all symbols get latest price, other symbols are updated by their listeners during the calculation
+		prices, ready := or.Tri.Snapshot(combination)
+		if !ready {
+			continue
 		}
-		// Make sure all symbols get latest price
-		if !combination.Ready() {
-			return
+		if or.combinationDisabled(combination.Name()) {
+			continue
 		}
 
 		// Calculate the profit
 		var balance, secondTrade decimal.Decimal
 		capital := decimal.NewFromInt(CAPITAL)
-		firstTrade := capital.Div(combination.SymbolOrders[0].Ask.Price).Mul(or.NetPercent)
-		if combination.BaseQuote {
-			secondTrade = firstTrade.Mul(combination.SymbolOrders[1].Bid.Price).Mul(or.NetPercent)
+		firstTrade := capital.Div(prices.SymbolOrders[0].Ask.Price).Mul(or.NetPercent)
+		if prices.BaseQuote {
+			secondTrade = firstTrade.Mul(prices.SymbolOrders[1].Bid.Price).Mul(or.NetPercent)
 		} else {
-			secondTrade = firstTrade.Div(combination.SymbolOrders[1].Ask.Price).Mul(or.NetPercent)
+			secondTrade = firstTrade.Div(prices.SymbolOrders[1].Ask.Price).Mul(or.NetPercent)
 		}
-		thirdTrade := secondTrade.Mul(combination.SymbolOrders[2].Bid.Price).Mul(or.NetPercent)
+		thirdTrade := secondTrade.Mul(prices.SymbolOrders[2].Bid.Price).Mul(or.NetPercent)
 		balance = thirdTrade.Truncate(4)
+		now := or.Clock.Now()
+		profit := balance.Sub(capital).Div(capital)
+		size := AvailableSize(prices)
+		metrics.Calculations.Inc("")
+		metrics.Profit.Set(combination.Name(), profit.InexactFloat64())
+		metrics.BestProfit.Observe(combination.Name(), profit.InexactFloat64())
+		or.state.updateProfit(combination, profit, size, now)
+
+		// Track how long the opportunity of this combination lasts
+		or.Episodes.Update(combination, profit, size, now, targetProfit)
+
+		// Alert rules have their own thresholds, so they see every update
+		if or.Alerter != nil {
+			or.Alerter.Update(combination.Name(), profit, size, now, func() *notification.OpportunityAlert {
+				return or.opportunityAlert(&MostProfit{Symbol: symbol, RemainingBalance: balance, Combination: combination, Prices: prices, Ts: now})
+			})
+		}
 
 		// Store most profitable combination
 		if balance.GreaterThan(mostProfit.RemainingBalance) {
 			mostProfit.RemainingBalance = balance
 			mostProfit.Combination = combination
-			mostProfit.Ts = time.Now()
+			mostProfit.Prices = prices
+			mostProfit.Ts = now
 		}
 	}
 
-	if mostProfit.exceedsProfitThreshold() && mostProfit.eachTradeExceedsTotalThreshold() {
-		listener.lastTimeOfTriArbFound = time.Now()
+	if mostProfit.Combination != nil && mostProfit.exceedsProfitThreshold(targetProfit) && mostProfit.eachTradeExceedsTotalThreshold() {
+		listener.lastTimeOfTriArbFound = or.Clock.Now()
+		metrics.Opportunities.Inc(mostProfit.Combination.Name())
+		or.state.addOpportunity(newOpportunity(&mostProfit))
+		if or.Journal != nil {
+			or.Journal.Record(journal.Record{
+				Type:        journal.TYPE_OPPORTUNITY,
+				Ts:          mostProfit.Ts,
+				Combination: mostProfit.Combination.Name(),
+				Symbol:      mostProfit.Symbol,
+				Start:       decimal.NewFromInt(CAPITAL),
+				End:         mostProfit.RemainingBalance,
+				Pnl:         mostProfit.RemainingBalance.Sub(decimal.NewFromInt(CAPITAL)),
+			})
+		}
 		or.ChannelWatch <- &mostProfit
 	}
+	// Nothing is calculated if none of the combinations is ready
+	if mostProfit.Combination == nil {
+		return
+	}
 	or.ChannelSystemLogs <- &mostProfit
 
 	if or.DebugPrintMostProfit {
@@ -188,44 +292,83 @@ func (or *OrderbookRunner) calculateTriangularArbitrage(symbol string, listener
 	}
 }
 
-// Send to slack every second in case hit the ceiling of rate limits
+// Send to slack every few seconds in case hit the ceiling of rate limits, the first opportunity of each combination is kept
 func (or *OrderbookRunner) handleWatchMsgs() {
 	ticker := time.NewTicker(time.Duration(SLACK_CHANNEL_WATCH_TRI_INTERVAL_SECOND) * time.Second)
 	defer ticker.Stop()
 
 	var combinedMsg string
-	mostProfitMap := make(map[*tri.Combination]*MostProfit)
+	alertMap := make(map[*tri.Combination]*notification.OpportunityAlert)
+	var alerts []*notification.OpportunityAlert
 	for {
 		select {
 		case mostProfit := <-or.ChannelWatch:
-			if _, ok := mostProfitMap[mostProfit.Combination]; !ok {
-				mostProfitMap[mostProfit.Combination] = mostProfit
+			// Alert rules send opportunities instead
+			if or.Alerter != nil {
+				continue
+			}
+			if _, ok := alertMap[mostProfit.Combination]; !ok {
+				alert := or.opportunityAlert(mostProfit)
+				alertMap[mostProfit.Combination] = alert
+				alerts = append(alerts, alert)
+				combinedMsg += fmt.Sprintf("%s %s\n", or.Formatter.Format(mostProfit.Ts), mostProfit.tradeMsg())
 			}
 		case <-ticker.C:
-			if len(mostProfitMap) == 0 {
+			if len(alerts) == 0 {
 				continue
 			}
 
-			for _, mostProfit := range mostProfitMap {
-				combinedMsg += fmt.Sprintf("%s %s\n", mostProfit.Ts.UTC().Add(8*time.Hour).Format("15:04:05"), mostProfit.tradeMsg())
-			}
-			go or.Slack.SendToChannel(or.Slack.ChannelMap[notification.SLACK_CHANNEL_WATCH].Name, combinedMsg)
+			or.Notifier.Publish(&notification.Message{
+				Channel:       notification.CHANNEL_WATCH,
+				Severity:      notification.SEVERITY_INFO,
+				Text:          combinedMsg,
+				Opportunities: alerts,
+			})
 
 			// Reset the combined message
 			combinedMsg = ""
-			mostProfitMap = make(map[*tri.Combination]*MostProfit)
+			alertMap = make(map[*tri.Combination]*notification.OpportunityAlert)
+			alerts = nil
 		}
 	}
 }
 
+func (or *OrderbookRunner) opportunityAlert(mostProfit *MostProfit) *notification.OpportunityAlert {
+	o := newOpportunity(mostProfit)
+	alert := &notification.OpportunityAlert{
+		Combination:   o.Combination,
+		Symbol:        o.Symbol,
+		Capital:       o.Capital,
+		End:           o.End,
+		Profit:        o.Profit,
+		AvailableSize: o.AvailableSize,
+		Ts:            o.Ts,
+	}
+	for _, leg := range o.Legs {
+		alert.Legs = append(alert.Legs, notification.AlertLeg{Symbol: leg.Symbol, Side: leg.Side, Price: leg.Price, Size: leg.Size, Notional: leg.Notional})
+	}
+	if episode, ok := or.Episodes.Open(mostProfit.Combination); ok {
+		alert.EpisodeStart = episode.FirstSeen
+	}
+	return alert
+}
+
 func (or *OrderbookRunner) handleSystemLogsMsgs() {
 	ticker := time.NewTicker(time.Duration(SLACK_CHANNEL_SYSTEM_LOGS_BALANCE_COUNTER_INTERVAL_SECOND) * time.Second)
 	defer ticker.Stop()
 
+	latencyTicker := time.NewTicker(time.Duration(SLACK_CHANNEL_SYSTEM_LOGS_LATENCY_INTERVAL_SECOND) * time.Second)
+	defer latencyTicker.Stop()
+	latencySummary := metrics.InitLatencySummary()
+
 	// To show counters for result e.g. `map[997:1762 998:466]` means result 997 gets 1762 times, 998 gets 466 times
 	counters := make(map[string]int64)
 	for {
 		select {
+		case <-latencyTicker.C:
+			if summary := latencySummary.Summarize(); summary != "" {
+				or.Notifier.SystemLogs(summary)
+			}
 		case mostProfit := <-or.ChannelSystemLogs:
 			balance := strconv.FormatInt(mostProfit.RemainingBalance.IntPart(), 10)
 			counters[balance]++
@@ -233,7 +376,7 @@ func (or *OrderbookRunner) handleSystemLogsMsgs() {
 			if len(counters) == 0 {
 				continue
 			}
-			or.Slack.SystemLogs(fmt.Sprintf("%s %+v", time.Now().UTC().Add(8*time.Hour).Format("15:04:05"), counters))
+			or.Notifier.SystemLogs(fmt.Sprintf("%s %+v", or.Formatter.FormatNow(), counters))
 
 			// Reset the counters
 			counters = make(map[string]int64)
@@ -241,62 +384,92 @@ func (or *OrderbookRunner) handleSystemLogsMsgs() {
 	}
 }
 
-func (p *MostProfit) exceedsProfitThreshold() bool {
+// Closed episodes are recorded into the journal
+func (or *OrderbookRunner) handleEpisodeMsgs() {
+	for episode := range or.Episodes.Closed() {
+		if or.DebugPrintMostProfit {
+			log.Printf("episode closed: %s duration: %v peak: %s avg: %s size: %s updates: %d\n",
+				episode.Combination.Name(), episode.Duration(), episode.PeakProfit.StringFixed(5), episode.AvgProfit().StringFixed(5), episode.PeakSize.StringFixed(0), episode.Updates)
+		}
+		if or.Journal != nil {
+			or.Journal.Record(journal.Record{
+				Type:        journal.TYPE_EPISODE,
+				Ts:          episode.FirstSeen,
+				Combination: episode.Combination.Name(),
+				DurationMs:  episode.Duration().Milliseconds(),
+				Updates:     episode.Updates,
+				PeakProfit:  episode.PeakProfit,
+				AvgProfit:   episode.AvgProfit(),
+				Size:        episode.PeakSize,
+			})
+		}
+	}
+}
+
+func (p *MostProfit) exceedsProfitThreshold(targetProfit decimal.Decimal) bool {
+	return p.Profit().GreaterThanOrEqual(targetProfit)
+}
+
+// Profit is the profit percent of the most profitable combination, 0.001 = 0.1%
+func (p *MostProfit) Profit() decimal.Decimal {
 	capital := decimal.NewFromInt(CAPITAL)
-	profitPercent := p.RemainingBalance.Sub(capital).Div(capital)
-	return profitPercent.GreaterThanOrEqual(decimal.NewFromFloat(TARGET_PROFIT_FOR_TRADE))
+	return p.RemainingBalance.Sub(capital).Div(capital)
 }
 
 func (p *MostProfit) eachTradeExceedsTotalThreshold() bool {
 	// TODO 300 dollars
 	threshold := decimal.NewFromInt(300)
+	return !AvailableSize(p.Prices).LessThan(threshold)
+}
 
-	firstTrade := p.Combination.SymbolOrders[0].Ask.Price.Mul(p.Combination.SymbolOrders[0].Ask.Size)
-	if firstTrade.LessThan(threshold) {
-		return false
-	}
+// AvailableSize is the smallest total (trade.HOME_COIN) of the 3 trades on the top of the orderbooks
+func AvailableSize(c *tri.Combination) decimal.Decimal {
+	notionals := legNotionals(c)
+	return decimal.Min(notionals[0], notionals[1], notionals[2])
+}
+
+// legNotionals are totals (trade.HOME_COIN) of the 3 trades on the top of the orderbooks
+func legNotionals(c *tri.Combination) [3]decimal.Decimal {
+	firstTrade := c.SymbolOrders[0].Ask.Price.Mul(c.SymbolOrders[0].Ask.Size)
 
 	var secondTrade decimal.Decimal
 	// var SecondTradeSize decimal.Decimal
-	if p.Combination.BaseQuote {
-		// SecondTradeSize = p.Combination.SymbolOrders[1].Bid.Size
+	if c.BaseQuote {
+		// SecondTradeSize = c.SymbolOrders[1].Bid.Size
 		// ETH -> BTC (SELL) -> bid size -> find the lowest price to buy eth
-		secondTrade = p.Combination.SymbolOrders[1].Bid.Size.Mul(p.Combination.SymbolOrders[0].Ask.Price)
+		secondTrade = c.SymbolOrders[1].Bid.Size.Mul(c.SymbolOrders[0].Ask.Price)
 	} else {
-		// SecondTradeSize = p.Combination.SymbolOrders[1].Ask.Size
+		// SecondTradeSize = c.SymbolOrders[1].Ask.Size
 		// BTC -> ETH (BUY) -> ask size -> find  the lowest price to buy btc
-		secondTrade = p.Combination.SymbolOrders[1].Ask.Size.Mul(p.Combination.SymbolOrders[2].Ask.Price)
-	}
-	if secondTrade.LessThan(threshold) {
-		return false
+		secondTrade = c.SymbolOrders[1].Ask.Size.Mul(c.SymbolOrders[2].Ask.Price)
 	}
 
-	thirdTrade := p.Combination.SymbolOrders[2].Bid.Price.Mul(p.Combination.SymbolOrders[2].Bid.Size)
-	return !thirdTrade.LessThan(threshold)
+	thirdTrade := c.SymbolOrders[2].Bid.Price.Mul(c.SymbolOrders[2].Bid.Size)
+	return [3]decimal.Decimal{firstTrade, secondTrade, thirdTrade}
 }
 
 func (p *MostProfit) tradeMsg() string {
 	var SecondTradeTotal decimal.Decimal
 	// var SecondTradeSize decimal.Decimal
-	if p.Combination.BaseQuote {
-		// SecondTradeSize = p.Combination.SymbolOrders[1].Bid.Size
+	if p.Prices.BaseQuote {
+		// SecondTradeSize = p.Prices.SymbolOrders[1].Bid.Size
 		// ETH -> BTC (SELL) -> bid size -> find the lowest price to buy eth
-		SecondTradeTotal = p.Combination.SymbolOrders[1].Bid.Size.Mul(p.Combination.SymbolOrders[0].Ask.Price)
+		SecondTradeTotal = p.Prices.SymbolOrders[1].Bid.Size.Mul(p.Prices.SymbolOrders[0].Ask.Price)
 	} else {
-		// SecondTradeSize = p.Combination.SymbolOrders[1].Ask.Size
+		// SecondTradeSize = p.Prices.SymbolOrders[1].Ask.Size
 		// BTC -> ETH (BUY) -> ask size -> find  the lowest price to buy btc
-		SecondTradeTotal = p.Combination.SymbolOrders[1].Ask.Size.Mul(p.Combination.SymbolOrders[2].Ask.Price)
+		SecondTradeTotal = p.Prices.SymbolOrders[1].Ask.Size.Mul(p.Prices.SymbolOrders[2].Ask.Price)
 	}
 	return fmt.Sprintf(
 		"%s->%s  [%s]  %s ($%s) -> %s ($%s) -> %s ($%s)",
 		decimal.NewFromInt(CAPITAL).String(),
 		p.RemainingBalance.StringFixed(1),
 		p.Symbol,
-		p.Combination.SymbolOrders[0].Symbol,
-		p.Combination.SymbolOrders[0].Ask.Price.Mul(p.Combination.SymbolOrders[0].Ask.Size).StringFixed(0),
-		p.Combination.SymbolOrders[1].Symbol,
+		p.Prices.SymbolOrders[0].Symbol,
+		p.Prices.SymbolOrders[0].Ask.Price.Mul(p.Prices.SymbolOrders[0].Ask.Size).StringFixed(0),
+		p.Prices.SymbolOrders[1].Symbol,
 		SecondTradeTotal.StringFixed(0),
-		p.Combination.SymbolOrders[2].Symbol,
-		p.Combination.SymbolOrders[2].Bid.Price.Mul(p.Combination.SymbolOrders[2].Bid.Size).StringFixed(0),
+		p.Prices.SymbolOrders[2].Symbol,
+		p.Prices.SymbolOrders[2].Bid.Price.Mul(p.Prices.SymbolOrders[2].Bid.Size).StringFixed(0),
 	)
 }
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireToken rejects requests without `Authorization: Bearer <HTTP_CONTROL_TOKEN>`.
+// State-changing endpoints use it, a cross-origin form of any web page can't set the header.
+func (s *Server) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.ControlToken == "" {
+			writeError(w, http.StatusForbidden, "HTTP_CONTROL_TOKEN isn't set")
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == auth || subtle.ConstantTimeCompare([]byte(token), []byte(s.ControlToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"crypto-triangular-arbitrage-watch/runner"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const DASHBOARD_PUSH_INTERVAL_MILLISECOND = 1000
+
+//go:embed web
+var webFS embed.FS
+
+// DashboardEvent is pushed to the dashboard via SSE
+type DashboardEvent struct {
+	Ts           time.Time                  `json:"ts"`
+	Combinations []DashboardCombination     `json:"combinations"`
+	Triangles    map[string]decimal.Decimal `json:"triangles"` // best profit of the combinations of the same 3 symbols
+}
+
+type DashboardCombination struct {
+	runner.CombinationProfit
+	AgeMs int64 `json:"age_ms"` // freshness, since the last calculation
+}
+
+// GET / serves the embedded web UI
+func (s *Server) dashboardHandler() http.Handler {
+	web, err := fs.Sub(webFS, "web")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(web))
+}
+
+// GET /events streams DashboardEvent as server-sent events
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ticker := time.NewTicker(time.Duration(DASHBOARD_PUSH_INTERVAL_MILLISECOND) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		data, err := json.Marshal(s.dashboardEvent())
+		if err != nil {
+			return
+		}
+		if _, err = fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) dashboardEvent() DashboardEvent {
+	now := time.Now()
+	event := DashboardEvent{Ts: now, Combinations: []DashboardCombination{}, Triangles: make(map[string]decimal.Decimal)}
+	for _, p := range s.OrderbookRunner.Profits() {
+		event.Combinations = append(event.Combinations, DashboardCombination{CombinationProfit: p, AgeMs: now.Sub(p.UpdatedAt).Milliseconds()})
+		name := triangleName(p.Combination)
+		if best, ok := event.Triangles[name]; !ok || p.Profit.GreaterThan(best) {
+			event.Triangles[name] = p.Profit
+		}
+	}
+	return event
+}
+
+// e.g. BTCUSDT->ETHBTC->ETHUSDT and ETHUSDT->ETHBTC->BTCUSDT are the same triangle BTCUSDT/ETHBTC/ETHUSDT
+func triangleName(combination string) string {
+	symbols := strings.Split(combination, "->")
+	sort.Strings(symbols)
+	return strings.Join(symbols, "/")
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto-triangular-arbitrage-watch/runner"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	FEED_PING_INTERVAL_SECOND = 30
+	FEED_WRITE_TIMEOUT_SECOND = 10
+)
+
+var upgrader = websocket.Upgrader{}
+
+// feedFilter is parsed from the query, empty combinations means all
+type feedFilter struct {
+	combinations map[string]bool
+	minProfit    decimal.Decimal
+	hasMinProfit bool
+}
+
+func parseFeedFilter(r *http.Request) (*feedFilter, error) {
+	filter := &feedFilter{combinations: make(map[string]bool)}
+	for _, param := range r.URL.Query()["combination"] {
+		for _, name := range strings.Split(param, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.combinations[name] = true
+			}
+		}
+	}
+	if minProfit := r.URL.Query().Get("min_profit"); minProfit != "" {
+		d, err := decimal.NewFromString(minProfit)
+		if err != nil {
+			return nil, err
+		}
+		filter.minProfit = d
+		filter.hasMinProfit = true
+	}
+	return filter, nil
+}
+
+func (f *feedFilter) match(o *runner.Opportunity) bool {
+	if len(f.combinations) > 0 && !f.combinations[o.Combination] {
+		return false
+	}
+	if f.hasMinProfit && o.Profit.LessThan(f.minProfit) {
+		return false
+	}
+	return true
+}
+
+// GET /feed?combination=BTCUSDT->ETHBTC->ETHUSDT,...&min_profit=0.001 upgrades to a websocket which pushes runner.Opportunity as JSON
+func (s *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFeedFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid min_profit")
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has replied with the error
+		return
+	}
+	defer conn.Close()
+
+	opportunities, cancel := s.OrderbookRunner.Subscribe()
+	defer cancel()
+
+	// Clients don't send anything, reading is only to process control frames and to detect the close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Duration(FEED_PING_INTERVAL_SECOND) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(time.Duration(FEED_WRITE_TIMEOUT_SECOND) * time.Second)
+			if err := conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		case o, ok := <-opportunities:
+			if !ok {
+				return
+			}
+			if !filter.match(o) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(time.Duration(FEED_WRITE_TIMEOUT_SECOND) * time.Second))
+			if err := conn.WriteJSON(o); err != nil {
+				log.Printf("Error writing opportunity to feed %s: %v", r.RemoteAddr, err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"net/http"
+)
+
+// GET /killswitch
+func (s *Server) handleKillSwitch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.KillSwitch.State())
+}
+
+// POST /killswitch/trigger?reason=...
+func (s *Server) handleKillSwitchTrigger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "manual"
+	}
+	s.KillSwitch.Trigger("http: " + reason)
+	writeJSON(w, http.StatusOK, s.KillSwitch.State())
+}
+
+// POST /killswitch/arm
+func (s *Server) handleKillSwitchArm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.KillSwitch.Arm()
+	writeJSON(w, http.StatusOK, s.KillSwitch.State())
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto-triangular-arbitrage-watch/risk"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func killSwitchServer(t *testing.T, token string) *Server {
+	s := Init()
+	s.ControlToken = token
+	ks := &risk.KillSwitch{StatePath: filepath.Join(t.TempDir(), "kill_switch.json")}
+	ks.SetNotifier(&fakeNotifier{})
+	s.SetKillSwitch(ks)
+	s.routes()
+	return s
+}
+
+func TestKillSwitchRequiresToken(t *testing.T) {
+	cases := []struct {
+		name   string
+		token  string // of the config
+		header string
+		want   int
+	}{
+		{"no token is set", "", "Bearer ", http.StatusForbidden},
+		{"missing", "secret", "", http.StatusUnauthorized},
+		{"wrong", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"without bearer", "secret", "secret", http.StatusUnauthorized},
+		{"valid", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := killSwitchServer(t, c.token)
+			for _, path := range []string{"/killswitch/trigger", "/killswitch/arm"} {
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				if c.header != "" {
+					req.Header.Set("Authorization", c.header)
+				}
+				rec := httptest.NewRecorder()
+				s.Mux.ServeHTTP(rec, req)
+				if rec.Code != c.want {
+					t.Errorf("POST %s = %d, want %d", path, rec.Code, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestKillSwitchTriggerWithToken(t *testing.T) {
+	s := killSwitchServer(t, "secret")
+	req := httptest.NewRequest(http.MethodPost, "/killswitch/trigger?reason=test", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	s.Mux.ServeHTTP(httptest.NewRecorder(), req)
+	if !s.KillSwitch.Triggered() {
+		t.Fatal("the kill switch should be triggered")
+	}
+
+	// A cross-origin form can't set the header
+	req = httptest.NewRequest(http.MethodPost, "/killswitch/arm", nil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://evil.example.com")
+	s.Mux.ServeHTTP(httptest.NewRecorder(), req)
+	if !s.KillSwitch.Triggered() {
+		t.Fatal("the kill switch shouldn't be armed without the token")
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto-triangular-arbitrage-watch/bybit"
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/journal"
+	"crypto-triangular-arbitrage-watch/metrics"
+	"crypto-triangular-arbitrage-watch/notification"
+	"crypto-triangular-arbitrage-watch/risk"
+	"crypto-triangular-arbitrage-watch/runner"
+	"crypto-triangular-arbitrage-watch/tri"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/spf13/viper"
+)
+
+// Server is the embedded HTTP server, routes are only registered when their dependencies are set
+type Server struct {
+	Addr            string
+	Mux             *http.ServeMux
+	Notifier        notification.Notifier
+	KillSwitch      *risk.KillSwitch
+	Tri             *tri.Tri
+	OrderbookRunner *runner.OrderbookRunner
+	Ws              *bybit.Ws
+	JournalPath     string
+	Formatter       *clock.Formatter
+	ControlToken    string // required by state-changing endpoints
+
+	SlackSigningSecret  string
+	SlackAllowedUserIds map[string]bool
+}
+
+func Init() *Server {
+	s := &Server{
+		Addr:                viper.GetString("HTTP_ADDR"),
+		Mux:                 http.NewServeMux(),
+		Formatter:           clock.DefaultFormatter(),
+		ControlToken:        viper.GetString("HTTP_CONTROL_TOKEN"),
+		SlackSigningSecret:  viper.GetString("SLACK_SIGNING_SECRET"),
+		SlackAllowedUserIds: make(map[string]bool),
+	}
+	for _, userId := range viper.GetStringSlice("SLACK_ALLOWED_USER_IDS") {
+		s.SlackAllowedUserIds[userId] = true
+	}
+	return s
+}
+
+func (s *Server) SetNotifier(notifier notification.Notifier) {
+	s.Notifier = notifier
+}
+
+func (s *Server) SetFormatter(f *clock.Formatter) {
+	s.Formatter = f
+}
+
+func (s *Server) SetKillSwitch(ks *risk.KillSwitch) {
+	s.KillSwitch = ks
+}
+
+func (s *Server) SetTri(tri *tri.Tri) {
+	s.Tri = tri
+}
+
+func (s *Server) SetOrderbookRunner(orderbookRunner *runner.OrderbookRunner) {
+	s.OrderbookRunner = orderbookRunner
+}
+
+func (s *Server) SetWs(ws *bybit.Ws) {
+	s.Ws = ws
+}
+
+func (s *Server) SetJournal(j *journal.Journal) {
+	s.JournalPath = j.Path
+}
+
+func (s *Server) routes() {
+	s.Mux.Handle("/metrics", metrics.Handler())
+	if s.KillSwitch != nil {
+		s.Mux.HandleFunc("/killswitch", s.handleKillSwitch)
+		s.Mux.HandleFunc("/killswitch/trigger", s.requireToken(s.handleKillSwitchTrigger))
+		s.Mux.HandleFunc("/killswitch/arm", s.requireToken(s.handleKillSwitchArm))
+	}
+	if s.Tri != nil && s.OrderbookRunner != nil && s.Ws != nil {
+		s.Mux.HandleFunc("/status", s.handleStatus)
+		s.Mux.HandleFunc("/status/orderbooks", s.handleOrderbooks)
+		s.Mux.HandleFunc("/status/combinations", s.handleCombinations)
+		s.Mux.HandleFunc("/status/connections", s.handleConnections)
+		s.Mux.HandleFunc("/status/config", s.handleConfig)
+		s.Mux.HandleFunc("/status/opportunities", s.handleOpportunities)
+		s.Mux.HandleFunc("/events", s.handleEvents)
+		s.Mux.HandleFunc("/feed", s.handleFeed)
+		s.Mux.Handle("/", s.dashboardHandler())
+	}
+	if s.Ws != nil {
+		s.Mux.HandleFunc("/subscriptions", s.handleSubscriptions)
+		s.Mux.HandleFunc("/subscriptions/add", s.requireToken(s.handleSubscriptionsAdd))
+		s.Mux.HandleFunc("/subscriptions/remove", s.requireToken(s.handleSubscriptionsRemove))
+		s.Mux.HandleFunc("/subscriptions/rebalance", s.requireToken(s.handleSubscriptionsRebalance))
+	}
+	if s.SlackSigningSecret != "" && s.OrderbookRunner != nil && s.Ws != nil {
+		s.Mux.HandleFunc("/slack/commands", s.handleSlackCommands)
+	}
+}
+
+// ListenAndServe blocks, it does nothing if HTTP_ADDR isn't set
+func (s *Server) ListenAndServe() {
+	if s.Addr == "" {
+		return
+	}
+	s.routes()
+	s.Notifier.SystemLogs(fmt.Sprintf("HTTP server listening on %s", s.Addr))
+	if err := http.ListenAndServe(s.Addr, s.Mux); err != nil {
+		s.Notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_WARNING, fmt.Sprintf("HTTP server error: %v", err))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
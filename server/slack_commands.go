@@ -0,0 +1,245 @@
+package server
+
+import (
+	"crypto-triangular-arbitrage-watch/journal"
+	"crypto-triangular-arbitrage-watch/notification"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	SLACK_REQUEST_MAX_AGE_SECOND = 300 // replayed requests are rejected
+	SLACK_REQUEST_MAX_BYTES      = 1 << 20
+	SLACK_STATUS_TOP_N           = 5
+)
+
+const slackCommandsUsage = "Usage:\n" +
+	"`status` - detection, threshold, connections and the best combinations\n" +
+	"`pause` / `resume` - pause or resume detection\n" +
+	"`threshold [profit]` - show or set the profit threshold e.g. `0.001` or `0.1%`\n" +
+	"`enable <combination>` / `disable <combination>` - e.g. `disable BTCUSDT->ETHBTC->ETHUSDT`\n" +
+	"`kill [reason]` - trigger the kill switch\n" +
+	"`pnl` - today's PnL"
+
+type SlackCommandResponse struct {
+	ResponseType string `json:"response_type"` // ephemeral: only the user sees the response
+	Text         string `json:"text"`
+}
+
+// POST /slack/commands receives slash commands e.g. `/tri status`, requests are verified with SLACK_SIGNING_SECRET
+func (s *Server) handleSlackCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, SLACK_REQUEST_MAX_BYTES))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "failed to read body")
+		return
+	}
+	if err = verifySlackSignature(s.SlackSigningSecret, r.Header, body, time.Now()); err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid form")
+		return
+	}
+
+	userId := form.Get("user_id")
+	if !s.SlackAllowedUserIds[userId] {
+		writeJSON(w, http.StatusOK, SlackCommandResponse{ResponseType: "ephemeral", Text: "You are not allowed to use this command."})
+		return
+	}
+	// Slack escapes &, < and > of the text e.g. BTCUSDT-&gt;ETHBTC-&gt;ETHUSDT
+	text := strings.TrimSpace(html.UnescapeString(form.Get("text")))
+	s.Notifier.SystemLogs(fmt.Sprintf("Slack command by %s (%s): %s %s", form.Get("user_name"), userId, form.Get("command"), text))
+	writeJSON(w, http.StatusOK, SlackCommandResponse{ResponseType: "ephemeral", Text: s.runSlackCommand(form.Get("user_name"), text)})
+}
+
+// https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > SLACK_REQUEST_MAX_AGE_SECOND*time.Second || age < -SLACK_REQUEST_MAX_AGE_SECOND*time.Second {
+		return fmt.Errorf("timestamp is too old")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("v0:%d:%s", ts, body)))
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+func (s *Server) runSlackCommand(userName string, text string) string {
+	args := strings.Fields(text)
+	if len(args) == 0 {
+		return slackCommandsUsage
+	}
+	switch strings.ToLower(args[0]) {
+	case "status":
+		return s.slackStatus()
+	case "pause":
+		s.OrderbookRunner.Pause()
+		s.Notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_WARNING, fmt.Sprintf("Detection paused by %s", userName))
+		return "Detection paused."
+	case "resume":
+		s.OrderbookRunner.Resume()
+		s.Notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_WARNING, fmt.Sprintf("Detection resumed by %s", userName))
+		return "Detection resumed."
+	case "threshold":
+		if len(args) == 1 {
+			return fmt.Sprintf("Threshold: %s", formatPercent(s.OrderbookRunner.GetTargetProfit()))
+		}
+		threshold, err := parseProfit(args[1])
+		if err != nil {
+			return err.Error()
+		}
+		s.OrderbookRunner.SetTargetProfit(threshold)
+		s.Notifier.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_WARNING, fmt.Sprintf("Threshold changed to %s by %s", formatPercent(threshold), userName))
+		return fmt.Sprintf("Threshold: %s", formatPercent(threshold))
+	case "enable", "disable":
+		if len(args) != 2 {
+			return fmt.Sprintf("Usage: `%s <combination>`", args[0])
+		}
+		var err error
+		if strings.ToLower(args[0]) == "enable" {
+			err = s.OrderbookRunner.EnableCombination(args[1])
+		} else {
+			err = s.OrderbookRunner.DisableCombination(args[1])
+		}
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("%s %sd. Disabled: %s", args[1], strings.ToLower(args[0]), strings.Join(orNone(s.OrderbookRunner.DisabledCombinations()), ", "))
+	case "kill":
+		if s.KillSwitch == nil {
+			return "Kill switch isn't available."
+		}
+		reason := strings.Join(args[1:], " ")
+		if reason == "" {
+			reason = "manual"
+		}
+		s.KillSwitch.Trigger(fmt.Sprintf("slack %s: %s", userName, reason))
+		return fmt.Sprintf("Kill switch triggered, reason: %s", s.KillSwitch.State().Reason)
+	case "pnl":
+		return s.slackPnl()
+	default:
+		return slackCommandsUsage
+	}
+}
+
+func (s *Server) slackStatus() string {
+	var b strings.Builder
+	detection := "running"
+	if s.OrderbookRunner.Paused() {
+		detection = "paused"
+	}
+	fmt.Fprintf(&b, "Detection: %s\n", detection)
+	fmt.Fprintf(&b, "Threshold: %s\n", formatPercent(s.OrderbookRunner.GetTargetProfit()))
+	fmt.Fprintf(&b, "Disabled: %s\n", strings.Join(orNone(s.OrderbookRunner.DisabledCombinations()), ", "))
+	if s.KillSwitch != nil {
+		state := s.KillSwitch.State()
+		if state.Triggered {
+			fmt.Fprintf(&b, "Kill switch: triggered at %s, reason: %s\n", state.TriggeredAt.Format(time.RFC3339), state.Reason)
+		} else {
+			fmt.Fprintf(&b, "Kill switch: armed\n")
+		}
+	}
+	var conns []string
+	for _, conn := range s.Ws.ConnStates() {
+		conns = append(conns, fmt.Sprintf("%s %s %v", conn.Name, conn.Health, time.Since(conn.HealthSince).Round(time.Second)))
+	}
+	fmt.Fprintf(&b, "Connections: %s\n", strings.Join(orNone(conns), ", "))
+
+	profits := s.OrderbookRunner.Profits()
+	sort.Slice(profits, func(i, j int) bool { return profits[i].Profit.GreaterThan(profits[j].Profit) })
+	if len(profits) > SLACK_STATUS_TOP_N {
+		profits = profits[:SLACK_STATUS_TOP_N]
+	}
+	if len(profits) == 0 {
+		b.WriteString("Best combinations: none")
+		return b.String()
+	}
+	b.WriteString("Best combinations:\n```")
+	for _, p := range profits {
+		fmt.Fprintf(&b, "%-36s %9s  size %8s  %s ago\n", p.Combination, formatPercent(p.Profit), p.AvailableSize.StringFixed(0), time.Since(p.UpdatedAt).Round(time.Second))
+	}
+	b.WriteString("```")
+	return b.String()
+}
+
+func (s *Server) slackPnl() string {
+	if s.JournalPath == "" {
+		return "Journal isn't available."
+	}
+	today := s.Formatter.Today()
+	records, err := journal.ReadAll(s.JournalPath, func(rec *journal.Record) bool {
+		return s.Formatter.Day(rec.Ts) == today
+	})
+	if err != nil {
+		return fmt.Sprintf("Failed to read the journal: %v", err)
+	}
+	summaries, err := journal.SummarizePnl(records, journal.BY_DAY, s.Formatter)
+	if err != nil {
+		return err.Error()
+	}
+	if len(summaries) == 0 {
+		return fmt.Sprintf("%s (%s): no cycles", today, s.Formatter.Location)
+	}
+	summary := summaries[0]
+	text := fmt.Sprintf("%s (%s): PnL %s USDT, %d cycles, %d wins", today, s.Formatter.Location, summary.Pnl.StringFixed(4), summary.Cycles, summary.Wins)
+	var fees []string
+	for coin, fee := range journal.SummarizeFees(records) {
+		fees = append(fees, fmt.Sprintf("%s %s", fee.String(), coin))
+	}
+	sort.Strings(fees)
+	if len(fees) > 0 {
+		text += fmt.Sprintf(", fees: %s", strings.Join(fees, ", "))
+	}
+	return text
+}
+
+// e.g. 0.001 or 0.1%
+func parseProfit(s string) (decimal.Decimal, error) {
+	percent := strings.HasSuffix(s, "%")
+	d, err := decimal.NewFromString(strings.TrimSuffix(s, "%"))
+	if err != nil {
+		return d, fmt.Errorf("invalid profit '%s'", s)
+	}
+	if percent {
+		d = d.Div(decimal.NewFromInt(100))
+	}
+	if d.LessThanOrEqual(decimal.NewFromInt(-1)) || d.GreaterThanOrEqual(decimal.NewFromInt(1)) {
+		return d, fmt.Errorf("profit '%s' is out of range", s)
+	}
+	return d, nil
+}
+
+func formatPercent(d decimal.Decimal) string {
+	return d.Mul(decimal.NewFromInt(100)).StringFixed(3) + "%"
+}
+
+func orNone(items []string) []string {
+	if len(items) == 0 {
+		return []string{"none"}
+	}
+	return items
+}
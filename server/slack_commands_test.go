@@ -0,0 +1,312 @@
+package server
+
+import (
+	"crypto-triangular-arbitrage-watch/bybit"
+	"crypto-triangular-arbitrage-watch/clock"
+	"crypto-triangular-arbitrage-watch/journal"
+	"crypto-triangular-arbitrage-watch/notification"
+	"crypto-triangular-arbitrage-watch/risk"
+	"crypto-triangular-arbitrage-watch/runner"
+	"crypto-triangular-arbitrage-watch/tri"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// fakeNotifier keeps the texts, commands log to system_logs
+type fakeNotifier struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (n *fakeNotifier) Notify(channel string, severity notification.Severity, text string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.texts = append(n.texts, text)
+}
+
+func (n *fakeNotifier) SystemLogs(text string) {
+	n.Notify(notification.CHANNEL_SYSTEM_LOGS, notification.SEVERITY_INFO, text)
+}
+
+func (n *fakeNotifier) Publish(msg *notification.Message) {
+	n.Notify(msg.Channel, msg.Severity, msg.Text)
+}
+
+func signSlackRequest(secret string, ts int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("v0:%d:%s", ts, body)))
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func slackHeader(secret string, ts int64, body string) http.Header {
+	header := http.Header{}
+	header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(ts, 10))
+	header.Set("X-Slack-Signature", signSlackRequest(secret, ts, body))
+	return header
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := "command=%2Ftri&text=status&user_id=U1"
+	cases := []struct {
+		name   string
+		header http.Header
+		body   string
+		ok     bool
+	}{
+		{"valid", slackHeader(testSigningSecret, now.Unix(), body), body, true},
+		{"within the max age", slackHeader(testSigningSecret, now.Unix()-SLACK_REQUEST_MAX_AGE_SECOND, body), body, true},
+		{"stale", slackHeader(testSigningSecret, now.Unix()-SLACK_REQUEST_MAX_AGE_SECOND-1, body), body, false},
+		{"from the future", slackHeader(testSigningSecret, now.Unix()+SLACK_REQUEST_MAX_AGE_SECOND+1, body), body, false},
+		{"forged", slackHeader("another secret", now.Unix(), body), body, false},
+		{"tampered body", slackHeader(testSigningSecret, now.Unix(), body), strings.Replace(body, "status", "kill", 1), false},
+		{"missing timestamp", http.Header{"X-Slack-Signature": {signSlackRequest(testSigningSecret, now.Unix(), body)}}, body, false},
+		{"missing signature", http.Header{"X-Slack-Request-Timestamp": {strconv.FormatInt(now.Unix(), 10)}}, body, false},
+	}
+	for _, c := range cases {
+		err := verifySlackSignature(testSigningSecret, c.header, []byte(c.body), now)
+		if c.ok && err != nil {
+			t.Errorf("%s: err = %v, want nil", c.name, err)
+		}
+		if !c.ok && err == nil {
+			t.Errorf("%s: err = nil, want an error", c.name)
+		}
+	}
+}
+
+type slackTest struct {
+	server     *Server
+	notifier   *fakeNotifier
+	runner     *runner.OrderbookRunner
+	killSwitch *risk.KillSwitch
+	clock      *clock.Sim
+	journal    *journal.Journal
+}
+
+func newSlackTest(t *testing.T) *slackTest {
+	t.Helper()
+	btcusdt := &tri.SymbolOrder{Symbol: "BTCUSDT"}
+	ethbtc := &tri.SymbolOrder{Symbol: "ETHBTC"}
+	ethusdt := &tri.SymbolOrder{Symbol: "ETHUSDT"}
+	combination := &tri.Combination{SymbolOrders: []*tri.SymbolOrder{btcusdt, ethbtc, ethusdt}}
+	triangular := &tri.Tri{
+		SymbolOrdersMap:       map[string]*tri.SymbolOrder{"BTCUSDT": btcusdt, "ETHBTC": ethbtc, "ETHUSDT": ethusdt},
+		SymbolCombinationsMap: map[string][]*tri.Combination{"BTCUSDT": {combination}, "ETHBTC": {combination}, "ETHUSDT": {combination}},
+	}
+
+	location, err := time.LoadLocation("Asia/Taipei")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := &clock.Sim{}
+	sim.Set(time.Date(2024, 3, 1, 16, 30, 0, 0, time.UTC)) // 00:30 of 2024-03-02 in Taipei
+	formatter := &clock.Formatter{Clock: sim, Location: location, Layout: clock.DEFAULT_TIME_LAYOUT}
+
+	dir := t.TempDir()
+	jou := journal.Open(filepath.Join(dir, "journal.jsonl"))
+	t.Cleanup(func() { jou.Close() })
+
+	st := &slackTest{notifier: &fakeNotifier{}, clock: sim, journal: jou}
+	st.runner = runner.Init(triangular)
+	st.killSwitch = &risk.KillSwitch{StatePath: filepath.Join(dir, "kill_switch.json")}
+	st.killSwitch.SetNotifier(st.notifier)
+	st.server = &Server{
+		Mux:                 http.NewServeMux(),
+		Formatter:           formatter,
+		SlackSigningSecret:  testSigningSecret,
+		SlackAllowedUserIds: map[string]bool{"U1": true},
+	}
+	st.server.SetNotifier(st.notifier)
+	st.server.SetKillSwitch(st.killSwitch)
+	st.server.SetTri(triangular)
+	st.server.SetOrderbookRunner(st.runner)
+	st.server.SetWs(bybit.InitWs())
+	st.server.SetJournal(jou)
+	st.server.routes()
+	return st
+}
+
+// command posts a signed slash command, Slack escapes the text e.g. -> is -&gt;
+func (st *slackTest) command(t *testing.T, userId string, text string) string {
+	t.Helper()
+	form := url.Values{
+		"command":   {"/tri"},
+		"text":      {strings.ReplaceAll(text, ">", "&gt;")},
+		"user_id":   {userId},
+		"user_name": {"alice"},
+	}
+	body := form.Encode()
+	req := httptest.NewRequest(http.MethodPost, "/slack/commands", strings.NewReader(body))
+	for k, v := range slackHeader(testSigningSecret, time.Now().Unix(), body) {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	st.server.Mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("%s: status = %d, body: %s", text, rec.Code, rec.Body.String())
+	}
+	var resp SlackCommandResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ResponseType != "ephemeral" {
+		t.Errorf("response_type = %s, want ephemeral", resp.ResponseType)
+	}
+	return resp.Text
+}
+
+func TestSlackCommandsRejectsUnsignedRequests(t *testing.T) {
+	st := newSlackTest(t)
+	body := "command=%2Ftri&text=pause&user_id=U1"
+	req := httptest.NewRequest(http.MethodPost, "/slack/commands", strings.NewReader(body))
+	for k, v := range slackHeader("another secret", time.Now().Unix(), body) {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	st.server.Mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if st.runner.Paused() {
+		t.Error("forged pause is executed")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/slack/commands", nil)
+	rec = httptest.NewRecorder()
+	st.server.Mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestSlackCommandsAllowlist(t *testing.T) {
+	st := newSlackTest(t)
+	if text := st.command(t, "U2", "pause"); !strings.Contains(text, "not allowed") {
+		t.Errorf("response = %q, want not allowed", text)
+	}
+	if st.runner.Paused() {
+		t.Error("pause of a user out of the allowlist is executed")
+	}
+	if len(st.notifier.texts) != 0 {
+		t.Errorf("rejected command is logged: %q", st.notifier.texts)
+	}
+}
+
+func TestSlackCommandPauseResume(t *testing.T) {
+	st := newSlackTest(t)
+	if text := st.command(t, "U1", "pause"); text != "Detection paused." || !st.runner.Paused() {
+		t.Fatalf("pause: %q, paused: %v", text, st.runner.Paused())
+	}
+	if text := st.command(t, "U1", "status"); !strings.Contains(text, "Detection: paused") {
+		t.Errorf("status after pause = %q", text)
+	}
+	if text := st.command(t, "U1", "resume"); text != "Detection resumed." || st.runner.Paused() {
+		t.Fatalf("resume: %q, paused: %v", text, st.runner.Paused())
+	}
+	logged := strings.Join(st.notifier.texts, "\n")
+	for _, want := range []string{"Slack command by alice (U1): /tri pause", "Detection paused by alice", "Detection resumed by alice"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("system logs don't contain %q:\n%s", want, logged)
+		}
+	}
+}
+
+func TestSlackCommandThreshold(t *testing.T) {
+	st := newSlackTest(t)
+	st.runner.SetTargetProfit(decimal.NewFromFloat(0.001))
+	if text := st.command(t, "U1", "threshold"); text != "Threshold: 0.100%" {
+		t.Errorf("threshold = %q", text)
+	}
+	if text := st.command(t, "U1", "threshold 0.25%"); text != "Threshold: 0.250%" {
+		t.Errorf("threshold 0.25%% = %q", text)
+	}
+	if text := st.command(t, "U1", "threshold 0.002"); text != "Threshold: 0.200%" {
+		t.Errorf("threshold 0.002 = %q", text)
+	}
+	if !st.runner.GetTargetProfit().Equal(decimal.NewFromFloat(0.002)) {
+		t.Errorf("target profit = %s, want 0.002", st.runner.GetTargetProfit())
+	}
+	for _, invalid := range []string{"threshold abc", "threshold 100%"} {
+		if text := st.command(t, "U1", invalid); !strings.Contains(text, "profit") {
+			t.Errorf("%s = %q, want an error", invalid, text)
+		}
+	}
+	if !st.runner.GetTargetProfit().Equal(decimal.NewFromFloat(0.002)) {
+		t.Errorf("invalid threshold changed the target profit to %s", st.runner.GetTargetProfit())
+	}
+}
+
+func TestSlackCommandEnableDisable(t *testing.T) {
+	st := newSlackTest(t)
+	name := "BTCUSDT->ETHBTC->ETHUSDT"
+	if text := st.command(t, "U1", "disable "+name); text != name+" disabled. Disabled: "+name {
+		t.Errorf("disable = %q", text)
+	}
+	if got := st.runner.DisabledCombinations(); len(got) != 1 || got[0] != name {
+		t.Errorf("disabled = %v", got)
+	}
+	if text := st.command(t, "U1", "enable "+name); text != name+" enabled. Disabled: none" {
+		t.Errorf("enable = %q", text)
+	}
+	if text := st.command(t, "U1", "disable ETHUSDT->ETHBTC->XRPUSDT"); !strings.Contains(text, "doesn't exist") {
+		t.Errorf("disable of an unknown combination = %q", text)
+	}
+	if text := st.command(t, "U1", "disable"); !strings.HasPrefix(text, "Usage:") {
+		t.Errorf("disable without a combination = %q", text)
+	}
+}
+
+func TestSlackCommandKill(t *testing.T) {
+	st := newSlackTest(t)
+	if text := st.command(t, "U1", "kill spread looks wrong"); text != "Kill switch triggered, reason: slack alice: spread looks wrong" {
+		t.Errorf("kill = %q", text)
+	}
+	if !st.killSwitch.Triggered() {
+		t.Fatal("kill switch isn't triggered")
+	}
+	if text := st.command(t, "U1", "status"); !strings.Contains(text, "Kill switch: triggered") {
+		t.Errorf("status after kill = %q", text)
+	}
+}
+
+func TestSlackCommandPnl(t *testing.T) {
+	st := newSlackTest(t)
+	if text := st.command(t, "U1", "pnl"); text != "2024-03-02 (Asia/Taipei): no cycles" {
+		t.Errorf("pnl without cycles = %q", text)
+	}
+
+	// 23:50 of the previous day in Taipei, but the same UTC day
+	st.journal.Record(journal.Record{Type: journal.TYPE_CYCLE, Ts: time.Date(2024, 3, 1, 15, 50, 0, 0, time.UTC), Start: decimal.NewFromInt(100), Pnl: decimal.NewFromInt(5)})
+	st.journal.Record(journal.Record{Type: journal.TYPE_CYCLE, Ts: time.Date(2024, 3, 1, 16, 10, 0, 0, time.UTC), Start: decimal.NewFromInt(100), Pnl: decimal.NewFromFloat(0.5)})
+	st.journal.Record(journal.Record{Type: journal.TYPE_CYCLE, Ts: time.Date(2024, 3, 1, 16, 20, 0, 0, time.UTC), Start: decimal.NewFromInt(100), Pnl: decimal.NewFromFloat(-0.2)})
+	st.journal.Record(journal.Record{Type: journal.TYPE_FILL, Ts: time.Date(2024, 3, 1, 16, 10, 0, 0, time.UTC), Fee: decimal.NewFromFloat(0.1), FeeCoin: "USDT"})
+	want := "2024-03-02 (Asia/Taipei): PnL 0.3000 USDT, 2 cycles, 1 wins, fees: 0.1 USDT"
+	if text := st.command(t, "U1", "pnl"); text != want {
+		t.Errorf("pnl = %q, want %q", text, want)
+	}
+}
+
+func TestSlackCommandUsage(t *testing.T) {
+	st := newSlackTest(t)
+	for _, text := range []string{"", "help", "unknown"} {
+		if got := st.command(t, "U1", text); got != slackCommandsUsage {
+			t.Errorf("%q = %q, want the usage", text, got)
+		}
+	}
+}
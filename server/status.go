@@ -0,0 +1,156 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const REDACTED = "******"
+
+// Keys of the config which contain one of these words are redacted, URLs can embed tokens e.g. webhooks
+// and all values of headers are redacted e.g. Authorization
+var secretKeyWords = []string{"SECRET", "TOKEN", "KEY", "PASSWORD", "URL", "HEADERS"}
+
+// GET /status
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	status := map[string]any{
+		"ts":            time.Now(),
+		"orderbooks":    s.Tri.Books(),
+		"combinations":  s.OrderbookRunner.Profits(),
+		"connections":   s.Ws.ConnStates(),
+		"opportunities": s.OrderbookRunner.RecentOpportunities(10),
+	}
+	if s.KillSwitch != nil {
+		status["kill_switch"] = s.KillSwitch.State()
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// GET /status/orderbooks
+func (s *Server) handleOrderbooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Tri.Books())
+}
+
+// GET /status/combinations
+func (s *Server) handleCombinations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.OrderbookRunner.Profits())
+}
+
+// GET /status/connections
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Ws.ConnStates())
+}
+
+// GET /status/config
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, redactedConfig())
+}
+
+// GET /status/opportunities?limit=...
+func (s *Server) handleOpportunities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.OrderbookRunner.RecentOpportunities(limit))
+}
+
+// redactedConfig returns all loaded settings, keys are uppercase like config.yml
+func redactedConfig() map[string]any {
+	config := make(map[string]any)
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := strings.ToUpper(key)
+		config[name] = redact(name, viper.Get(key))
+	}
+	return config
+}
+
+// redact replaces values of secret keys, including keys of nested items e.g. `token` of NOTIFIERS,
+// nested values of a secret key are replaced as a whole e.g. `headers`
+func redact(key string, value any) any {
+	if isSecretKey(strings.ToUpper(key)) && !isEmpty(value) {
+		return REDACTED
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		redacted := make(map[string]any)
+		for k, item := range v {
+			redacted[k] = redact(k, item)
+		}
+		return redacted
+	case map[any]any:
+		redacted := make(map[string]any)
+		for k, item := range v {
+			redacted[fmt.Sprint(k)] = redact(fmt.Sprint(k), item)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, item := range v {
+			redacted[i] = redact(key, item)
+		}
+		return redacted
+	}
+	return value
+}
+
+func isEmpty(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]any:
+		return len(v) == 0
+	case map[any]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+func isSecretKey(key string) bool {
+	for _, word := range secretKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	notifiers := []any{
+		map[string]any{
+			"type":    "webhook",
+			"url":     "https://hooks.example.com/T000/secret",
+			"headers": map[string]any{"Authorization": "Bearer xxx"},
+			"events":  []any{"opportunity"},
+		},
+		map[any]any{"type": "telegram", "token": "123:abc", "chat_id": "42"},
+	}
+	want := []any{
+		map[string]any{
+			"type":    "webhook",
+			"url":     REDACTED,
+			"headers": REDACTED,
+			"events":  []any{"opportunity"},
+		},
+		map[string]any{"type": "telegram", "token": REDACTED, "chat_id": "42"},
+	}
+	if got := redact("NOTIFIERS", notifiers); !reflect.DeepEqual(got, want) {
+		t.Errorf("redact(NOTIFIERS) = %v, want %v", got, want)
+	}
+
+	cases := []struct {
+		key   string
+		value any
+		want  any
+	}{
+		{"BYBIT_API_SECRET", "xxx", REDACTED},
+		{"SLACK_SEND_MESSAGE_URL", "https://slack.com/api/chat.postMessage", REDACTED},
+		{"BYBIT_API_KEY", "", ""},
+		{"HEADERS", map[string]any{}, map[string]any{}},
+		{"TARGET_PROFIT_FOR_TRADE", 0.001, 0.001},
+	}
+	for _, c := range cases {
+		if got := redact(c.key, c.value); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("redact(%s) = %v, want %v", c.key, got, c.want)
+		}
+	}
+}
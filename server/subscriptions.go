@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// GET /subscriptions
+func (s *Server) handleSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Ws.Conns.Assignments())
+}
+
+// POST /subscriptions/add?topics=orderbook.1.BTCUSDT,orderbook.1.ETHUSDT
+func (s *Server) handleSubscriptionsAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	topics := topicsParam(r)
+	if len(topics) == 0 {
+		writeError(w, http.StatusBadRequest, "topics is required")
+		return
+	}
+	if err := s.Ws.Conns.AddTopics(topics); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Ws.Conns.Assignments())
+}
+
+// POST /subscriptions/remove?topics=orderbook.1.BTCUSDT
+func (s *Server) handleSubscriptionsRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	topics := topicsParam(r)
+	if len(topics) == 0 {
+		writeError(w, http.StatusBadRequest, "topics is required")
+		return
+	}
+	s.Ws.Conns.RemoveTopics(topics)
+	writeJSON(w, http.StatusOK, s.Ws.Conns.Assignments())
+}
+
+// POST /subscriptions/rebalance
+func (s *Server) handleSubscriptionsRebalance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	s.Ws.Conns.Rebalance()
+	writeJSON(w, http.StatusOK, s.Ws.Conns.Assignments())
+}
+
+func topicsParam(r *http.Request) []string {
+	var topics []string
+	for _, topic := range strings.Split(r.URL.Query().Get("topics"), ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"crypto-triangular-arbitrage-watch/bybit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSubscriptionsRequireToken(t *testing.T) {
+	s := Init()
+	s.ControlToken = "secret"
+	// The token is checked before the handler touches the connections
+	s.Ws = &bybit.Ws{}
+	s.routes()
+	for _, path := range []string{"/subscriptions/add?topics=orderbook.1.BTCUSDT", "/subscriptions/remove?topics=orderbook.1.BTCUSDT", "/subscriptions/rebalance"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		rec := httptest.NewRecorder()
+		s.Mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("POST %s = %d, want %d", path, rec.Code, http.StatusUnauthorized)
+		}
+	}
+}
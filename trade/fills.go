@@ -0,0 +1,65 @@
+package trade
+
+import (
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// Fills hands the filled qty of an order from the private channel to the leg which placed it.
+// Orders nobody waits for e.g. placed by other clients or unwound are dropped, so the private channel never blocks.
+type Fills struct {
+	mu      sync.Mutex
+	waiters map[string]chan decimal.Decimal // orderLinkId -> filled qty
+}
+
+func InitFills() *Fills {
+	return &Fills{
+		waiters: make(map[string]chan decimal.Decimal),
+	}
+}
+
+// Expect registers a waiter of the order before it's sent, so the fill can't come back before it
+func (f *Fills) Expect(orderLinkId string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.waiters[orderLinkId] = make(chan decimal.Decimal, 1)
+}
+
+// Forget drops the waiter e.g. the order failed to be sent
+func (f *Fills) Forget(orderLinkId string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.waiters, orderLinkId)
+}
+
+// Deliver sends the filled qty of a done order without blocking, it returns false if nobody waits for it
+func (f *Fills) Deliver(orderLinkId string, qty decimal.Decimal) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch, ok := f.waiters[orderLinkId]
+	if !ok {
+		return false
+	}
+	select {
+	case ch <- qty:
+		return true
+	default:
+		// The order is already delivered
+		return false
+	}
+}
+
+// Wait blocks until the order is done and returns its filled qty, zero if nothing is filled.
+// It returns false if the order isn't expected.
+func (f *Fills) Wait(orderLinkId string) (decimal.Decimal, bool) {
+	f.mu.Lock()
+	ch, ok := f.waiters[orderLinkId]
+	f.mu.Unlock()
+	if !ok {
+		return decimal.Zero, false
+	}
+	qty := <-ch
+	f.Forget(orderLinkId)
+	return qty, true
+}
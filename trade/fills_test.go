@@ -0,0 +1,45 @@
+package trade
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestFillsDropsOrdersNobodyWaitsFor(t *testing.T) {
+	f := InitFills()
+	if f.Deliver("other", decimal.NewFromInt(1)) {
+		t.Fatal("an order which isn't expected should be dropped")
+	}
+	if _, ok := f.Wait("other"); ok {
+		t.Fatal("Wait of an order which isn't expected should return false")
+	}
+}
+
+func TestFillsDeliversToTheWaiter(t *testing.T) {
+	f := InitFills()
+	f.Expect("1")
+	// The fill can come back before the leg waits
+	if !f.Deliver("1", decimal.NewFromInt(2)) {
+		t.Fatal("the fill should be delivered")
+	}
+	if f.Deliver("1", decimal.NewFromInt(3)) {
+		t.Fatal("a second delivery shouldn't block nor be delivered")
+	}
+	qty, ok := f.Wait("1")
+	if !ok || !qty.Equal(decimal.NewFromInt(2)) {
+		t.Fatalf("Wait = %s, %v, want 2, true", qty, ok)
+	}
+	if f.Deliver("1", decimal.NewFromInt(2)) {
+		t.Fatal("the waiter should be removed after Wait")
+	}
+}
+
+func TestFillsForget(t *testing.T) {
+	f := InitFills()
+	f.Expect("1")
+	f.Forget("1")
+	if f.Deliver("1", decimal.Zero) {
+		t.Fatal("a forgotten order should be dropped")
+	}
+}
@@ -0,0 +1,157 @@
+package trade
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// Inventory holds the balances of every coin, it's seeded by the wallet balance API and updated by the `wallet` topic.
+// Reservations are made before orders are sent and released once they are done, so the funds won't be over-committed.
+type Inventory struct {
+	mu           sync.Mutex
+	balances     map[string]*Balance
+	reservations map[string]*Reservation // orderLinkId -> reservation
+}
+
+type Balance struct {
+	Wallet    decimal.Decimal `json:"wallet"`
+	Available decimal.Decimal `json:"available"`
+	Locked    decimal.Decimal `json:"locked"`
+	Reserved  decimal.Decimal `json:"reserved"`   // by in-flight orders
+	UpdatedAt time.Time       `json:"updated_at"` // Bybit time of the wallet balance
+}
+
+type Reservation struct {
+	Coin   string
+	Amount decimal.Decimal
+}
+
+func InitInventory() *Inventory {
+	return &Inventory{
+		balances:     make(map[string]*Balance),
+		reservations: make(map[string]*Reservation),
+	}
+}
+
+// Update overwrites the balances of the coin as of updatedAt, reservations are kept
+func (inv *Inventory) Update(coin string, wallet decimal.Decimal, available decimal.Decimal, locked decimal.Decimal, updatedAt time.Time) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	bal := inv.balance(coin)
+	bal.Wallet = wallet
+	bal.Available = available
+	bal.Locked = locked
+	bal.UpdatedAt = updatedAt
+}
+
+func (inv *Inventory) balance(coin string) *Balance {
+	bal, ok := inv.balances[coin]
+	if !ok {
+		bal = &Balance{}
+		inv.balances[coin] = bal
+	}
+	return bal
+}
+
+// Free is the available balance which isn't reserved
+func (inv *Inventory) Free(coin string) decimal.Decimal {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	bal := inv.balance(coin)
+	return bal.Available.Sub(bal.Reserved)
+}
+
+func (inv *Inventory) Wallet(coin string) decimal.Decimal {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.balance(coin).Wallet
+}
+
+// Reserve returns ErrInsufficientBalance if the free balance isn't enough
+func (inv *Inventory) Reserve(id string, coin string, amount decimal.Decimal) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if _, ok := inv.reservations[id]; ok {
+		return fmt.Errorf("reservation '%s' already exists", id)
+	}
+	bal := inv.balance(coin)
+	free := bal.Available.Sub(bal.Reserved)
+	if amount.GreaterThan(free) {
+		return fmt.Errorf("%w: %s %s is required, %s is free", ErrInsufficientBalance, amount, coin, free)
+	}
+	bal.Reserved = bal.Reserved.Add(amount)
+	inv.reservations[id] = &Reservation{Coin: coin, Amount: amount}
+	return nil
+}
+
+// Release is no-op if the reservation doesn't exist e.g. orders are not placed by this process
+func (inv *Inventory) Release(id string) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	r, ok := inv.reservations[id]
+	if !ok {
+		return
+	}
+	bal := inv.balance(r.Coin)
+	bal.Reserved = bal.Reserved.Sub(r.Amount)
+	delete(inv.reservations, id)
+}
+
+// Settle releases the reservation of an order done at doneAt and deducts what it has spent from the balances.
+// The wallet topic may arrive after the order is done, so the next order can't spend coins which are already gone.
+// Nothing is deducted if the wallet balance is already as of doneAt or later, it has deducted them.
+// The balances are overwritten by the next wallet update anyway.
+func (inv *Inventory) Settle(id string, spent decimal.Decimal, doneAt time.Time) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	r, ok := inv.reservations[id]
+	if !ok {
+		return
+	}
+	bal := inv.balance(r.Coin)
+	bal.Reserved = bal.Reserved.Sub(r.Amount)
+	delete(inv.reservations, id)
+	if spent.IsPositive() && bal.UpdatedAt.Before(doneAt) {
+		bal.Wallet = decimal.Max(bal.Wallet.Sub(spent), decimal.Zero)
+		bal.Available = decimal.Max(bal.Available.Sub(spent), decimal.Zero)
+	}
+}
+
+// Snapshot returns a copy of all balances
+func (inv *Inventory) Snapshot() map[string]Balance {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	balances := make(map[string]Balance)
+	for coin, bal := range inv.balances {
+		balances[coin] = *bal
+	}
+	return balances
+}
+
+// Frees returns the free balance of all coins, locked and reserved funds are excluded
+func (inv *Inventory) Frees() map[string]decimal.Decimal {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	frees := make(map[string]decimal.Decimal)
+	for coin, bal := range inv.balances {
+		frees[coin] = bal.Available.Sub(bal.Reserved)
+	}
+	return frees
+}
+
+// Wallets returns wallet balance of all coins
+func (inv *Inventory) Wallets() map[string]decimal.Decimal {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	wallets := make(map[string]decimal.Decimal)
+	for coin, bal := range inv.balances {
+		wallets[coin] = bal.Wallet
+	}
+	return wallets
+}
@@ -0,0 +1,111 @@
+package trade
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func d(s string) decimal.Decimal {
+	return decimal.RequireFromString(s)
+}
+
+func TestInventoryFreesExcludeLockedAndReserved(t *testing.T) {
+	inv := InitInventory()
+	inv.Update("BTC", d("1"), d("0.8"), d("0.2"), time.Time{})
+	if err := inv.Reserve("1", "BTC", d("0.3")); err != nil {
+		t.Fatal(err)
+	}
+	if free := inv.Frees()["BTC"]; !free.Equal(d("0.5")) {
+		t.Fatalf("free = %s, want 0.5", free)
+	}
+}
+
+func TestInventoryReserve(t *testing.T) {
+	inv := InitInventory()
+	inv.Update("USDT", d("100"), d("100"), d("0"), time.Time{})
+	if err := inv.Reserve("1", "USDT", d("60")); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Reserve("1", "USDT", d("10")); err == nil {
+		t.Fatal("a duplicate id should be rejected")
+	}
+	if err := inv.Reserve("2", "USDT", d("50")); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("err = %v, want ErrInsufficientBalance", err)
+	}
+	if err := inv.Reserve("2", "BTC", d("0.1")); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("err of an unknown coin = %v, want ErrInsufficientBalance", err)
+	}
+	if err := inv.Reserve("2", "USDT", d("40")); err != nil {
+		t.Fatalf("the free balance should be enough, err: %v", err)
+	}
+	if free := inv.Free("USDT"); !free.IsZero() {
+		t.Fatalf("free = %s, want 0", free)
+	}
+}
+
+func TestInventoryRelease(t *testing.T) {
+	inv := InitInventory()
+	inv.Update("USDT", d("100"), d("100"), d("0"), time.Time{})
+	if err := inv.Reserve("1", "USDT", d("60")); err != nil {
+		t.Fatal(err)
+	}
+	inv.Release("1")
+	inv.Release("1")
+	inv.Release("unknown")
+	if free := inv.Free("USDT"); !free.Equal(d("100")) {
+		t.Fatalf("free = %s, want 100", free)
+	}
+	// The id can be reused once it's released
+	if err := inv.Reserve("1", "USDT", d("100")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInventorySettle(t *testing.T) {
+	walletAt := time.UnixMilli(1000)
+	cases := []struct {
+		name     string
+		doneAt   time.Time
+		wantBal  string
+		wantFree string
+	}{
+		// The wallet topic hasn't come yet, the spent coins are deducted until then
+		{"before the wallet update", walletAt.Add(time.Millisecond), "40", "40"},
+		// The wallet balance already has the fill, deducting it again would reject the next order
+		{"after the wallet update", walletAt, "100", "100"},
+		{"older than the wallet update", walletAt.Add(-time.Millisecond), "100", "100"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inv := InitInventory()
+			inv.Update("USDT", d("100"), d("100"), d("0"), walletAt)
+			if err := inv.Reserve("1", "USDT", d("60")); err != nil {
+				t.Fatal(err)
+			}
+			inv.Settle("1", d("60"), c.doneAt)
+			if bal := inv.Wallet("USDT"); !bal.Equal(d(c.wantBal)) {
+				t.Errorf("wallet = %s, want %s", bal, c.wantBal)
+			}
+			if free := inv.Free("USDT"); !free.Equal(d(c.wantFree)) {
+				t.Errorf("free = %s, want %s", free, c.wantFree)
+			}
+			// Settled once
+			inv.Settle("1", d("60"), c.doneAt)
+			if bal := inv.Wallet("USDT"); !bal.Equal(d(c.wantBal)) {
+				t.Errorf("wallet after a duplicate settle = %s, want %s", bal, c.wantBal)
+			}
+		})
+	}
+}
+
+func TestInventorySettleIgnoresOtherOrders(t *testing.T) {
+	inv := InitInventory()
+	inv.Update("USDT", d("100"), d("100"), d("0"), time.Time{})
+	inv.Settle("other", d("60"), time.Now())
+	if bal := inv.Wallet("USDT"); !bal.Equal(d("100")) {
+		t.Fatalf("wallet = %s, want 100", bal)
+	}
+}
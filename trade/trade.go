@@ -9,19 +9,37 @@ const (
 	SIDE_BUY          = "Buy"
 	SIDE_SELL         = "Sell"
 	ORDER_TYPE_MARKET = "Market"
+	ORDER_TYPE_LIMIT  = "Limit"
+	HOME_COIN         = "USDT" // Every cycle starts and ends with this coin
 
 	RETRY_INTERVAL_SECOND = 1
+
+	// Time in force of limit orders
+	TIME_IN_FORCE_GTC       = "GTC"      // good till cancelled
+	TIME_IN_FORCE_IOC       = "IOC"      // fill what it can at once, cancel the rest
+	TIME_IN_FORCE_FOK       = "FOK"      // fill all at once or cancel
+	TIME_IN_FORCE_POST_ONLY = "PostOnly" // cancelled if it would take liquidity
 )
 
+func ValidTimeInForce(tif string) bool {
+	switch tif {
+	case TIME_IN_FORCE_GTC, TIME_IN_FORCE_IOC, TIME_IN_FORCE_FOK, TIME_IN_FORCE_POST_ONLY:
+		return true
+	}
+	return false
+}
+
 type Trade struct {
-	Balance decimal.Decimal      // USDT
-	Qty     chan decimal.Decimal // When ws private channel receives updates, will send a notification to here
-	Retry   chan int
+	Balance   decimal.Decimal // USDT
+	Inventory *Inventory      // All coins
+	Fills     *Fills          // When ws private channel receives updates, will send the filled qty of the order here
+	Retry     chan int
 }
 
 func Init() *Trade {
 	return &Trade{
-		Qty:   make(chan decimal.Decimal),
-		Retry: make(chan int),
+		Inventory: InitInventory(),
+		Fills:     InitFills(),
+		Retry:     make(chan int),
 	}
 }
@@ -7,6 +7,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/shopspring/decimal"
 )
@@ -18,10 +22,11 @@ type Tri struct {
 	SymbolOrdersMap       map[string]*SymbolOrder // to store bid and ask price for each symbol
 	SymbolCombinationsMap map[string][]*Combination
 	SymbolInstrumentMap   map[string]*Instrument
-	Slack                 *notification.Slack
+	Notifier              notification.Notifier
 	OrderbookTopics       map[string]string
 	SymCombPath           string // symbol_combinations.json
 	SymInstPath           string // symbol_instruments.json
+	mu                    sync.RWMutex
 }
 
 // Combination is a paris of 3 symbols
@@ -36,16 +41,35 @@ type SymbolOrder struct {
 	Ask    *Order // The ask price, also known as the offer price, is the lowest price at which a seller (or sellers) is willing to sell
 	Bid    *Order // The bid price is the highest price that a buyer (or buyers) is willing to pay
 	Seq    int64
+	Stale  bool // its connection was down, it isn't ready until the next update
 }
 
 type Order struct {
-	Price decimal.Decimal
-	Size  decimal.Decimal
+	Price decimal.Decimal `json:"price"`
+	Size  decimal.Decimal `json:"size"`
+}
+
+// Book is a copy of the top of the orderbook of a symbol
+type Book struct {
+	Symbol string `json:"symbol"`
+	Topic  string `json:"topic"`
+	Level  int    `json:"level"` // level of the subscribed topic e.g. 50 of orderbook.50.BTCUSDT, only the top of it is kept
+	Bid    *Order `json:"bid"`
+	Ask    *Order `json:"ask"`
+	Seq    int64  `json:"seq"`
+	Stale  bool   `json:"stale"`
 }
 
 type Instrument struct {
+	BaseCoin       string `json:"base_coin"`
+	QuoteCoin      string `json:"quote_coin"`
 	BasePrecision  string `json:"base_precision"`
 	QuotePrecision string `json:"quote_precision"`
+	MinOrderQty    string `json:"min_order_qty"` // base coin
+	MaxOrderQty    string `json:"max_order_qty"` // base coin
+	MinOrderAmt    string `json:"min_order_amt"` // quote coin
+	MaxOrderAmt    string `json:"max_order_amt"` // quote coin
+	TickSize       string `json:"tick_size"`     // price step of limit orders
 }
 
 func Init() *Tri {
@@ -65,14 +89,18 @@ func (tri *Tri) Build() {
 	tri.VerifyInstruments()
 }
 
-func (tri *Tri) SetSlack(slack *notification.Slack) {
-	tri.Slack = slack
+func (tri *Tri) SetNotifier(notifier notification.Notifier) {
+	tri.Notifier = notifier
 }
 
 func (tri *Tri) SetSymCombPath(path string) {
 	tri.SymCombPath = path
 }
 
+func (tri *Tri) SetSymInstPath(path string) {
+	tri.SymInstPath = path
+}
+
 func (tri *Tri) BuildSymbolCombinations() {
 	data := tri.loadSymbolsJson()
 
@@ -141,7 +169,6 @@ func (tri *Tri) VerifyInstruments() {
 }
 
 func (tri *Tri) UpdatePrice(action string, sym string, price Price, seq int64) error {
-	tri.SymbolOrdersMap[sym].Seq = seq
 	p, err := decimal.NewFromString(price[0])
 	if err != nil {
 		return err
@@ -150,6 +177,10 @@ func (tri *Tri) UpdatePrice(action string, sym string, price Price, seq int64) e
 	if err != nil {
 		return err
 	}
+	tri.mu.Lock()
+	defer tri.mu.Unlock()
+	tri.SymbolOrdersMap[sym].Seq = seq
+	tri.SymbolOrdersMap[sym].Stale = false
 	switch action {
 	case trade.BID:
 		tri.SymbolOrdersMap[sym].Bid = &Order{Price: p, Size: s}
@@ -159,6 +190,79 @@ func (tri *Tri) UpdatePrice(action string, sym string, price Price, seq int64) e
 	return nil
 }
 
+// SetStale marks orderbooks of a disconnected connection, combinations of them aren't ready until they are updated
+func (tri *Tri) SetStale(symbols []string) {
+	tri.mu.Lock()
+	defer tri.mu.Unlock()
+	for _, symbol := range symbols {
+		if so, ok := tri.SymbolOrdersMap[symbol]; ok {
+			so.Stale = true
+		}
+	}
+}
+
+// TopPrices returns the best bid and ask of the symbol, a price is zero if it isn't available, ok is false if the symbol isn't watched
+func (tri *Tri) TopPrices(symbol string) (bid decimal.Decimal, ask decimal.Decimal, ok bool) {
+	tri.mu.RLock()
+	defer tri.mu.RUnlock()
+	so, ok := tri.SymbolOrdersMap[symbol]
+	if !ok {
+		return
+	}
+	if so.Bid != nil {
+		bid = so.Bid.Price
+	}
+	if so.Ask != nil {
+		ask = so.Ask.Price
+	}
+	return
+}
+
+// Books returns the top of the orderbooks of all symbols, sorted by symbol
+func (tri *Tri) Books() []Book {
+	tri.mu.RLock()
+	defer tri.mu.RUnlock()
+	books := make([]Book, 0, len(tri.SymbolOrdersMap))
+	for symbol, so := range tri.SymbolOrdersMap {
+		book := Book{Symbol: symbol, Topic: tri.OrderbookTopics[symbol], Seq: so.Seq, Stale: so.Stale}
+		// e.g. orderbook.1.BTCUSDT
+		if parts := strings.Split(book.Topic, "."); len(parts) == 3 {
+			book.Level, _ = strconv.Atoi(parts[1])
+		}
+		if so.Bid != nil {
+			bid := *so.Bid
+			book.Bid = &bid
+		}
+		if so.Ask != nil {
+			ask := *so.Ask
+			book.Ask = &ask
+		}
+		books = append(books, book)
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].Symbol < books[j].Symbol })
+	return books
+}
+
+// Snapshot copies the combination with the top of its orderbooks under the lock, so the prices don't change during a calculation.
+// Orders are replaced instead of updated, so the copy can be read without the lock.
+func (tri *Tri) Snapshot(c *Combination) (*Combination, bool) {
+	tri.mu.RLock()
+	defer tri.mu.RUnlock()
+	snapshot := &Combination{BaseQuote: c.BaseQuote, SymbolOrders: make([]*SymbolOrder, len(c.SymbolOrders))}
+	for i, so := range c.SymbolOrders {
+		copied := *so
+		snapshot.SymbolOrders[i] = &copied
+	}
+	return snapshot, snapshot.Ready()
+}
+
+// Ready tells whether all symbols of a live combination have prices, the orders are read under the lock
+func (tri *Tri) Ready(c *Combination) bool {
+	tri.mu.RLock()
+	defer tri.mu.RUnlock()
+	return c.Ready()
+}
+
 func (c *Combination) Ready() bool {
 	if c.SymbolOrders[0].Ready() && c.SymbolOrders[1].Ready() && c.SymbolOrders[2].Ready() {
 		return true
@@ -166,8 +270,17 @@ func (c *Combination) Ready() bool {
 	return false
 }
 
+// e.g. BTCUSDT->ETHBTC->ETHUSDT
+func (c *Combination) Name() string {
+	var symbols []string
+	for _, so := range c.SymbolOrders {
+		symbols = append(symbols, so.Symbol)
+	}
+	return strings.Join(symbols, "->")
+}
+
 func (so *SymbolOrder) Ready() bool {
-	return so.Bid != nil && so.Ask != nil
+	return so.Bid != nil && so.Ask != nil && !so.Stale
 }
 
 func (tri *Tri) PrintAllSymbols() {
@@ -175,7 +288,7 @@ func (tri *Tri) PrintAllSymbols() {
 	for symbol := range tri.SymbolOrdersMap {
 		symbols = append(symbols, symbol)
 	}
-	tri.Slack.SystemLogs(fmt.Sprintf("SymbolOrdersMap: %v", symbols))
+	tri.Notifier.SystemLogs(fmt.Sprintf("SymbolOrdersMap: %v", symbols))
 }
 
 func (tri *Tri) PrintAllCombinations() {